@@ -2,21 +2,32 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 
 	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
 	"github.com/rayfiyo/zousui/backend/infrastructure/repository"
 	"github.com/rayfiyo/zousui/backend/interface/controller"
 	"github.com/rayfiyo/zousui/backend/interface/gateway"
 	"github.com/rayfiyo/zousui/backend/interface/router"
 	"github.com/rayfiyo/zousui/backend/usecase"
 	"github.com/rayfiyo/zousui/backend/utils/config"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
 	"go.uber.org/zap"
 )
 
 func main() {
+	// コマンドライン引数
+	snapshotPath := flag.String("snapshot", "",
+		"起動時に読み込むワールドのスナップショット (JSON)。指定時は seed データを入れない")
+	snapshotMode := flag.String("snapshot-mode", string(entity.WorldImportReplace),
+		"スナップショットの取り込み方法 (replace|merge)")
+	flag.Parse()
+
 	// zap ロガーの初期化
 	logger, err := zap.NewDevelopment()
 	if err != nil {
@@ -26,55 +37,165 @@ func main() {
 	defer logger.Sync() // ログバッファのフラッシュ
 	zap.ReplaceGlobals(logger)
 
-	// リポジトリ初期化
-	communityRepo := repository.NewMemoryCommunityRepo()
-	agentRepo := repository.NewMemoryAgentRepo()
-	simulationRepo := repository.NewMemorySimulationRepo()
-	logger.Debug("Repositories initialized")
-
 	// 環境変数ロード
 	if err := config.LoadEnv(); err != nil {
 		log.Fatalf("failed to load env: %v", err)
 	}
 	logger.Info("Environment variables loaded")
 
-	// Gemini ゲートウェイ
-	llmGw, err := gateway.NewGeminiLLMGateway(context.Background())
+	// リポジトリ初期化
+	var (
+		communityRepo  domainrepo.CommunityRepository
+		agentRepo      domainrepo.AgentRepository
+		simulationRepo domainrepo.SimulationRepository
+		revisionRepo   domainrepo.CultureRevisionRepository
+		worldRepo      domainrepo.WorldRepository
+		eventStore     domainrepo.EventStore
+		transcriptRepo domainrepo.TranscriptRepository
+		usageRepo      domainrepo.LLMUsageRepository
+		uow            domainrepo.UnitOfWork
+	)
+	switch config.StorageDriver {
+	case consts.StorageDriverMemory:
+		memCommunityRepo := repository.NewMemoryCommunityRepo()
+		memAgentRepo := repository.NewMemoryAgentRepo()
+		memSimulationRepo := repository.NewMemorySimulationRepo()
+		memRevisionRepo := repository.NewMemoryCultureRevisionRepo()
+		communityRepo = memCommunityRepo
+		agentRepo = memAgentRepo
+		simulationRepo = memSimulationRepo
+		revisionRepo = memRevisionRepo
+		worldRepo = repository.NewMemoryWorldRepo(
+			memCommunityRepo, memAgentRepo, memSimulationRepo, memRevisionRepo)
+		memEventStore := repository.NewMemoryEventStore()
+		eventStore = memEventStore
+		memTranscriptRepo := repository.NewMemoryTranscriptRepo()
+		transcriptRepo = memTranscriptRepo
+		usageRepo = repository.NewMemoryLLMUsageRepo()
+		uow = repository.NewMemoryUnitOfWork(memCommunityRepo, memAgentRepo,
+			memSimulationRepo, memRevisionRepo, memEventStore, memTranscriptRepo)
+	case consts.StorageDriverSQLite:
+		db, err := repository.OpenSQLite(context.Background(), config.SQLitePath)
+		if err != nil {
+			logger.Fatal("failed to open sqlite", zap.Error(err))
+		}
+		defer db.Close()
+		communityRepo = repository.NewSQLiteCommunityRepo(db)
+		agentRepo = repository.NewSQLiteAgentRepo(db)
+		simulationRepo = repository.NewSQLiteSimulationRepo(db)
+		revisionRepo = repository.NewSQLiteCultureRevisionRepo(db)
+		worldRepo = repository.NewSQLiteWorldRepo(db)
+		eventStore = repository.NewSQLiteEventStore(db)
+		transcriptRepo = repository.NewSQLiteTranscriptRepo(db)
+		usageRepo = repository.NewSQLiteLLMUsageRepo(db)
+		uow = repository.NewSQLiteUnitOfWork(db)
+	default:
+		logger.Fatal("unknown storage driver",
+			zap.String("storageDriver", config.StorageDriver))
+	}
+	logger.Debug("Repositories initialized",
+		zap.String("storageDriver", config.StorageDriver))
+
+	// LLM ゲートウェイ
+	var llmCache *gateway.LLMCache
+	if config.LLMCacheEnabled {
+		if llmCache, err = gateway.NewLLMCache(config.LLMCacheTTL,
+			config.LLMCacheMaxEntries, config.LLMCachePath); err != nil {
+			logger.Fatal("failed to create llm cache", zap.Error(err))
+		}
+	}
+	llmGws := newLLMGateways(llmCache)
+	defer llmGws.close()
+	llmGw, multiGw, err := newSimulationGateways(context.Background(), llmGws)
 	if err != nil {
-		logger.Fatal("failed to create gemini gateway", zap.Error(err))
+		logger.Fatal("failed to create llm gateways", zap.Error(err))
 	}
-	defer llmGw.Client.Close()
-	logger.Info("Gemini gateway created")
+	for simulationType, strategy := range config.MultiLLMAggregation {
+		if !slices.Contains(entity.LLMAggregationStrategies, strategy) {
+			logger.Fatal("unknown llm aggregation strategy",
+				zap.String("simulationType", simulationType), zap.String("strategy", strategy))
+		}
+	}
+	logger.Info("LLM gateways created",
+		zap.String("provider", config.LLMProvider),
+		zap.Strings("multiProviders", config.MultiLLMProviders),
+		zap.Any("multiAggregation", config.MultiLLMAggregation),
+		zap.String("cassetteMode", config.LLMCassetteMode),
+		zap.Bool("cache", config.LLMCacheEnabled))
 
-	// Mockゲートウェイ
-	mockGw := &gateway.MockLLMGatewayJSON{}
-	logger.Debug("Mock gateway initialized")
+	// LLM の利用量と予算
+	budget := entity.LLMBudget{
+		CostUSD: config.LLMBudgetUSD,
+		Tokens:  config.LLMBudgetTokens,
+		Period:  config.LLMBudgetPeriod,
+	}
+	switch budget.Period {
+	case entity.LLMBudgetPeriodDay, entity.LLMBudgetPeriodTotal:
+	default:
+		logger.Fatal("unknown llm budget period", zap.String("period", budget.Period))
+	}
+	usageUC := usecase.NewLLMUsageUsecase(usageRepo, budget)
 
 	// シミュレーション/外交/コミュニティユースケース
-	simulateUC := usecase.NewSimulateCultureEvolutionUsecase(communityRepo, agentRepo, llmGw)
-	diploUC := usecase.NewDiplomacyUsecase(communityRepo, llmGw)
-	communityUC := usecase.NewCommunityUsecase(communityRepo)
+	// MULTI_LLM_AGGREGATION に載っている種類のシミュレーションは集約ゲートウェイを使う
+	gatewayFor := func(simulationType string) domainrepo.LLMGateway {
+		if _, ok := config.MultiLLMAggregation[simulationType]; ok {
+			return multiGw
+		}
+		return llmGw
+	}
+	simulateUC := usecase.NewSimulateCultureEvolutionUsecase(communityRepo, agentRepo, uow,
+		gatewayFor(entity.SimulationTypeCultureEvolution), usageUC)
+	diploUC := usecase.NewDiplomacyUsecase(communityRepo, uow,
+		gatewayFor(entity.SimulationTypeDiplomacy), usageUC)
+	communityUC := usecase.NewCommunityUsecase(communityRepo, uow)
+	historyUC := usecase.NewCultureHistoryUsecase(communityRepo, revisionRepo)
+	worldUC := usecase.NewWorldUsecase(worldRepo, uow)
+	eventLogUC := usecase.NewEventLogUsecase(eventStore, worldRepo, uow)
+	simulationHistoryUC := usecase.NewSimulationHistoryUsecase(
+		simulationRepo, transcriptRepo)
+	llmStatsUC := usecase.NewLLMStatsUsecase(llmGws.limiters, llmGws.breakers)
 	logger.Debug("Usecases initialized")
 
-	// 集約ゲートウェイ (複数LLMを内部でランダム使用するサンプル)
-	multiGw := gateway.NewMultiLLMGateway(llmGw, mockGw)
-	logger.Debug("Multi LLM gateway initialized")
-
 	// コミュニティ同士の干渉ユースケース
-	interferenceUC := usecase.NewSimulateInterferenceBetweenCommunitiesUsecase(communityRepo, multiGw, simulationRepo)
+	interferenceUC := usecase.NewSimulateInterferenceBetweenCommunitiesUsecase(
+		communityRepo, multiGw, uow, usageUC)
 
 	// コントローラ
-	commCtrl := controller.NewCommunityController(communityUC)
+	commCtrl := controller.NewCommunityController(communityUC, historyUC)
 	diploCtrl := controller.NewDiplomacyController(diploUC)
 	simCtrl := controller.NewSimulateController(simulateUC)
 	imageCtrl := controller.NewImageController(*communityUC)
 	interferenceCtrl := controller.NewInterferenceController(interferenceUC)
-	simulationCtrl := controller.NewSimulationController(simulationRepo)
+	simulationCtrl := controller.NewSimulationController(simulationHistoryUC)
+	worldCtrl := controller.NewWorldController(worldUC)
+	eventCtrl := controller.NewEventController(eventLogUC)
+	llmAdminCtrl := controller.NewLLMAdminController(llmStatsUC)
+	usageCtrl := controller.NewUsageController(usageUC)
 	logger.Debug("Controllers initialized")
 
 	// データ初期化
-	seedData(communityRepo, agentRepo)
-	logger.Info("Seed data inserted")
+	// スナップショット指定時はそれを読み込み、なければ seed データを入れる
+	// （永続ストアに既存データがあれば seed データで上書きしない）
+	if *snapshotPath != "" {
+		if err := loadSnapshot(worldUC, *snapshotPath,
+			entity.WorldImportMode(*snapshotMode)); err != nil {
+			logger.Fatal("failed to load snapshot",
+				zap.String("path", *snapshotPath), zap.Error(err))
+		}
+		logger.Info("Snapshot loaded", zap.String("path", *snapshotPath))
+	} else if seeded, err := seedData(communityUC); err != nil {
+		logger.Fatal("failed to insert seed data", zap.Error(err))
+	} else if seeded {
+		logger.Info("Seed data inserted")
+	}
+
+	// イベントログ導入前のデータがあれば、現在の状態をログの起点にする
+	if recorded, err := eventLogUC.EnsureBaseline(context.TODO()); err != nil {
+		logger.Fatal("failed to record baseline event", zap.Error(err))
+	} else if recorded {
+		logger.Info("Baseline event recorded")
+	}
 
 	// ルーティング
 	r := router.NewRouter(
@@ -84,6 +205,10 @@ func main() {
 		imageCtrl,
 		interferenceCtrl,
 		simulationCtrl,
+		worldCtrl,
+		eventCtrl,
+		llmAdminCtrl,
+		usageCtrl,
 	)
 	logger.Info("Router initialized")
 
@@ -93,8 +218,237 @@ func main() {
 	}
 }
 
-// seedData: テスト用の初期データを挿入
-func seedData(cr *repository.MemoryCommunityRepo, ar *repository.MemoryAgentRepo) {
+// llmGateways: 提供元ごとの LLM ゲートウェイを一度だけ作って使い回す
+type llmGateways struct {
+	gateways map[string]domainrepo.LLMGateway
+	limiters []domainrepo.LLMStatsReporter
+	breakers []domainrepo.LLMBreakerReporter
+	closers  []func() error
+	cache    *gateway.LLMCache // nil ならキャッシュしない
+}
+
+func newLLMGateways(cache *gateway.LLMCache) *llmGateways {
+	return &llmGateways{
+		gateways: make(map[string]domainrepo.LLMGateway),
+		cache:    cache,
+	}
+}
+
+// get: 提供元のゲートウェイを返す
+// LLM とのやり取りをシミュレーションごとに記録するラッパー、流量制限と再試行のラッパー、
+// サーキットブレーカー、キャッシュを使う場合はさらにキャッシュで包む
+func (g *llmGateways) get(
+	ctx context.Context,
+	provider string,
+) (domainrepo.LLMGateway, error) {
+	if gw, ok := g.gateways[provider]; ok {
+		return gw, nil
+	}
+
+	var (
+		gw    domainrepo.LLMGateway
+		model string
+	)
+	switch provider {
+	case consts.LLMProviderGemini:
+		geminiGw, err := gateway.NewGeminiLLMGateway(ctx)
+		if err != nil {
+			return nil, err
+		}
+		g.closers = append(g.closers, geminiGw.Client.Close)
+		gw, model = geminiGw, consts.GeminiModel
+	case consts.LLMProviderOpenAI:
+		openAIGw, err := gateway.NewOpenAILLMGateway(config.OpenAIBaseURL,
+			config.OpenAIAPIKEY, config.OpenAIModel, config.OpenAIJSONMode,
+			config.OpenAITimeout)
+		if err != nil {
+			return nil, err
+		}
+		gw, model = openAIGw, config.OpenAIModel
+	case consts.LLMProviderOllama:
+		ollamaGw, err := gateway.NewOllamaLLMGateway(config.OllamaBaseURL,
+			config.OllamaModel, config.OllamaTimeout, config.OllamaPull)
+		if err != nil {
+			return nil, err
+		}
+		gw, model = ollamaGw, config.OllamaModel
+	case consts.LLMProviderMock:
+		gw = &gateway.MockLLMGatewayJSON{}
+	case consts.LLMProviderScripted:
+		rules := gateway.DefaultMockRules()
+		if config.MockRulesPath != "" {
+			var err error
+			if rules, err = gateway.LoadMockRules(config.MockRulesPath); err != nil {
+				return nil, err
+			}
+		}
+		scriptedGw, err := gateway.NewScriptedMockLLMGateway(rules)
+		if err != nil {
+			return nil, err
+		}
+		gw = scriptedGw
+	default:
+		return nil, fmt.Errorf("unknown llm provider: %q", provider)
+	}
+
+	// 再試行のたびに流量制限の順番を待ち、それぞれの問い合わせを記録に残す
+	limit := config.LLMRateLimits[provider]
+	limited := gateway.NewRateLimitedLLMGateway(
+		gateway.NewRecordingLLMGateway(gw, provider, model), provider,
+		limit.RequestsPerMinute, limit.TokensPerMinute, limit.MaxInFlight)
+	g.limiters = append(g.limiters, limited)
+	gw = gateway.NewRetryLLMGateway(limited, provider,
+		config.LLMMaxRetries, config.LLMRetryBaseDelay, config.LLMRetryMaxDelay)
+	// 再試行しても失敗した問い合わせを提供元の不調として数える
+	breaker := gateway.NewCircuitBreakerLLMGateway(gw, provider,
+		config.LLMBreakerFailures, config.LLMBreakerCooldown)
+	g.breakers = append(g.breakers, breaker)
+	gw = breaker
+	if g.cache != nil {
+		gw = gateway.NewCachingLLMGateway(gw, g.cache, provider, model)
+	}
+	g.gateways[provider] = gw
+	return gw, nil
+}
+
+// newSimulationGateways: シミュレーションで使うゲートウェイと、
+// 集約ゲートウェイ (複数LLMを内部でランダム使用するサンプル) を作る
+// カセットを使う場合はどちらもカセットで包む（再生時は LLM のゲートウェイを作らない）
+func newSimulationGateways(
+	ctx context.Context,
+	g *llmGateways,
+) (domainrepo.LLMGateway, domainrepo.LLMGateway, error) {
+	if config.LLMCassetteMode == consts.CassetteModeReplay {
+		cassette, err := gateway.LoadCassette(config.LLMCassettePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		primary, err := gateway.NewCassetteLLMGateway(nil, cassette,
+			"primary", consts.CassetteModeReplay)
+		if err != nil {
+			return nil, nil, err
+		}
+		multi, err := gateway.NewCassetteLLMGateway(nil, cassette,
+			"multi", consts.CassetteModeReplay)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gateway.NewRecordingLLMGateway(primary, "cassette", ""),
+			gateway.NewRecordingLLMGateway(multi, "cassette", ""), nil
+	}
+
+	var primary, multi domainrepo.LLMGateway
+	primary, err := g.chain(ctx,
+		append([]string{config.LLMProvider}, config.LLMFallbackProviders...))
+	if err != nil {
+		return nil, nil, err
+	}
+	subGws := make([]gateway.NamedLLMGateway, 0, len(config.MultiLLMProviders))
+	for _, provider := range config.MultiLLMProviders {
+		gw, err := g.get(ctx, provider)
+		if err != nil {
+			return nil, nil, fmt.Errorf("provider %s: %w", provider, err)
+		}
+		subGws = append(subGws, gateway.NamedLLMGateway{Name: provider, Gateway: gw})
+	}
+	// 集約プロンプトでの再問い合わせや候補の選択は、失敗したら並び順で次の提供元に回す
+	aggregator, err := g.chain(ctx, config.MultiLLMProviders)
+	if err != nil {
+		return nil, nil, err
+	}
+	multi = gateway.NewRecordingLLMGateway(
+		gateway.NewMultiLLMGateway(aggregator, config.MultiLLMAggregation,
+			config.MultiLLMTimeout, config.MultiLLMQuorum, subGws...), "multi", "")
+	// 集約プロンプトには毎回ランダムな単語が入るため、集約ゲートウェイ全体でもキャッシュする
+	if g.cache != nil {
+		multi = gateway.NewCachingLLMGateway(multi, g.cache, "multi", "")
+	}
+
+	switch config.LLMCassetteMode {
+	case "":
+		return primary, multi, nil
+	case consts.CassetteModeRecord:
+		cassette := gateway.NewRecordingCassette(config.LLMCassettePath)
+		if primary, err = gateway.NewCassetteLLMGateway(primary, cassette,
+			"primary", consts.CassetteModeRecord); err != nil {
+			return nil, nil, err
+		}
+		if multi, err = gateway.NewCassetteLLMGateway(multi, cassette,
+			"multi", consts.CassetteModeRecord); err != nil {
+			return nil, nil, err
+		}
+		return primary, multi, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cassette mode: %q", config.LLMCassetteMode)
+	}
+}
+
+// chain: 提供元を優先順に試すゲートウェイを返す（提供元が1つならそのゲートウェイ）
+// 実際に応答した提供元が分かるよう、連鎖全体も記録する
+func (g *llmGateways) chain(
+	ctx context.Context,
+	providers []string,
+) (domainrepo.LLMGateway, error) {
+	var chain []gateway.NamedLLMGateway
+	for _, provider := range providers {
+		if slices.ContainsFunc(chain, func(c gateway.NamedLLMGateway) bool {
+			return c.Name == provider
+		}) {
+			continue
+		}
+		gw, err := g.get(ctx, provider)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", provider, err)
+		}
+		chain = append(chain, gateway.NamedLLMGateway{Name: provider, Gateway: gw})
+	}
+	switch len(chain) {
+	case 0:
+		return nil, fmt.Errorf("no llm providers")
+	case 1:
+		return chain[0].Gateway, nil
+	}
+	return gateway.NewRecordingLLMGateway(
+		gateway.NewFallbackLLMGateway(chain...), "fallback", ""), nil
+}
+
+// close: 作成したゲートウェイのクライアントを閉じる
+func (g *llmGateways) close() {
+	for _, closeFn := range g.closers {
+		if err := closeFn(); err != nil {
+			zap.L().Warn("Failed to close llm gateway", zap.Error(err))
+		}
+	}
+}
+
+// loadSnapshot: スナップショットファイルを読み込んでワールドに取り込む
+func loadSnapshot(
+	uc *usecase.WorldUsecase,
+	path string,
+	mode entity.WorldImportMode,
+) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return uc.ImportFrom(context.TODO(), f, mode)
+}
+
+// seedData: テスト用の初期データを挿入（ゴミ箱も含めコミュニティが1件でもあれば何もしない）
+func seedData(
+	uc *usecase.CommunityUsecase,
+) (bool, error) {
+	ctx := context.TODO()
+
+	existing, err := uc.GetAllCommunities(ctx, true)
+	if err != nil {
+		return false, err
+	}
+	if len(existing) > 0 {
+		return false, nil
+	}
+
 	communityID := "comm-1"
 	comm := &entity.Community{
 		ID:         communityID,
@@ -102,7 +456,9 @@ func seedData(cr *repository.MemoryCommunityRepo, ar *repository.MemoryAgentRepo
 		Population: 100,
 		Culture:    "砂漠での生存術が中心の文化",
 	}
-	cr.Save(context.TODO(), comm)
+	if err := uc.CreateCommunity(ctx, comm); err != nil {
+		return false, err
+	}
 
 	// 他に複数作ってもOK
 	communityID2 := "comm-2"
@@ -112,7 +468,9 @@ func seedData(cr *repository.MemoryCommunityRepo, ar *repository.MemoryAgentRepo
 		Population: 300,
 		Culture:    "海底で歌と踊りを好む平和な国",
 	}
-	cr.Save(context.TODO(), comm2)
+	if err := uc.CreateCommunity(ctx, comm2); err != nil {
+		return false, err
+	}
 
 	agent1 := &entity.Agent{
 		ID:          "agent-1",
@@ -126,6 +484,11 @@ func seedData(cr *repository.MemoryCommunityRepo, ar *repository.MemoryAgentRepo
 		CommunityID: communityID,
 		Personality: "勇敢で戦闘的",
 	}
+	for _, a := range []*entity.Agent{agent1, agent2} {
+		if err := uc.AddAgent(ctx, a); err != nil {
+			return false, err
+		}
+	}
 
-	ar.Agents = append(ar.Agents, agent1, agent2)
+	return true, nil
 }
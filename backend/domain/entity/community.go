@@ -10,6 +10,8 @@ type Community struct {
 	Population  int
 	Culture     string
 	UpdatedAt   time.Time
+	Version     int        // 楽観的排他制御用の版（未保存なら 0、保存のたびに 1 増える）
+	DeletedAt   *time.Time // ゴミ箱に入れた日時（削除されていなければ nil）
 }
 
 // UpdateCulture: コミュニティの文化情報を更新するドメインロジック
@@ -17,3 +19,20 @@ func (c *Community) UpdateCulture(newCulture string) {
 	c.Culture = newCulture
 	c.UpdatedAt = time.Now()
 }
+
+// IsDeleted: ゴミ箱に入っているか
+func (c *Community) IsDeleted() bool {
+	return c.DeletedAt != nil
+}
+
+// MarkDeleted: コミュニティをゴミ箱に入れる
+func (c *Community) MarkDeleted(at time.Time) {
+	c.DeletedAt = &at
+	c.UpdatedAt = at
+}
+
+// Restore: ゴミ箱からコミュニティを戻す
+func (c *Community) Restore(at time.Time) {
+	c.DeletedAt = nil
+	c.UpdatedAt = at
+}
@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// CultureRevision: コミュニティの文化・人口の変更を1件ずつ記録した不変の履歴
+type CultureRevision struct {
+	CommunityID     string
+	Revision        int    // コミュニティごとに 1 から始まる連番
+	PrevCulture     string // 変更前の文化
+	NewCulture      string // 変更後の文化
+	PrevPopulation  int    // 変更前の人口
+	PopulationDelta int    // 人口の増減
+	SimulationID    string // 変更の原因となったシミュレーションのID
+	SimulationType  string // "culture_evolution", "diplomacy", "interference" など
+	CreatedAt       time.Time
+}
+
+// NewCultureRevision: 変更前後のコミュニティから改訂を作る
+// 文化も人口も変わっていなければ nil を返す
+func NewCultureRevision(
+	before Community,
+	after *Community,
+	simulationID, simulationType string,
+) *CultureRevision {
+	if before.Culture == after.Culture && before.Population == after.Population {
+		return nil
+	}
+	return &CultureRevision{
+		CommunityID:     after.ID,
+		PrevCulture:     before.Culture,
+		NewCulture:      after.Culture,
+		PrevPopulation:  before.Population,
+		PopulationDelta: after.Population - before.Population,
+		SimulationID:    simulationID,
+		SimulationType:  simulationType,
+	}
+}
@@ -0,0 +1,147 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ドメインイベントの種類
+type DomainEventType string
+
+const (
+	EventCommunityCreated    DomainEventType = "CommunityCreated"
+	EventCommunityDeleted    DomainEventType = "CommunityDeleted" // ゴミ箱に入れた
+	EventCommunityRestored   DomainEventType = "CommunityRestored"
+	EventCommunityPurged     DomainEventType = "CommunityPurged" // 関連データごと完全に削除した
+	EventCultureChanged      DomainEventType = "CultureChanged"
+	EventPopulationChanged   DomainEventType = "PopulationChanged"
+	EventDiplomacyConcluded  DomainEventType = "DiplomacyConcluded"
+	EventInterferenceApplied DomainEventType = "InterferenceApplied"
+	EventAgentAdded          DomainEventType = "AgentAdded"
+	EventSimulationRecorded  DomainEventType = "SimulationRecorded"
+	EventWorldImported       DomainEventType = "WorldImported"
+)
+
+// DomainEvent: ワールドに起きた変更を1件ずつ表す追記専用の記録
+type DomainEvent struct {
+	Seq          int64           // ストアが採番する通し番号
+	Type         DomainEventType // イベントの種類
+	AggregateID  string          // 対象の ID（主にコミュニティID）
+	SimulationID string          // 変更の原因となったシミュレーションのID
+	Payload      json.RawMessage // 種類ごとの内容
+	OccurredAt   time.Time
+}
+
+// NewDomainEvent: payload を JSON にしてイベントを作る
+func NewDomainEvent(
+	eventType DomainEventType,
+	aggregateID, simulationID string,
+	payload any,
+) (*DomainEvent, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", eventType, err)
+	}
+	return &DomainEvent{
+		Type:         eventType,
+		AggregateID:  aggregateID,
+		SimulationID: simulationID,
+		Payload:      raw,
+		OccurredAt:   time.Now(),
+	}, nil
+}
+
+// DecodePayload: Payload を種類に応じた構造体に読み込む
+func (e *DomainEvent) DecodePayload(v any) error {
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode %s payload (seq %d): %w", e.Type, e.Seq, err)
+	}
+	return nil
+}
+
+// 各イベントの Payload
+type (
+	CommunityCreatedPayload struct {
+		Community Community `json:"community"`
+	}
+	CommunityDeletedPayload struct {
+		DeletedAt time.Time `json:"deletedAt"`
+		Version   int       `json:"version"`
+	}
+	CommunityRestoredPayload struct {
+		Version int `json:"version"`
+	}
+	CommunityPurgedPayload struct{}
+	CultureChangedPayload  struct {
+		PrevCulture    string `json:"prevCulture"`
+		NewCulture     string `json:"newCulture"`
+		SimulationType string `json:"simulationType"`
+		Version        int    `json:"version"` // 変更後のコミュニティの版
+	}
+	PopulationChangedPayload struct {
+		PrevPopulation int    `json:"prevPopulation"`
+		NewPopulation  int    `json:"newPopulation"`
+		SimulationType string `json:"simulationType"`
+		Version        int    `json:"version"` // 変更後のコミュニティの版
+	}
+	DiplomacyConcludedPayload struct {
+		CommunityA  string `json:"communityA"`
+		CommunityB  string `json:"communityB"`
+		Outcome     string `json:"outcome"`
+		Description string `json:"description"`
+		PopChangeA  int    `json:"popChangeA"`
+		PopChangeB  int    `json:"popChangeB"`
+	}
+	InterferenceAppliedPayload struct {
+		Communities []string        `json:"communities"`
+		UserInput   string          `json:"userInput,omitempty"`
+		Result      json.RawMessage `json:"result,omitempty"`
+	}
+	AgentAddedPayload struct {
+		Agent Agent `json:"agent"`
+	}
+	SimulationRecordedPayload struct {
+		Simulation SimulationResult `json:"simulation"`
+	}
+	WorldImportedPayload struct {
+		Mode     WorldImportMode `json:"mode"`
+		Snapshot WorldSnapshot   `json:"snapshot"`
+	}
+)
+
+// CommunityChangeEvents: 変更前後のコミュニティから文化・人口の変更イベントを作る
+func CommunityChangeEvents(
+	before Community,
+	after *Community,
+	simulationID, simulationType string,
+) ([]*DomainEvent, error) {
+	var events []*DomainEvent
+	if before.Culture != after.Culture {
+		e, err := NewDomainEvent(EventCultureChanged, after.ID, simulationID,
+			CultureChangedPayload{
+				PrevCulture:    before.Culture,
+				NewCulture:     after.Culture,
+				SimulationType: simulationType,
+				Version:        after.Version,
+			})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if before.Population != after.Population {
+		e, err := NewDomainEvent(EventPopulationChanged, after.ID, simulationID,
+			PopulationChangedPayload{
+				PrevPopulation: before.Population,
+				NewPopulation:  after.Population,
+				SimulationType: simulationType,
+				Version:        after.Version,
+			})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,42 @@
+package entity
+
+// 複数の LLM の回答から最終的な回答を決める方法
+const (
+	LLMAggregateSynthesize = "synthesize"  // 回答をまとめた集約プロンプトで新たな回答を作らせる
+	LLMAggregateFirstValid = "first_valid" // 並び順で最初に形式に合った回答を使う
+	LLMAggregateVote       = "vote"        // 選択肢のある項目（外交の outcome など）の多数決
+	LLMAggregateMean       = "mean"        // 整数の項目（人口の変化など）を平均する
+	LLMAggregateMedian     = "median"      // 整数の項目を中央値にする
+	LLMAggregateJudge      = "judge"       // LLM に最も良い回答を選ばせる
+)
+
+// LLMAggregationStrategies: 指定できる集約の方法
+var LLMAggregationStrategies = []string{
+	LLMAggregateSynthesize,
+	LLMAggregateFirstValid,
+	LLMAggregateVote,
+	LLMAggregateMean,
+	LLMAggregateMedian,
+	LLMAggregateJudge,
+}
+
+// LLMCandidate: 集約の対象になった1つのサブゲートウェイの回答
+type LLMCandidate struct {
+	Gateway  string `json:"gateway"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Valid    bool   `json:"valid"` // 応答の形式に合っていた（形式の指定がなければ空でない）
+	// 問い合わせにかかった時間と、期限を過ぎた・定足数がそろったため取り消したか
+	LatencyMs int64 `json:"latencyMs"`
+	TimedOut  bool  `json:"timedOut,omitempty"`
+	Canceled  bool  `json:"canceled,omitempty"`
+}
+
+// LLMAggregation: 複数の LLM の回答をどのようにまとめたか
+type LLMAggregation struct {
+	Strategy   string         `json:"strategy"`
+	Candidates []LLMCandidate `json:"candidates"`
+	// 最終的な回答にそのまま使った候補の位置（回答を作り直した・組み合わせた場合は nil）
+	Chosen *int   `json:"chosen,omitempty"`
+	Note   string `json:"note,omitempty"` // 選んだ理由や、指定の方法を使えなかった理由
+}
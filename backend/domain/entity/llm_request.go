@@ -0,0 +1,111 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LLM に渡すメッセージの役割
+const (
+	LLMRoleSystem    = "system"    // モデルの振る舞いの指示
+	LLMRoleUser      = "user"      // 問い合わせ
+	LLMRoleAssistant = "assistant" // モデルの前回の応答
+)
+
+// LLMMessage: 会話の1つのメッセージ
+type LLMMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMSampling: 生成の設定（未指定の項目は提供元の既定を使う）
+type LLMSampling struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"topP,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"` // 出力するトークン数の上限（0 は提供元の既定）
+	Seed        *int64   `json:"seed,omitempty"`      // 対応する提供元だけが使う
+}
+
+// NewLLMSampling: 温度だけを指定した設定
+func NewLLMSampling(temperature float64) LLMSampling {
+	return LLMSampling{Temperature: &temperature}
+}
+
+// IsZero: 何も指定していないか
+func (s LLMSampling) IsZero() bool {
+	return s.Temperature == nil && s.TopP == nil && s.MaxTokens == 0 && s.Seed == nil
+}
+
+// LLMRequest: LLM への1回の問い合わせ
+type LLMRequest struct {
+	Messages []LLMMessage
+	// 利用者が入力した追加の指示。最後の user メッセージとして送る
+	// （記録で伏せ字にできるよう、他のメッセージと分けて持つ）
+	UserInput string
+	Sampling  LLMSampling
+	Schema    *ResponseSchema // 期待する応答の形式。対応するゲートウェイはこの形式で出力させる
+
+	// 問い合わせの由来（キャッシュのキーや、集約・モックの振る舞いに使う）
+	SimulationType string
+	CommunityIDs   []string
+}
+
+// NewLLMRequest: プロンプトを1つの user メッセージとして送る問い合わせ
+func NewLLMRequest(prompt, userInput string) *LLMRequest {
+	return &LLMRequest{
+		Messages:  []LLMMessage{{Role: LLMRoleUser, Content: prompt}},
+		UserInput: userInput,
+	}
+}
+
+// Clone: メッセージの一覧を複製した問い合わせ（複製側でメッセージを足しても元に影響しない）
+func (r *LLMRequest) Clone() *LLMRequest {
+	c := *r
+	c.Messages = append([]LLMMessage(nil), r.Messages...)
+	return &c
+}
+
+// SystemPrompt: system メッセージをつなげたもの（無ければ空）
+func (r *LLMRequest) SystemPrompt() string {
+	var parts []string
+	for _, m := range r.Messages {
+		if m.Role == LLMRoleSystem {
+			parts = append(parts, m.Content)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Conversation: system 以外のメッセージに、利用者の入力を最後の user メッセージとして加えたもの
+func (r *LLMRequest) Conversation() []LLMMessage {
+	var msgs []LLMMessage
+	for _, m := range r.Messages {
+		if m.Role != LLMRoleSystem {
+			msgs = append(msgs, m)
+		}
+	}
+	if r.UserInput != "" {
+		msgs = append(msgs, LLMMessage{Role: LLMRoleUser, Content: r.UserInput})
+	}
+	return msgs
+}
+
+// Prompt: system 以外のメッセージを1つのテキストにしたもの（利用者の入力は含まない）
+// 役割を扱えない提供元や、記録・キャッシュのキーに使う
+// メッセージが1つならその内容をそのまま返す
+func (r *LLMRequest) Prompt() string {
+	var msgs []LLMMessage
+	for _, m := range r.Messages {
+		if m.Role != LLMRoleSystem {
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) == 1 {
+		return msgs[0].Content
+	}
+	parts := make([]string, len(msgs))
+	for i, m := range msgs {
+		parts[i] = fmt.Sprintf("[%s]\n%s", m.Role, m.Content)
+	}
+	return strings.Join(parts, "\n\n")
+}
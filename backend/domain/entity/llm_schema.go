@@ -0,0 +1,202 @@
+package entity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ResponseSchema: LLM に JSON で返させる応答の形式
+type ResponseSchema struct {
+	Name   string
+	Fields []SchemaField
+}
+
+type SchemaFieldType string
+
+const (
+	SchemaString  SchemaFieldType = "string"
+	SchemaInteger SchemaFieldType = "integer"
+)
+
+// SchemaField: 応答の JSON オブジェクトの1つのキー
+type SchemaField struct {
+	Name     string
+	Type     SchemaFieldType
+	Required bool     // 必須の文字列は空も認めない
+	Enum     []string // 文字列のとりうる値（空なら制限なし）
+	Min, Max *int     // 整数の範囲（nil なら制限なし）
+}
+
+// 人口の変化として受け付ける範囲
+const maxPopulationChange = 1000
+
+func bound(n int) *int { return &n }
+
+// 各シミュレーションの応答形式
+var (
+	// 文化進化・1つのコミュニティへの干渉
+	CultureUpdateSchema = &ResponseSchema{
+		Name: "culture_update",
+		Fields: []SchemaField{
+			{Name: "newCulture", Type: SchemaString, Required: true},
+			{Name: "populationChange", Type: SchemaInteger, Required: true,
+				Min: bound(-maxPopulationChange), Max: bound(maxPopulationChange)},
+		},
+	}
+	// 外交
+	DiplomacyOutcomeSchema = &ResponseSchema{
+		Name: "diplomacy_outcome",
+		Fields: []SchemaField{
+			{Name: "outcome", Type: SchemaString, Required: true,
+				Enum: []string{"peace", "war", "trade", "alliance"}},
+			{Name: "description", Type: SchemaString, Required: true},
+			{Name: "popChangeA", Type: SchemaInteger, Required: true,
+				Min: bound(-maxPopulationChange), Max: bound(maxPopulationChange)},
+			{Name: "popChangeB", Type: SchemaInteger, Required: true,
+				Min: bound(-maxPopulationChange), Max: bound(maxPopulationChange)},
+		},
+	}
+	// 2つのコミュニティの干渉
+	TwoPartyInterferenceSchema = &ResponseSchema{
+		Name: "two_party_interference",
+		Fields: []SchemaField{
+			{Name: "newCultureA", Type: SchemaString, Required: true},
+			{Name: "populationChangeA", Type: SchemaInteger, Required: true,
+				Min: bound(-maxPopulationChange), Max: bound(maxPopulationChange)},
+			{Name: "newCultureB", Type: SchemaString, Required: true},
+			{Name: "populationChangeB", Type: SchemaInteger, Required: true,
+				Min: bound(-maxPopulationChange), Max: bound(maxPopulationChange)},
+		},
+	}
+	// 集約で LLM に最も良い候補を選ばせたときの回答
+	JudgeChoiceSchema = &ResponseSchema{
+		Name: "judge_choice",
+		Fields: []SchemaField{
+			{Name: "choice", Type: SchemaInteger, Required: true, Min: bound(1)},
+			{Name: "reason", Type: SchemaString},
+		},
+	}
+)
+
+// Validate: JSON オブジェクトが形式に合うか調べ、合わない点をまとめて返す
+func (s *ResponseSchema) Validate(raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("not a JSON object: %w", err)
+	}
+
+	var problems []string
+	for _, f := range s.Fields {
+		v, ok := obj[f.Name]
+		if !ok || v == nil {
+			if f.Required {
+				problems = append(problems, fmt.Sprintf("%q is required", f.Name))
+			}
+			continue
+		}
+		if p := f.check(v); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// check: 値が型・範囲に合わなければ理由を返す
+func (f SchemaField) check(v any) string {
+	switch f.Type {
+	case SchemaString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Sprintf("%q must be a string", f.Name)
+		}
+		if f.Required && strings.TrimSpace(s) == "" {
+			return fmt.Sprintf("%q must not be empty", f.Name)
+		}
+		if len(f.Enum) > 0 && !containsString(f.Enum, s) {
+			return fmt.Sprintf("%q must be one of %s", f.Name, strings.Join(f.Enum, "|"))
+		}
+	case SchemaInteger:
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Sprintf("%q must be an integer", f.Name)
+		}
+		iv, err := n.Int64()
+		if err != nil {
+			return fmt.Sprintf("%q must be an integer", f.Name)
+		}
+		if (f.Min != nil && iv < int64(*f.Min)) || (f.Max != nil && iv > int64(*f.Max)) {
+			return fmt.Sprintf("%q must be between %d and %d", f.Name,
+				valueOr(f.Min, math.MinInt), valueOr(f.Max, math.MaxInt))
+		}
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func valueOr(p *int, fallback int) int {
+	if p == nil {
+		return fallback
+	}
+	return *p
+}
+
+// ExtractJSONObject: コードブロックや前後の文章に囲まれた応答から、最初の正しい JSON オブジェクトを取り出す
+func ExtractJSONObject(text string) (string, error) {
+	for start := strings.IndexByte(text, '{'); start >= 0; {
+		if end := matchingBrace(text, start); end > 0 {
+			candidate := text[start : end+1]
+			if json.Valid([]byte(candidate)) {
+				return candidate, nil
+			}
+		}
+		next := strings.IndexByte(text[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return "", errors.New("no JSON object found in the response")
+}
+
+// matchingBrace: text[start] の '{' に対応する '}' の位置（文字列中の括弧は数えない）
+func matchingBrace(text string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
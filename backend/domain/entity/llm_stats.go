@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// LLMLimiterStats: LLM ゲートウェイの流量制限の状況
+type LLMLimiterStats struct {
+	Gateway           string  `json:"gateway"`
+	RequestsPerMinute int     `json:"requestsPerMinute"` // 0 は制限なし
+	TokensPerMinute   int     `json:"tokensPerMinute"`   // 0 は制限なし
+	MaxInFlight       int     `json:"maxInFlight"`       // 0 は制限なし
+	InFlight          int     `json:"inFlight"`          // 問い合わせ中の数
+	Waiting           int     `json:"waiting"`           // 順番待ちの数
+	Requests          int64   `json:"requests"`          // 順番が来て問い合わせた数
+	Canceled          int64   `json:"canceled"`          // 順番待ちの間に取り消された数
+	TotalWaitMs       int64   `json:"totalWaitMs"`
+	MaxWaitMs         int64   `json:"maxWaitMs"`
+	AvgWaitMs         float64 `json:"avgWaitMs"`
+}
+
+// サーキットブレーカーの状態
+const (
+	LLMBreakerClosed   = "closed"    // 通常どおり問い合わせる
+	LLMBreakerOpen     = "open"      // 失敗が続いたため、しばらく問い合わせずに断る
+	LLMBreakerHalfOpen = "half_open" // 回復したか確かめるため、1件だけ試しに問い合わせる
+)
+
+// LLMBreakerStats: LLM ゲートウェイのサーキットブレーカーの状況
+type LLMBreakerStats struct {
+	Gateway             string     `json:"gateway"`
+	State               string     `json:"state"`               // LLMBreaker*
+	FailureThreshold    int        `json:"failureThreshold"`    // この回数続けて失敗すると open にする
+	CooldownMs          int64      `json:"cooldownMs"`          // open にしてから試しに問い合わせるまでの時間
+	ConsecutiveFailures int        `json:"consecutiveFailures"` // 続けて失敗した回数
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`  // 最後に open にした日時
+	LastError           string     `json:"lastError,omitempty"`
+	Successes           int64      `json:"successes"`
+	Failures            int64      `json:"failures"`
+	Rejected            int64      `json:"rejected"` // open のため問い合わせずに断った数
+}
@@ -0,0 +1,40 @@
+package entity
+
+import "context"
+
+// LLMStreamEvent: 生成中の応答の断片
+type LLMStreamEvent struct {
+	Text string
+	// 新たな生成を始めた（再試行・フォールバック・問い直しなど。それまでの断片は捨てる）
+	Reset bool
+}
+
+// LLMStreamFunc: 生成中の応答の断片を受け取る関数
+type LLMStreamFunc func(LLMStreamEvent)
+
+type llmStreamKey struct{}
+
+// ContextWithLLMStream: 以降の問い合わせで、応答を生成しながら断片を fn に渡させる
+func ContextWithLLMStream(ctx context.Context, fn LLMStreamFunc) context.Context {
+	return context.WithValue(ctx, llmStreamKey{}, fn)
+}
+
+// ContextWithoutLLMStream: 以降の問い合わせでは断片を渡させない（集約の途中の問い合わせなど）
+func ContextWithoutLLMStream(ctx context.Context) context.Context {
+	return context.WithValue(ctx, llmStreamKey{}, LLMStreamFunc(nil))
+}
+
+// LLMStreamFromContext: 断片の受け取り先がなければ nil
+func LLMStreamFromContext(ctx context.Context) LLMStreamFunc {
+	fn, _ := ctx.Value(llmStreamKey{}).(LLMStreamFunc)
+	return fn
+}
+
+// StreamLLMResponse: 一度に得た応答を1つの断片として渡す
+// 生成しながら返せない提供元や、キャッシュ・カセットから返す応答に使う
+func StreamLLMResponse(ctx context.Context, text string) {
+	if fn := LLMStreamFromContext(ctx); fn != nil {
+		fn(LLMStreamEvent{Reset: true})
+		fn(LLMStreamEvent{Text: text})
+	}
+}
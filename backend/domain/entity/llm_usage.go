@@ -0,0 +1,221 @@
+package entity
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// LLMUsage: LLM の利用量
+type LLMUsage struct {
+	Calls            int     `json:"calls"` // 提供元へ実際に問い合わせた回数（キャッシュから返したものは含まない）
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	CostUSD          float64 `json:"costUsd"`
+}
+
+// Add: 利用量を足し合わせる
+func (u *LLMUsage) Add(o LLMUsage) {
+	u.Calls += o.Calls
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+	u.CostUSD += o.CostUSD
+}
+
+// LLMUsageRecord: 1回のシミュレーションで使った LLM の利用量
+// シミュレーションが失敗しても、問い合わせた分は記録する
+type LLMUsageRecord struct {
+	ID             string              `json:"id"`
+	SimulationID   string              `json:"simulationId"`
+	SimulationType string              `json:"simulationType"`
+	Communities    []string            `json:"communities"`
+	Usage          LLMUsage            `json:"usage"`
+	ByModel        map[string]LLMUsage `json:"byModel"` // キーは "ゲートウェイ名/モデル"
+	CreatedAt      time.Time           `json:"createdAt"`
+}
+
+// NewLLMUsageRecord: やり取りの記録から利用量をまとめる
+// 内部で他の問い合わせを行ったやり取り（集約ゲートウェイなど）とキャッシュから返したやり取りは数えない
+func NewLLMUsageRecord(
+	id string,
+	transcript *Transcript,
+	simulationType string,
+	communities ...string,
+) *LLMUsageRecord {
+	r := &LLMUsageRecord{
+		ID:             id,
+		SimulationID:   transcript.SimulationID,
+		SimulationType: simulationType,
+		Communities:    communities,
+		ByModel:        make(map[string]LLMUsage),
+	}
+	parents := make(map[int]bool)
+	for _, e := range transcript.Exchanges {
+		if e.ParentSeq != 0 {
+			parents[e.ParentSeq] = true
+		}
+	}
+	for _, e := range transcript.Exchanges {
+		if e.Cached || parents[e.Seq] {
+			continue
+		}
+		u := LLMUsage{
+			Calls:            1,
+			PromptTokens:     e.PromptTokens,
+			CompletionTokens: e.CompletionTokens,
+			TotalTokens:      e.PromptTokens + e.CompletionTokens,
+			CostUSD:          e.CostUSD,
+		}
+		r.Usage.Add(u)
+		key := e.Gateway
+		if e.Model != "" {
+			key += "/" + e.Model
+		}
+		m := r.ByModel[key]
+		m.Add(u)
+		r.ByModel[key] = m
+	}
+	return r
+}
+
+// LLMUsageGroup: 集計の単位（日・コミュニティ・モデル）ごとの利用量
+type LLMUsageGroup struct {
+	Key   string   `json:"key"`
+	Usage LLMUsage `json:"usage"`
+}
+
+// LLMUsageReport: 期間内の利用量の集計
+type LLMUsageReport struct {
+	Total       LLMUsage         `json:"total"`
+	ByDay       []LLMUsageGroup  `json:"byDay"`       // キーは "2006-01-02"（サーバのタイムゾーン）
+	ByCommunity []LLMUsageGroup  `json:"byCommunity"` // 複数のコミュニティが関わるシミュレーションはそれぞれに計上する
+	ByModel     []LLMUsageGroup  `json:"byModel"`
+	Budget      *LLMBudgetStatus `json:"budget,omitempty"`
+}
+
+// NewLLMUsageReport: 利用量の記録を日・コミュニティ・モデルごとに集計する
+func NewLLMUsageReport(records []*LLMUsageRecord) *LLMUsageReport {
+	var (
+		report      LLMUsageReport
+		byDay       = make(map[string]LLMUsage)
+		byCommunity = make(map[string]LLMUsage)
+		byModel     = make(map[string]LLMUsage)
+	)
+	add := func(m map[string]LLMUsage, key string, u LLMUsage) {
+		sum := m[key]
+		sum.Add(u)
+		m[key] = sum
+	}
+	for _, r := range records {
+		report.Total.Add(r.Usage)
+		add(byDay, r.CreatedAt.Local().Format(time.DateOnly), r.Usage)
+		for _, id := range r.Communities {
+			add(byCommunity, id, r.Usage)
+		}
+		for model, u := range r.ByModel {
+			add(byModel, model, u)
+		}
+	}
+	report.ByDay = usageGroups(byDay)
+	report.ByCommunity = usageGroups(byCommunity)
+	report.ByModel = usageGroups(byModel)
+	return &report
+}
+
+// キーの順に並べる
+func usageGroups(m map[string]LLMUsage) []LLMUsageGroup {
+	groups := make([]LLMUsageGroup, 0, len(m))
+	for key, u := range m {
+		groups = append(groups, LLMUsageGroup{Key: key, Usage: u})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// 予算の期間
+const (
+	LLMBudgetPeriodDay   = "day"   // 毎日 0 時（サーバのタイムゾーン）に使った量を数え直す
+	LLMBudgetPeriodTotal = "total" // これまでの合計
+)
+
+// LLMBudget: 新しい LLM の利用を断る上限（0 は上限なし）
+type LLMBudget struct {
+	CostUSD float64 `json:"costUsd"`
+	Tokens  int     `json:"tokens"`
+	Period  string  `json:"period"`
+}
+
+// Enabled: 上限が設定されているか
+func (b LLMBudget) Enabled() bool {
+	return b.CostUSD > 0 || b.Tokens > 0
+}
+
+// PeriodStart: now を含む期間の始まり（期間が無い場合はゼロ値）
+func (b LLMBudget) PeriodStart(now time.Time) time.Time {
+	if b.Period != LLMBudgetPeriodDay {
+		return time.Time{}
+	}
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+// Exceeded: spent が上限に達しているか
+func (b LLMBudget) Exceeded(spent LLMUsage) bool {
+	return (b.CostUSD > 0 && spent.CostUSD >= b.CostUSD) ||
+		(b.Tokens > 0 && spent.TotalTokens >= b.Tokens)
+}
+
+// LLMBudgetStatus: 予算と今の期間に使った量
+type LLMBudgetStatus struct {
+	LLMBudget
+	Since    *time.Time `json:"since,omitempty"` // 期間が無い場合は nil
+	Spent    LLMUsage   `json:"spent"`
+	Exceeded bool       `json:"exceeded"`
+}
+
+// LLMCallReport: 包まれたゲートウェイから、記録するラッパーへ伝える問い合わせの情報
+type LLMCallReport struct {
+	// 提供元が報告したトークン数
+	PromptTokens     int
+	CompletionTokens int
+	// フォールバックで実際に応答したゲートウェイ
+	AnsweredBy string
+	// 複数の LLM の回答のまとめ方
+	Aggregation *LLMAggregation
+}
+
+type llmCallReportKey struct{}
+
+// ContextWithLLMCallReport: 以降の問い合わせの情報を report に書き込ませる
+func ContextWithLLMCallReport(ctx context.Context, report *LLMCallReport) context.Context {
+	return context.WithValue(ctx, llmCallReportKey{}, report)
+}
+
+func llmCallReportFromContext(ctx context.Context) *LLMCallReport {
+	report, _ := ctx.Value(llmCallReportKey{}).(*LLMCallReport)
+	return report
+}
+
+// ReportLLMTokens: 提供元が報告したトークン数を、context で受け取り先が指定されていれば足す
+func ReportLLMTokens(ctx context.Context, promptTokens, completionTokens int) {
+	if report := llmCallReportFromContext(ctx); report != nil {
+		report.PromptTokens += promptTokens
+		report.CompletionTokens += completionTokens
+	}
+}
+
+// ReportLLMAnsweredBy: 実際に応答したゲートウェイを、context で受け取り先が指定されていれば伝える
+func ReportLLMAnsweredBy(ctx context.Context, gateway string) {
+	if report := llmCallReportFromContext(ctx); report != nil {
+		report.AnsweredBy = gateway
+	}
+}
+
+// ReportLLMAggregation: 複数の LLM の回答のまとめ方を、context で受け取り先が指定されていれば伝える
+func ReportLLMAggregation(ctx context.Context, aggregation *LLMAggregation) {
+	if report := llmCallReportFromContext(ctx); report != nil {
+		report.Aggregation = aggregation
+	}
+}
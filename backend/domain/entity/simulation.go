@@ -1,6 +1,17 @@
 package entity
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// シミュレーションの種類
+const (
+	SimulationTypeCultureEvolution = "culture_evolution"
+	SimulationTypeDiplomacy        = "diplomacy"
+	SimulationTypeInterference     = "interference"
+)
 
 // シミュレーションの結果を表します。
 type SimulationResult struct {
@@ -10,3 +21,102 @@ type SimulationResult struct {
 	ResultJSON  string    // シミュレーション結果のJSON文字列
 	CreatedAt   time.Time // 実行日時
 }
+
+// SimulationRecord: SimulationResult.ResultJSON の中身
+type SimulationRecord struct {
+	Outcome   json.RawMessage   `json:"outcome"`             // LLM の応答を解釈した結果
+	UserInput string            `json:"userInput,omitempty"` // 利用者が追加した指示
+	Changes   []CommunityChange `json:"changes"`             // 関連コミュニティごとの変化
+}
+
+// CommunityChange: シミュレーションによる1コミュニティの変化
+type CommunityChange struct {
+	CommunityID     string `json:"communityId"`
+	PrevCulture     string `json:"prevCulture"`
+	NewCulture      string `json:"newCulture"`
+	PrevPopulation  int    `json:"prevPopulation"`
+	NewPopulation   int    `json:"newPopulation"`
+	PopulationDelta int    `json:"populationDelta"`
+}
+
+// NewCommunityChange: 変更前後のコミュニティから変化を作る
+func NewCommunityChange(before Community, after *Community) CommunityChange {
+	return CommunityChange{
+		CommunityID:     after.ID,
+		PrevCulture:     before.Culture,
+		NewCulture:      after.Culture,
+		PrevPopulation:  before.Population,
+		NewPopulation:   after.Population,
+		PopulationDelta: after.Population - before.Population,
+	}
+}
+
+// NewSimulationResult: 結果の内容を ResultJSON にまとめたシミュレーション結果を作る
+// 関連コミュニティは changes の順になる
+func NewSimulationResult(
+	id, simulationType string,
+	outcome any,
+	userInput string,
+	changes ...CommunityChange,
+) (*SimulationResult, error) {
+	rawOutcome, ok := outcome.(json.RawMessage)
+	if !ok {
+		b, err := json.Marshal(outcome)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal simulation outcome: %w", err)
+		}
+		rawOutcome = b
+	}
+	record := SimulationRecord{
+		Outcome:   rawOutcome,
+		UserInput: userInput,
+		Changes:   changes,
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal simulation record: %w", err)
+	}
+	communities := make([]string, 0, len(changes))
+	for _, c := range changes {
+		communities = append(communities, c.CommunityID)
+	}
+	return &SimulationResult{
+		ID:          id,
+		Type:        simulationType,
+		Communities: communities,
+		ResultJSON:  string(b),
+	}, nil
+}
+
+// WithoutCommunity: 関連コミュニティと ResultJSON の変化から communityID を外したコピーを返す
+// 関連コミュニティが残らない場合は nil を返す
+// LLM の応答 (outcome) はそのまま残し、SimulationRecord の形でない ResultJSON も書き換えない
+func (s *SimulationResult) WithoutCommunity(communityID string) *SimulationResult {
+	remaining := make([]string, 0, len(s.Communities))
+	for _, id := range s.Communities {
+		if id != communityID {
+			remaining = append(remaining, id)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+	cp := *s
+	cp.Communities = remaining
+
+	var record SimulationRecord
+	if err := json.Unmarshal([]byte(s.ResultJSON), &record); err != nil || record.Changes == nil {
+		return &cp
+	}
+	changes := make([]CommunityChange, 0, len(record.Changes))
+	for _, c := range record.Changes {
+		if c.CommunityID != communityID {
+			changes = append(changes, c)
+		}
+	}
+	record.Changes = changes
+	if b, err := json.Marshal(record); err == nil {
+		cp.ResultJSON = string(b)
+	}
+	return &cp
+}
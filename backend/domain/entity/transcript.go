@@ -0,0 +1,164 @@
+package entity
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LLMExchange: LLM への1回の問い合わせとその応答
+type LLMExchange struct {
+	Seq       int       `json:"seq"`                 // シミュレーション内での通し番号（1 始まり）
+	ParentSeq int       `json:"parentSeq,omitempty"` // 他の問い合わせの内部で行われた場合はその Seq
+	Stage     string    `json:"stage,omitempty"`     // 問い合わせの段階 (LLMStage*)
+	Gateway   string    `json:"gateway"`             // 応答したゲートウェイ
+	Model     string    `json:"model,omitempty"`
+	System    string    `json:"system,omitempty"` // system メッセージ
+	Prompt    string    `json:"prompt"`           // system 以外のメッセージ
+	UserInput string    `json:"userInput,omitempty"`
+	Response  string    `json:"response"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	LatencyMs int64     `json:"latencyMs"`
+	Cached    bool      `json:"cached,omitempty"` // 問い合わせずにキャッシュから応答した
+	// 指定した生成の設定（指定が無ければ nil）
+	Sampling *LLMSampling `json:"sampling,omitempty"`
+	// フォールバックの連鎖で実際に応答したゲートウェイ
+	AnsweredBy string `json:"answeredBy,omitempty"`
+	// 複数の LLM の回答をまとめた場合の、候補と集約の方法
+	Aggregation *LLMAggregation `json:"aggregation,omitempty"`
+
+	// 提供元が報告したトークン数と、設定の料金表から求めた費用
+	PromptTokens     int     `json:"promptTokens,omitempty"`
+	CompletionTokens int     `json:"completionTokens,omitempty"`
+	CostUSD          float64 `json:"costUsd,omitempty"`
+}
+
+// 問い合わせの段階
+const (
+	LLMStageFanOut    = "fanout"    // 各サブゲートウェイへの並列問い合わせ
+	LLMStageAggregate = "aggregate" // 回答をまとめた集約プロンプトでの再問い合わせ
+	LLMStageRepair    = "repair"    // 形式に合わない応答の修正を求める問い直し
+	LLMStageJudge     = "judge"     // 候補から最も良い回答を選ばせる問い合わせ
+)
+
+// Transcript: 1回のシミュレーションで行った LLM とのやり取りの記録
+type Transcript struct {
+	SimulationID string         `json:"simulationId"`
+	Exchanges    []*LLMExchange `json:"exchanges"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// TranscriptRecorder: context を通じてゲートウェイに渡し、問い合わせを記録する
+// 複数のゴルーチンから同時に使える
+type TranscriptRecorder struct {
+	mu        sync.Mutex
+	exchanges []*LLMExchange
+}
+
+func NewTranscriptRecorder() *TranscriptRecorder {
+	return &TranscriptRecorder{}
+}
+
+// Begin: 問い合わせの記録を開始し、通し番号を振った LLMExchange を返す
+// 応答を得たら Finish を呼ぶこと
+func (r *TranscriptRecorder) Begin(e *LLMExchange) *LLMExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Seq = len(r.exchanges) + 1
+	if e.StartedAt.IsZero() {
+		e.StartedAt = time.Now()
+	}
+	r.exchanges = append(r.exchanges, e)
+	return e
+}
+
+// Finish: 応答とかかった時間を記録する
+func (r *TranscriptRecorder) Finish(e *LLMExchange, response string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Response = response
+	if err != nil {
+		e.Error = err.Error()
+	}
+	e.LatencyMs = time.Since(e.StartedAt).Milliseconds()
+}
+
+// SetReport: 包まれたゲートウェイから伝えられた情報と、トークン数から求めた費用を記録する
+func (r *TranscriptRecorder) SetReport(e *LLMExchange, report LLMCallReport, costUSD float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.PromptTokens = report.PromptTokens
+	e.CompletionTokens = report.CompletionTokens
+	e.CostUSD = costUSD
+	e.AnsweredBy = report.AnsweredBy
+	e.Aggregation = report.Aggregation
+}
+
+// Transcript: ここまでの記録をシミュレーションの記録としてまとめる
+func (r *TranscriptRecorder) Transcript(simulationID string) *Transcript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	exchanges := make([]*LLMExchange, len(r.exchanges))
+	for i, e := range r.exchanges {
+		cp := *e
+		exchanges[i] = &cp
+	}
+	return &Transcript{
+		SimulationID: simulationID,
+		Exchanges:    exchanges,
+		CreatedAt:    time.Now(),
+	}
+}
+
+type (
+	transcriptRecorderKey struct{}
+	llmParentSeqKey       struct{}
+	llmStageKey           struct{}
+	llmCacheBypassKey     struct{}
+)
+
+// ContextWithTranscriptRecorder: 以降の LLM 問い合わせを rec に記録させる
+func ContextWithTranscriptRecorder(ctx context.Context, rec *TranscriptRecorder) context.Context {
+	return context.WithValue(ctx, transcriptRecorderKey{}, rec)
+}
+
+// TranscriptRecorderFromContext: 記録先がなければ nil
+func TranscriptRecorderFromContext(ctx context.Context) *TranscriptRecorder {
+	rec, _ := ctx.Value(transcriptRecorderKey{}).(*TranscriptRecorder)
+	return rec
+}
+
+// ContextWithLLMParent: 以降の問い合わせを seq の問い合わせの内部で行ったものとして記録させる
+func ContextWithLLMParent(ctx context.Context, seq int) context.Context {
+	return context.WithValue(ctx, llmParentSeqKey{}, seq)
+}
+
+// LLMParentFromContext: 親の問い合わせがなければ 0
+func LLMParentFromContext(ctx context.Context) int {
+	seq, _ := ctx.Value(llmParentSeqKey{}).(int)
+	return seq
+}
+
+// ContextWithLLMStage: 以降の問い合わせに段階 (LLMStage*) を付けて記録させる
+func ContextWithLLMStage(ctx context.Context, stage string) context.Context {
+	return context.WithValue(ctx, llmStageKey{}, stage)
+}
+
+// LLMStageFromContext: 段階の指定がなければ空
+func LLMStageFromContext(ctx context.Context) string {
+	stage, _ := ctx.Value(llmStageKey{}).(string)
+	return stage
+}
+
+// ContextWithLLMCacheBypass: 以降の問い合わせでキャッシュを読まずに LLM へ問い合わせさせる
+// （得た応答でキャッシュは更新する）
+func ContextWithLLMCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, llmCacheBypassKey{}, true)
+}
+
+// LLMCacheBypassFromContext: キャッシュを読まないよう指定されているか
+func LLMCacheBypassFromContext(ctx context.Context) bool {
+	bypass, _ := ctx.Value(llmCacheBypassKey{}).(bool)
+	return bypass
+}
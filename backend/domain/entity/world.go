@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 現在のスナップショット形式のバージョン
+const WorldSnapshotFormatVersion = 1
+
+// スナップショットの取り込み方法
+type WorldImportMode string
+
+const (
+	WorldImportReplace WorldImportMode = "replace" // 既存の状態をすべて置き換える
+	WorldImportMerge   WorldImportMode = "merge"   // ID が同じものだけ上書きし、それ以外は残す
+)
+
+var ErrInvalidWorldSnapshot = errors.New("invalid world snapshot")
+
+// WorldSnapshot: ワールド全体（コミュニティ・エージェント・履歴）を1つにまとめた文書
+type WorldSnapshot struct {
+	FormatVersion int                 `json:"formatVersion"`
+	ExportedAt    time.Time           `json:"exportedAt"`
+	Communities   []*Community        `json:"communities"`
+	Agents        []*Agent            `json:"agents"`
+	Simulations   []*SimulationResult `json:"simulations"`
+	Revisions     []*CultureRevision  `json:"revisions"`
+}
+
+// Validate: 形式バージョンと ID の重複を検証する
+func (w *WorldSnapshot) Validate() error {
+	if w.FormatVersion != WorldSnapshotFormatVersion {
+		return fmt.Errorf("%w: unsupported format version %d (want %d)",
+			ErrInvalidWorldSnapshot, w.FormatVersion, WorldSnapshotFormatVersion)
+	}
+
+	communityIDs := make(map[string]bool, len(w.Communities))
+	for _, c := range w.Communities {
+		if c == nil || c.ID == "" {
+			return fmt.Errorf("%w: community without ID", ErrInvalidWorldSnapshot)
+		}
+		if communityIDs[c.ID] {
+			return fmt.Errorf("%w: duplicate community ID %s", ErrInvalidWorldSnapshot, c.ID)
+		}
+		communityIDs[c.ID] = true
+	}
+
+	agentIDs := make(map[string]bool, len(w.Agents))
+	for _, a := range w.Agents {
+		if a == nil || a.ID == "" {
+			return fmt.Errorf("%w: agent without ID", ErrInvalidWorldSnapshot)
+		}
+		if agentIDs[a.ID] {
+			return fmt.Errorf("%w: duplicate agent ID %s", ErrInvalidWorldSnapshot, a.ID)
+		}
+		agentIDs[a.ID] = true
+	}
+
+	simulationIDs := make(map[string]bool, len(w.Simulations))
+	for _, s := range w.Simulations {
+		if s == nil || s.ID == "" {
+			return fmt.Errorf("%w: simulation without ID", ErrInvalidWorldSnapshot)
+		}
+		if simulationIDs[s.ID] {
+			return fmt.Errorf("%w: duplicate simulation ID %s", ErrInvalidWorldSnapshot, s.ID)
+		}
+		simulationIDs[s.ID] = true
+	}
+
+	type revisionKey struct {
+		communityID string
+		revision    int
+	}
+	revisions := make(map[revisionKey]bool, len(w.Revisions))
+	for _, r := range w.Revisions {
+		if r == nil || r.CommunityID == "" || r.Revision < 1 {
+			return fmt.Errorf("%w: revision without community ID or number",
+				ErrInvalidWorldSnapshot)
+		}
+		key := revisionKey{r.CommunityID, r.Revision}
+		if revisions[key] {
+			return fmt.Errorf("%w: duplicate revision %d of community %s",
+				ErrInvalidWorldSnapshot, r.Revision, r.CommunityID)
+		}
+		revisions[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// CultureRevisionRepository: 文化の改訂履歴に関するリポジトリインタフェース(追記のみ。完全削除時を除く)
+type CultureRevisionRepository interface {
+	// Append: Revision と CreatedAt を採番して追記する
+	Append(ctx context.Context, revision *entity.CultureRevision) error
+	// GetByCommunity: 古い順に返す
+	GetByCommunity(ctx context.Context, communityID string) ([]*entity.CultureRevision, error)
+	GetByRevision(ctx context.Context, communityID string, revision int) (*entity.CultureRevision, error)
+	// DeleteByCommunity: コミュニティの改訂履歴をすべて削除する（完全削除用）
+	DeleteByCommunity(ctx context.Context, communityID string) error
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// リポジトリ実装間で共通のエラー
+var (
+	ErrCommunityNotFound   = errors.New("community not found")
+	ErrCommunityExists     = errors.New("community already exists")
+	ErrAgentNotFound       = errors.New("agent not found")
+	ErrRevisionNotFound    = errors.New("culture revision not found")
+	ErrVersionConflict     = errors.New("version conflict")
+	ErrCommunityNotInTrash = errors.New("community is not in the trash")
+	ErrSimulationNotFound  = errors.New("simulation not found")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrTranscriptNotFound  = errors.New("transcript not found")
+	ErrLLMUsageNotFound    = errors.New("llm usage not found")
+	ErrLLMOutput           = errors.New("invalid llm output")
+	ErrLLMBudgetExceeded   = errors.New("llm budget exceeded")
+)
+
+// LLM への問い合わせが失敗した理由の分類（提供元によらない）
+// LLMError を errors.Is で判定できる
+var (
+	ErrLLMRateLimited    = errors.New("llm rate limited")
+	ErrLLMUnavailable    = errors.New("llm unavailable")
+	ErrLLMInvalidRequest = errors.New("invalid llm request")
+	ErrLLMSafetyBlocked  = errors.New("llm blocked the content for safety")
+)
+
+// ConflictError: 保存しようとしたエンティティの版が保存先より古い場合のエラー
+// errors.Is(err, ErrVersionConflict) で判定できる
+type ConflictError struct {
+	Entity   string // エンティティの種類 (例: "community")
+	ID       string
+	Expected int // 呼び出し側が読み込んだ版
+	Actual   int // 保存先の現在の版（存在しない場合は 0）
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %s: version %d is stale (current version %d)",
+		e.Entity, e.ID, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// LLMOutputError: LLM の応答から期待した形式の JSON を取り出せなかった場合のエラー
+// errors.Is(err, ErrLLMOutput) で判定できる
+type LLMOutputError struct {
+	Schema   string // 期待した応答形式
+	Response string // 最後の応答
+	Attempts int    // 問い合わせた回数（修正の問い直しを含む）
+	Err      error  // 取り出し・検証に失敗した理由
+}
+
+func (e *LLMOutputError) Error() string {
+	return fmt.Sprintf("llm output does not match %s after %d attempt(s): %v",
+		e.Schema, e.Attempts, e.Err)
+}
+
+func (e *LLMOutputError) Is(target error) bool {
+	return target == ErrLLMOutput
+}
+
+func (e *LLMOutputError) Unwrap() error {
+	return e.Err
+}
+
+// LLMError: ゲートウェイが提供元のエラーを分類したもの
+// Kind には ErrLLMRateLimited などの分類（応答が使えない場合は ErrLLMOutput）を入れる
+type LLMError struct {
+	Kind       error
+	Provider   string        // 提供元 (例: "gemini")
+	RetryAfter time.Duration // 提供元が再試行までの時間を示した場合
+	Err        error
+}
+
+func (e *LLMError) Error() string {
+	return fmt.Sprintf("%s: %v: %v", e.Provider, e.Kind, e.Err)
+}
+
+func (e *LLMError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *LLMError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable: 時間をおけば成功する見込みのある失敗か
+func (e *LLMError) Retryable() bool {
+	return e.Kind == ErrLLMRateLimited || e.Kind == ErrLLMUnavailable
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// EventStore: ドメインイベントを追記専用で保存するリポジトリインタフェース
+type EventStore interface {
+	// Append: Seq を採番して順に追記する
+	Append(ctx context.Context, events ...*entity.DomainEvent) error
+	// List: afterSeq より後、untilSeq 以下のイベントを古い順に返す（untilSeq が 0 なら末尾まで）
+	List(ctx context.Context, afterSeq, untilSeq int64) ([]*entity.DomainEvent, error)
+}
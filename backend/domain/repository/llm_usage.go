@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// LLMUsageRepository: シミュレーションごとの LLM の利用量の記録
+type LLMUsageRepository interface {
+	Save(ctx context.Context, record *entity.LLMUsageRecord) error
+	// Find: 条件に合う記録を古い順に返す
+	Find(ctx context.Context, query LLMUsageQuery) ([]*entity.LLMUsageRecord, error)
+}
+
+// LLMUsageQuery: 利用量の記録の検索条件（ゼロ値の項目では絞り込まない）
+type LLMUsageQuery struct {
+	SimulationID string
+	CommunityID  string    // 関連コミュニティに含まれるもの
+	From         time.Time // この日時以降（含む）
+	To           time.Time // この日時より前（含まない）
+}
@@ -12,17 +12,41 @@ type AgentRepository interface {
 	Save(ctx context.Context, agent *entity.Agent) error
 	GetAll(ctx context.Context) ([]*entity.Agent, error)
 	GetAgentsByCommunity(ctx context.Context, communityID string) ([]*entity.Agent, error)
+	// DeleteByCommunity: コミュニティに属するエージェントをすべて削除する
+	DeleteByCommunity(ctx context.Context, communityID string) error
 }
 
 // CommunityRepository: コミュニティに関するリポジトリインタフェース(読み書き)
+// GetByID と GetAll はゴミ箱に入ったコミュニティを返さない
 type CommunityRepository interface {
 	GetByID(ctx context.Context, id string) (*entity.Community, error)
+	// Save: community.Version が保存先の版と一致する場合のみ保存し、版を 1 進める
+	// 一致しない場合は *ConflictError を返す
 	Save(ctx context.Context, community *entity.Community) error
 	GetAll(ctx context.Context) ([]*entity.Community, error)
+	GetByIDIncludingDeleted(ctx context.Context, id string) (*entity.Community, error)
+	GetAllIncludingDeleted(ctx context.Context) ([]*entity.Community, error)
+	// Delete: コミュニティを完全に削除する（ゴミ箱に入れるのは DeletedAt を設定して Save）
 	Delete(ctx context.Context, id string) error
 }
 
 // LLMGateway: LLMに問い合わせるためのインタフェース
 type LLMGateway interface {
+	// Generate: メッセージ・生成の設定・応答の形式をまとめた問い合わせで生成する
+	// context に断片の受け取り先 (entity.ContextWithLLMStream) があれば、生成しながら断片を渡し、
+	// 生成を始めるたびに Reset の断片を渡す。戻り値は断片をつなげた応答全体
+	Generate(ctx context.Context, req *entity.LLMRequest) (string, error)
+	// GenerateCultureUpdate: プロンプトとユーザー入力だけで問い合わせる（以前の呼び出し方の互換用）
+	// entity.NewLLMRequest で作った問い合わせで Generate を呼ぶ
 	GenerateCultureUpdate(ctx context.Context, prompt, userInput string) (string, error)
 }
+
+// LLMStatsReporter: 流量制限の状況を報告できる LLM ゲートウェイ
+type LLMStatsReporter interface {
+	LimiterStats() entity.LLMLimiterStats
+}
+
+// LLMBreakerReporter: サーキットブレーカーの状況を報告できる LLM ゲートウェイ
+type LLMBreakerReporter interface {
+	BreakerStats() entity.LLMBreakerStats
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/rayfiyo/zousui/backend/domain/entity"
 )
@@ -9,4 +10,26 @@ import (
 type SimulationRepository interface {
 	Save(ctx context.Context, result *entity.SimulationResult) error
 	GetAll(ctx context.Context) ([]*entity.SimulationResult, error)
+	GetByID(ctx context.Context, id string) (*entity.SimulationResult, error)
+	// Find: 条件に合う結果を新しい順に Limit 件まで返す
+	Find(ctx context.Context, query SimulationQuery) (*SimulationPage, error)
+	// RemoveCommunity: 各結果の関連コミュニティと変化 (ResultJSON の changes) から communityID を外し、
+	// 関連コミュニティがなくなった結果は削除する。削除した結果の ID を返す
+	RemoveCommunity(ctx context.Context, communityID string) ([]string, error)
+}
+
+// SimulationQuery: シミュレーション履歴の検索条件（ゼロ値の項目では絞り込まない）
+type SimulationQuery struct {
+	CommunityID string    // 関連コミュニティに含まれるもの
+	Type        string    // entity.SimulationType*
+	From        time.Time // この日時以降（含む）
+	To          time.Time // この日時より前（含まない）
+	Cursor      string    // 前のページの NextCursor。続きから返す
+	Limit       int       // 1 以上
+}
+
+// SimulationPage: 検索結果の1ページ
+type SimulationPage struct {
+	Simulations []*entity.SimulationResult `json:"simulations"`
+	NextCursor  string                     `json:"nextCursor,omitempty"` // 続きがなければ空
 }
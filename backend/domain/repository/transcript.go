@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// TranscriptRepository: シミュレーションごとの LLM とのやり取りの記録
+type TranscriptRepository interface {
+	Save(ctx context.Context, transcript *entity.Transcript) error
+	GetBySimulation(ctx context.Context, simulationID string) (*entity.Transcript, error)
+	// DeleteBySimulations: 削除したシミュレーションの記録を削除する
+	DeleteBySimulations(ctx context.Context, simulationIDs []string) error
+}
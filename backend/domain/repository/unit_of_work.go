@@ -0,0 +1,21 @@
+package repository
+
+import "context"
+
+// TxRepositories: 1つのトランザクション内で使うリポジトリの組
+type TxRepositories struct {
+	Communities CommunityRepository
+	Agents      AgentRepository
+	Simulations SimulationRepository
+	Revisions   CultureRevisionRepository
+	Events      EventStore
+	Transcripts TranscriptRepository
+	World       WorldRepository
+}
+
+// UnitOfWork: 複数リポジトリへの書き込みをまとめて確定するためのインタフェース
+type UnitOfWork interface {
+	// Do: fn 内で repos に対して行った書き込みを、fn が nil を返したときだけすべて確定する
+	// fn がエラーを返した場合や確定に失敗した場合は、どの書き込みも反映しない
+	Do(ctx context.Context, fn func(ctx context.Context, repos TxRepositories) error) error
+}
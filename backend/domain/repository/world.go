@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// WorldRepository: ワールド全体をまとめて読み書きするリポジトリインタフェース
+type WorldRepository interface {
+	Export(ctx context.Context) (*entity.WorldSnapshot, error)
+	// Import: スナップショットを一括で取り込む（途中で失敗した場合は何も変更しない）
+	Import(ctx context.Context, snapshot *entity.WorldSnapshot, mode entity.WorldImportMode) error
+}
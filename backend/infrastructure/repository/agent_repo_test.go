@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+func agentIDs(agents []*entity.Agent) []string {
+	ids := make([]string, len(agents))
+	for i, a := range agents {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+// エージェントは登録順に返し、同じ ID での保存は順番を変えずに更新する
+func TestAgentRepoCRUD(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for _, a := range []*entity.Agent{
+			{ID: "a2", Name: "長老", CommunityID: "c1", Personality: "慎重"},
+			{ID: "a1", Name: "狩人", CommunityID: "c2"},
+			{ID: "a3", Name: "漁師", CommunityID: "c1"},
+			{ID: "a2", Name: "長老", CommunityID: "c1", Personality: "大胆"},
+		} {
+			if err := s.agents.Save(ctx, a); err != nil {
+				t.Fatalf("failed to save %s: %v", a.ID, err)
+			}
+		}
+
+		got, err := s.agents.GetByID(ctx, "a2")
+		if err != nil {
+			t.Fatalf("failed to get agent: %v", err)
+		}
+		if got.Name != "長老" || got.CommunityID != "c1" || got.Personality != "大胆" {
+			t.Errorf("agent = %+v, want the updated personality", got)
+		}
+		if _, err := s.agents.GetByID(ctx, "missing"); !errors.Is(
+			err, domainrepo.ErrAgentNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrAgentNotFound)
+		}
+
+		all, err := s.agents.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("failed to get agents: %v", err)
+		}
+		if ids := agentIDs(all); len(ids) != 3 || ids[0] != "a2" || ids[1] != "a1" ||
+			ids[2] != "a3" {
+			t.Errorf("agents = %v, want [a2 a1 a3]", ids)
+		}
+		members, err := s.agents.GetAgentsByCommunity(ctx, "c1")
+		if err != nil {
+			t.Fatalf("failed to get agents by community: %v", err)
+		}
+		if ids := agentIDs(members); len(ids) != 2 || ids[0] != "a2" || ids[1] != "a3" {
+			t.Errorf("agents of c1 = %v, want [a2 a3]", ids)
+		}
+
+		if err := s.agents.DeleteByCommunity(ctx, "c1"); err != nil {
+			t.Fatalf("failed to delete agents: %v", err)
+		}
+		if members, _ := s.agents.GetAgentsByCommunity(ctx, "c1"); len(members) != 0 {
+			t.Errorf("agents of c1 = %v after delete, want none", agentIDs(members))
+		}
+		if all, _ := s.agents.GetAll(ctx); len(all) != 1 || all[0].ID != "a1" {
+			t.Errorf("agents = %v, want only a1", agentIDs(all))
+		}
+	})
+}
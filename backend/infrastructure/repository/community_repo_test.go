@@ -0,0 +1,233 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// 保存したコミュニティを読み戻せ、更新・一覧・完全削除ができる
+func TestCommunityRepoCRUD(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		updatedAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		for _, c := range []*entity.Community{
+			{ID: "c2", Name: "山の民", Population: 50, Culture: "狩猟"},
+			{ID: "c1", Name: "川の民", Description: "川沿いの村", Population: 100,
+				Culture: "漁業", UpdatedAt: updatedAt},
+		} {
+			if err := s.communities.Save(ctx, c); err != nil {
+				t.Fatalf("failed to save %s: %v", c.ID, err)
+			}
+			if c.Version != 1 {
+				t.Errorf("%s: version = %d after the first save, want 1", c.ID, c.Version)
+			}
+		}
+
+		got, err := s.communities.GetByID(ctx, "c1")
+		if err != nil {
+			t.Fatalf("failed to get community: %v", err)
+		}
+		if got.Name != "川の民" || got.Description != "川沿いの村" || got.Population != 100 ||
+			got.Culture != "漁業" || !got.UpdatedAt.Equal(updatedAt) || got.Version != 1 ||
+			got.DeletedAt != nil {
+			t.Errorf("community = %+v", got)
+		}
+
+		// 取得したコミュニティを書き換えても、保存するまでは反映されない
+		got.Culture = "祭り"
+		if again, _ := s.communities.GetByID(ctx, "c1"); again.Culture != "漁業" {
+			t.Errorf("unsaved change leaked: culture = %s", again.Culture)
+		}
+		if err := s.communities.Save(ctx, got); err != nil {
+			t.Fatalf("failed to update community: %v", err)
+		}
+		if again, _ := s.communities.GetByID(ctx, "c1"); again.Culture != "祭り" ||
+			again.Version != 2 {
+			t.Errorf("updated community = %+v, want culture 祭り at version 2", again)
+		}
+
+		all, err := s.communities.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("failed to get communities: %v", err)
+		}
+		if len(all) != 2 || all[0].ID != "c1" || all[1].ID != "c2" {
+			t.Errorf("communities = %+v, want c1 and c2 in ID order", all)
+		}
+
+		if err := s.communities.Delete(ctx, "c2"); err != nil {
+			t.Fatalf("failed to delete community: %v", err)
+		}
+		if _, err := s.communities.GetByID(ctx, "c2"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+		if err := s.communities.Delete(ctx, "c2"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("error deleting twice = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+		if all, _ := s.communities.GetAll(ctx); len(all) != 1 {
+			t.Errorf("communities = %+v, want only c1", all)
+		}
+	})
+}
+
+// 版が保存先と一致しない保存は、何も書き換えずに競合エラーにする
+func TestCommunityRepoVersionConflict(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		if err := s.communities.Save(ctx, &entity.Community{
+			ID: "c1", Name: "川の民", Culture: "漁業",
+		}); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+		first, _ := s.communities.GetByID(ctx, "c1")
+		second, _ := s.communities.GetByID(ctx, "c1")
+		first.Culture = "祭り"
+		if err := s.communities.Save(ctx, first); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+		second.Culture = "交易"
+
+		for _, tt := range []struct {
+			name      string
+			community *entity.Community
+			expected  int
+			actual    int
+		}{
+			{name: "stale read", community: second, expected: 1, actual: 2},
+			{name: "create over existing",
+				community: &entity.Community{ID: "c1", Culture: "交易"}, expected: 0, actual: 2},
+			{name: "update of missing",
+				community: &entity.Community{ID: "c2", Culture: "交易", Version: 1},
+				expected:  1, actual: 0},
+		} {
+			err := s.communities.Save(ctx, tt.community)
+			var conflict *domainrepo.ConflictError
+			if !errors.Is(err, domainrepo.ErrVersionConflict) || !errors.As(err, &conflict) ||
+				conflict.Entity != "community" || conflict.ID != tt.community.ID ||
+				conflict.Expected != tt.expected || conflict.Actual != tt.actual {
+				t.Errorf("%s: error = %v, want a conflict expecting %d with %d stored",
+					tt.name, err, tt.expected, tt.actual)
+			}
+			if tt.community.Version != tt.expected {
+				t.Errorf("%s: caller's version = %d, want it unchanged",
+					tt.name, tt.community.Version)
+			}
+		}
+
+		if got, _ := s.communities.GetByID(ctx, "c1"); got.Culture != "祭り" || got.Version != 2 {
+			t.Errorf("community = %+v, want the first writer's culture at version 2", got)
+		}
+		if _, err := s.communities.GetByID(ctx, "c2"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+	})
+}
+
+// トランザクション内でも版を確かめ、同じコミュニティを続けて保存すると版が続けて進む
+func TestCommunityRepoVersionInUnitOfWork(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		if err := s.communities.Save(ctx, &entity.Community{
+			ID: "c1", Culture: "漁業",
+		}); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+		stale, _ := s.communities.GetByID(ctx, "c1")
+		fresh, _ := s.communities.GetByID(ctx, "c1")
+		if err := s.communities.Save(ctx, fresh); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+
+		err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			if err := repos.Agents.Save(ctx, &entity.Agent{
+				ID: "a1", CommunityID: "c1",
+			}); err != nil {
+				return err
+			}
+			stale.Culture = "交易"
+			return repos.Communities.Save(ctx, stale)
+		})
+		if !errors.Is(err, domainrepo.ErrVersionConflict) {
+			t.Fatalf("error = %v, want %v", err, domainrepo.ErrVersionConflict)
+		}
+		if _, err := s.agents.GetByID(ctx, "a1"); !errors.Is(err, domainrepo.ErrAgentNotFound) {
+			t.Errorf("agent saved with a conflicting community: %v", err)
+		}
+
+		if err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			c, err := repos.Communities.GetByID(ctx, "c1")
+			if err != nil {
+				return err
+			}
+			for _, culture := range []string{"祭り", "交易"} {
+				c.Culture = culture
+				if err := repos.Communities.Save(ctx, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		if got, _ := s.communities.GetByID(ctx, "c1"); got.Culture != "交易" || got.Version != 4 {
+			t.Errorf("community = %+v, want culture 交易 at version 4", got)
+		}
+	})
+}
+
+// ゴミ箱に入れたコミュニティは通常の取得から外れ、IncludingDeleted でだけ読める
+func TestCommunityRepoTrash(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for _, id := range []string{"c1", "c2"} {
+			if err := s.communities.Save(ctx, &entity.Community{ID: id}); err != nil {
+				t.Fatalf("failed to save %s: %v", id, err)
+			}
+		}
+		deletedAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		c, _ := s.communities.GetByID(ctx, "c1")
+		c.MarkDeleted(deletedAt)
+		if err := s.communities.Save(ctx, c); err != nil {
+			t.Fatalf("failed to trash community: %v", err)
+		}
+
+		if _, err := s.communities.GetByID(ctx, "c1"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+		got, err := s.communities.GetByIDIncludingDeleted(ctx, "c1")
+		if err != nil {
+			t.Fatalf("failed to get trashed community: %v", err)
+		}
+		if !got.IsDeleted() || !got.DeletedAt.Equal(deletedAt) || got.Version != 2 {
+			t.Errorf("trashed community = %+v, want deleted at %v", got, deletedAt)
+		}
+		if all, _ := s.communities.GetAll(ctx); len(all) != 1 || all[0].ID != "c2" {
+			t.Errorf("communities = %+v, want only c2", all)
+		}
+		if all, _ := s.communities.GetAllIncludingDeleted(ctx); len(all) != 2 ||
+			!all[0].IsDeleted() || all[1].IsDeleted() {
+			t.Errorf("communities including deleted = %+v, want trashed c1 and c2", all)
+		}
+		if _, err := s.communities.GetByIDIncludingDeleted(ctx, "missing"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+
+		got.Restore(deletedAt.Add(time.Hour))
+		if err := s.communities.Save(ctx, got); err != nil {
+			t.Fatalf("failed to restore community: %v", err)
+		}
+		if restored, err := s.communities.GetByID(ctx, "c1"); err != nil ||
+			restored.DeletedAt != nil || restored.Version != 3 {
+			t.Errorf("restored community = %+v, %v", restored, err)
+		}
+	})
+}
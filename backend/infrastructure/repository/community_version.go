@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// トランザクション内の保存で版を進めたコミュニティ
+// 同じトランザクションのイベントなどは進めた後の版を使うので、保存の時点で呼び出し側の版を進め、
+// 確定しなかった（ロールバック・競合）場合に元に戻す
+type stagedVersions struct {
+	mu      sync.Mutex
+	entries []stagedVersion
+}
+
+type stagedVersion struct {
+	community *entity.Community
+	prev      int
+}
+
+// bump: 呼び出し側の版を進める（トランザクションの外 (nil) ならそのまま進める）
+func (s *stagedVersions) bump(c *entity.Community) {
+	if s == nil {
+		c.Version++
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, stagedVersion{community: c, prev: c.Version})
+	c.Version++
+}
+
+// restore: 進めた版を保存前の版に戻す（同じコミュニティを複数回保存した場合は最初の版になる）
+func (s *stagedVersions) restore() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		s.entries[i].community.Version = s.entries[i].prev
+	}
+	s.entries = nil
+}
@@ -0,0 +1,131 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// 改訂番号はコミュニティごとに 1 から振り、古い順に返す
+func TestCultureRevisionRepoAppend(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for i, communityID := range []string{"c1", "c2", "c1"} {
+			rev := &entity.CultureRevision{
+				CommunityID: communityID, PrevCulture: fmt.Sprintf("文化%d", i),
+				NewCulture: fmt.Sprintf("文化%d", i+1), PrevPopulation: 100,
+				PopulationDelta: i, SimulationID: fmt.Sprintf("s%d", i),
+				SimulationType: entity.SimulationTypeCultureEvolution,
+			}
+			if err := s.revisions.Append(ctx, rev); err != nil {
+				t.Fatalf("failed to append revision: %v", err)
+			}
+			if rev.CreatedAt.IsZero() {
+				t.Errorf("revision %d has no creation time", i)
+			}
+		}
+
+		revs, err := s.revisions.GetByCommunity(ctx, "c1")
+		if err != nil {
+			t.Fatalf("failed to get revisions: %v", err)
+		}
+		if len(revs) != 2 || revs[0].Revision != 1 || revs[1].Revision != 2 ||
+			revs[0].NewCulture != "文化1" || revs[1].NewCulture != "文化3" {
+			t.Fatalf("revisions of c1 = %+v, want 文化1 and 文化3 as 1 and 2", revs)
+		}
+		got, err := s.revisions.GetByRevision(ctx, "c1", 2)
+		if err != nil {
+			t.Fatalf("failed to get revision: %v", err)
+		}
+		want := revs[1]
+		if got.PrevCulture != "文化2" || got.PrevPopulation != 100 || got.PopulationDelta != 2 ||
+			got.SimulationID != "s2" || got.SimulationType != want.SimulationType ||
+			!got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("revision = %+v, want %+v", got, want)
+		}
+		if c2, _ := s.revisions.GetByCommunity(ctx, "c2"); len(c2) != 1 || c2[0].Revision != 1 {
+			t.Errorf("revisions of c2 = %+v, want one numbered 1", c2)
+		}
+		for _, revision := range []int{0, 3} {
+			if _, err := s.revisions.GetByRevision(ctx, "c1", revision); !errors.Is(
+				err, domainrepo.ErrRevisionNotFound) {
+				t.Errorf("revision %d: error = %v, want %v",
+					revision, err, domainrepo.ErrRevisionNotFound)
+			}
+		}
+	})
+}
+
+// 同時に追記しても改訂番号は重複しない
+func TestCultureRevisionRepoConcurrentAppend(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		const n = 10
+		var wg sync.WaitGroup
+		errs := make([]error, n)
+		for i := range n {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.revisions.Append(ctx, &entity.CultureRevision{
+					CommunityID: "c1", NewCulture: fmt.Sprintf("文化%d", i),
+				})
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("failed to append revision: %v", err)
+			}
+		}
+
+		revs, err := s.revisions.GetByCommunity(ctx, "c1")
+		if err != nil {
+			t.Fatalf("failed to get revisions: %v", err)
+		}
+		if len(revs) != n {
+			t.Fatalf("got %d revisions, want %d", len(revs), n)
+		}
+		for i, rev := range revs {
+			if rev.Revision != i+1 {
+				t.Errorf("revision %d numbered %d", i, rev.Revision)
+			}
+		}
+	})
+}
+
+// 完全削除では対象のコミュニティの履歴だけを消し、番号は 1 から振り直す
+func TestCultureRevisionRepoDeleteByCommunity(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for _, communityID := range []string{"c1", "c1", "c2"} {
+			if err := s.revisions.Append(ctx, &entity.CultureRevision{
+				CommunityID: communityID,
+			}); err != nil {
+				t.Fatalf("failed to append revision: %v", err)
+			}
+		}
+		if err := s.revisions.DeleteByCommunity(ctx, "c1"); err != nil {
+			t.Fatalf("failed to delete revisions: %v", err)
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c1"); len(revs) != 0 {
+			t.Errorf("revisions of c1 = %+v, want none", revs)
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c2"); len(revs) != 1 {
+			t.Errorf("revisions of c2 = %+v, want one", revs)
+		}
+
+		rev := &entity.CultureRevision{CommunityID: "c1"}
+		if err := s.revisions.Append(ctx, rev); err != nil {
+			t.Fatalf("failed to append revision: %v", err)
+		}
+		if rev.Revision != 1 {
+			t.Errorf("revision = %d after delete, want 1", rev.Revision)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package repository_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+func newCultureChanged(t *testing.T, communityID, newCulture string) *entity.DomainEvent {
+	t.Helper()
+	e, err := entity.NewDomainEvent(entity.EventCultureChanged, communityID, "s1",
+		entity.CultureChangedPayload{NewCulture: newCulture, Version: 2})
+	if err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	return e
+}
+
+func eventSeqs(events []*entity.DomainEvent) []int64 {
+	seqs := make([]int64, len(events))
+	for i, e := range events {
+		seqs[i] = e.Seq
+	}
+	return seqs
+}
+
+// 通し番号を振って追記し、範囲を指定して古い順に読み出せる
+func TestEventStoreAppendAndList(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		occurredAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		first := newCultureChanged(t, "c1", "祭り")
+		first.OccurredAt = occurredAt
+		unset := &entity.DomainEvent{Type: entity.EventCommunityPurged, AggregateID: "c2",
+			Payload: []byte(`{}`)}
+		if err := s.events.Append(ctx, first, unset); err != nil {
+			t.Fatalf("failed to append events: %v", err)
+		}
+		if err := s.events.Append(ctx, newCultureChanged(t, "c1", "交易")); err != nil {
+			t.Fatalf("failed to append event: %v", err)
+		}
+		if first.Seq != 1 || unset.Seq != 2 || unset.OccurredAt.IsZero() {
+			t.Errorf("appended = %+v, %+v; want seq 1, 2 with a time", first, unset)
+		}
+
+		all, err := s.events.List(ctx, 0, 0)
+		if err != nil {
+			t.Fatalf("failed to list events: %v", err)
+		}
+		if len(all) != 3 {
+			t.Fatalf("events = %v, want 3", eventSeqs(all))
+		}
+		got := all[0]
+		var payload entity.CultureChangedPayload
+		if err := got.DecodePayload(&payload); err != nil {
+			t.Fatalf("failed to decode payload: %v", err)
+		}
+		if got.Type != entity.EventCultureChanged || got.AggregateID != "c1" ||
+			got.SimulationID != "s1" || !got.OccurredAt.Equal(occurredAt) ||
+			payload.NewCulture != "祭り" || payload.Version != 2 {
+			t.Errorf("event = %+v (payload %+v)", got, payload)
+		}
+
+		for _, tt := range []struct {
+			after, until int64
+			want         []int64
+		}{
+			{after: 1, want: []int64{2, 3}},
+			{after: 0, until: 2, want: []int64{1, 2}},
+			{after: 1, until: 2, want: []int64{2}},
+			{after: 3, want: []int64{}},
+		} {
+			events, err := s.events.List(ctx, tt.after, tt.until)
+			if err != nil {
+				t.Fatalf("failed to list events: %v", err)
+			}
+			if seqs := eventSeqs(events); !slices.Equal(seqs, tt.want) {
+				t.Errorf("List(%d, %d) = %v, want %v", tt.after, tt.until, seqs, tt.want)
+			}
+		}
+	})
+}
+
+// トランザクション内で追記したイベントは、確定した時点で続きの通し番号になる
+func TestEventStoreAppendInUnitOfWork(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		if err := s.events.Append(ctx, newCultureChanged(t, "c1", "祭り")); err != nil {
+			t.Fatalf("failed to append event: %v", err)
+		}
+		staged := []*entity.DomainEvent{
+			newCultureChanged(t, "c1", "交易"), newCultureChanged(t, "c2", "農耕"),
+		}
+		if err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			return repos.Events.Append(ctx, staged...)
+		}); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		if seqs := eventSeqs(staged); !slices.Equal(seqs, []int64{2, 3}) {
+			t.Errorf("seqs = %v, want [2 3]", seqs)
+		}
+		if all, _ := s.events.List(ctx, 0, 0); len(all) != 3 || all[2].AggregateID != "c2" {
+			t.Errorf("events = %+v, want 3 ending with c2", all)
+		}
+	})
+}
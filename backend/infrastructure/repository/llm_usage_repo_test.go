@@ -0,0 +1,90 @@
+package repository_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+func usageIDs(records []*entity.LLMUsageRecord) []string {
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// 利用量の記録を読み戻せ、条件で絞り込んで古い順に返す
+func TestLLMUsageRepoFind(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		usage := entity.LLMUsage{Calls: 2, PromptTokens: 100, CompletionTokens: 50,
+			TotalTokens: 150, CostUSD: 0.25}
+		records := []*entity.LLMUsageRecord{
+			{ID: "u1", SimulationID: "s1", SimulationType: entity.SimulationTypeDiplomacy,
+				Communities: []string{"c1", "c2"}, Usage: usage,
+				ByModel: map[string]entity.LLMUsage{"gemini/flash": usage}},
+			{ID: "u2", SimulationID: "s2", Communities: []string{"c2"}},
+			{ID: "u3", SimulationID: "s1", Communities: []string{"c1"}},
+			{SimulationID: "s3", Communities: []string{"c1"}},
+		}
+		for _, r := range records {
+			if err := s.usage.Save(ctx, r); err != nil {
+				t.Fatalf("failed to save usage: %v", err)
+			}
+			if r.ID == "" || r.CreatedAt.IsZero() {
+				t.Errorf("saved record = %+v, want an ID and a creation time", r)
+			}
+			// 期間の条件を確かめるため、作成日時が重ならないようにする
+			time.Sleep(time.Millisecond)
+		}
+
+		all, err := s.usage.Find(ctx, domainrepo.LLMUsageQuery{SimulationID: "s1"})
+		if err != nil {
+			t.Fatalf("failed to find usage: %v", err)
+		}
+		if len(all) != 2 {
+			t.Fatalf("records of s1 = %v, want u1 and u3", usageIDs(all))
+		}
+		got := all[0]
+		if got.ID != "u1" || got.SimulationType != entity.SimulationTypeDiplomacy ||
+			!slices.Equal(got.Communities, []string{"c1", "c2"}) || got.Usage != usage ||
+			len(got.ByModel) != 1 || got.ByModel["gemini/flash"] != usage ||
+			!got.CreatedAt.Equal(records[0].CreatedAt) {
+			t.Errorf("record = %+v, want %+v", got, records[0])
+		}
+
+		tests := []struct {
+			name  string
+			query domainrepo.LLMUsageQuery
+			want  []string
+		}{
+			{name: "all", want: []string{"u1", "u2", "u3", records[3].ID}},
+			{name: "simulation", query: domainrepo.LLMUsageQuery{SimulationID: "s2"},
+				want: []string{"u2"}},
+			{name: "community", query: domainrepo.LLMUsageQuery{CommunityID: "c1"},
+				want: []string{"u1", "u3", records[3].ID}},
+			{name: "simulation and community",
+				query: domainrepo.LLMUsageQuery{SimulationID: "s1", CommunityID: "c2"},
+				want:  []string{"u1"}},
+			{name: "time range includes from and excludes to", query: domainrepo.LLMUsageQuery{
+				From: records[1].CreatedAt, To: records[3].CreatedAt},
+				want: []string{"u2", "u3"}},
+			{name: "no match", query: domainrepo.LLMUsageQuery{SimulationID: "missing"},
+				want: []string{}},
+		}
+		for _, tt := range tests {
+			found, err := s.usage.Find(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("%s: failed to find usage: %v", tt.name, err)
+			}
+			if ids := usageIDs(found); !slices.Equal(ids, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+			}
+		}
+	})
+}
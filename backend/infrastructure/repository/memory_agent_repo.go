@@ -2,7 +2,7 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"sync"
 
 	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
@@ -10,6 +10,7 @@ import (
 )
 
 type MemoryAgentRepo struct {
+	mu     sync.RWMutex
 	Agents []*entity.Agent
 }
 
@@ -26,6 +27,8 @@ func (m *MemoryAgentRepo) GetByID(
 ) (*entity.Agent, error) {
 	logger := zap.L()
 	logger.Debug("GetByID called", zap.String("agentID", id))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, a := range m.Agents {
 		if a.ID == id {
 			return a, nil
@@ -33,7 +36,7 @@ func (m *MemoryAgentRepo) GetByID(
 	}
 
 	logger.Warn("Agent not found", zap.String("agentID", id))
-	return nil, errors.New("agent not found")
+	return nil, repository.ErrAgentNotFound
 }
 
 // エージェントを保存する（既存なら更新、新規なら追加）
@@ -41,6 +44,15 @@ func (m *MemoryAgentRepo) Save(
 	ctx context.Context, agent *entity.Agent,
 ) error {
 	zap.L().Debug("Saving agent", zap.String("agentID", agent.ID))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, a := range m.Agents {
+		if a.ID == agent.ID {
+			m.Agents[i] = agent
+			zap.L().Info("Agent updated", zap.String("agentID", agent.ID))
+			return nil
+		}
+	}
 	m.Agents = append(m.Agents, agent)
 	zap.L().Info("Agent saved", zap.String("agentID", agent.ID))
 	return nil
@@ -53,6 +65,8 @@ func (m *MemoryAgentRepo) GetAgentsByCommunity(
 ) ([]*entity.Agent, error) {
 	logger := zap.L()
 	logger.Debug("GetAgentsByCommunity called", zap.String("communityID", communityID))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
 	// シンプルにフィルタ
 	var result []*entity.Agent
@@ -71,7 +85,36 @@ func (m *MemoryAgentRepo) GetAll(
 	ctx context.Context,
 ) ([]*entity.Agent, error) {
 	zap.L().Debug("GetAll agents called")
-	return m.Agents, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*entity.Agent, len(m.Agents))
+	copy(result, m.Agents)
+	return result, nil
+}
+
+// コミュニティに属するエージェントをすべて削除する
+func (m *MemoryAgentRepo) DeleteByCommunity(
+	ctx context.Context,
+	communityID string,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.Agents)
+	m.Agents = removeAgentsOf(m.Agents, communityID)
+	zap.L().Info("Agents deleted",
+		zap.String("communityID", communityID), zap.Int("count", before-len(m.Agents)))
+	return nil
+}
+
+// communityID に属さないエージェントだけを残した新しいスライスを返す
+func removeAgentsOf(agents []*entity.Agent, communityID string) []*entity.Agent {
+	result := make([]*entity.Agent, 0, len(agents))
+	for _, a := range agents {
+		if a.CommunityID != communityID {
+			result = append(result, a)
+		}
+	}
+	return result
 }
 
 var _ repository.AgentRepository = (*MemoryAgentRepo)(nil)
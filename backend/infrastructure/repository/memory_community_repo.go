@@ -2,7 +2,7 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"sync"
 
 	"github.com/rayfiyo/zousui/backend/domain/entity"
@@ -22,10 +22,27 @@ func NewMemoryCommunityRepo() *MemoryCommunityRepo {
 	}
 }
 
-// IDでコミュニティを取得
+// IDでコミュニティを取得（呼び出し側の変更が保存前に漏れないようコピーを返す）
+// ゴミ箱に入ったコミュニティは見つからない扱い
 func (m *MemoryCommunityRepo) GetByID(
 	ctx context.Context,
 	id string,
+) (*entity.Community, error) {
+	c, err := m.GetByIDIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsDeleted() {
+		zap.L().Debug("Community is in the trash", zap.String("communityID", id))
+		return nil, repository.ErrCommunityNotFound
+	}
+	return c, nil
+}
+
+// ゴミ箱に入ったものも含めてIDでコミュニティを取得
+func (m *MemoryCommunityRepo) GetByIDIncludingDeleted(
+	ctx context.Context,
+	id string,
 ) (*entity.Community, error) {
 	logger := zap.L()
 	logger.Debug("GetByID called", zap.String("communityID", id))
@@ -35,43 +52,90 @@ func (m *MemoryCommunityRepo) GetByID(
 	c, ok := m.communities[id]
 	if !ok {
 		logger.Warn("Community not found", zap.String("communityID", id))
-		return nil, errors.New("community not found")
+		return nil, repository.ErrCommunityNotFound
 	}
 	logger.Debug("Community found", zap.String("communityID", id))
-	return c, nil
+	return copyCommunity(c), nil
 }
 
-// コミュニティを保存
+// コミュニティを保存（読み込んだ後に他で更新されていれば競合エラー）
 func (m *MemoryCommunityRepo) Save(
 	ctx context.Context,
 	c *entity.Community,
 ) error {
 	logger := zap.L()
-	logger.Debug("Saving community", zap.String("communityID", c.ID))
+	logger.Debug("Saving community",
+		zap.String("communityID", c.ID), zap.Int("version", c.Version))
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.communities[c.ID] = c
-	logger.Info("Community saved", zap.String("communityID", c.ID))
+	if err := m.checkVersion(c.ID, c.Version); err != nil {
+		logger.Warn("Community version conflict", zap.Error(err))
+		return err
+	}
+	c.Version++
+	m.communities[c.ID] = copyCommunity(c)
+	logger.Info("Community saved",
+		zap.String("communityID", c.ID), zap.Int("version", c.Version))
+	return nil
+}
+
+// 保存先の現在の版（存在しなければ 0）
+func (m *MemoryCommunityRepo) version(id string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if c, ok := m.communities[id]; ok {
+		return c.Version
+	}
+	return 0
+}
+
+// 保存先の版が expected と一致するか確認する（呼び出し側でロックを取ること）
+func (m *MemoryCommunityRepo) checkVersion(id string, expected int) error {
+	actual := 0
+	if stored, ok := m.communities[id]; ok {
+		actual = stored.Version
+	}
+	if actual != expected {
+		return &repository.ConflictError{
+			Entity: "community", ID: id, Expected: expected, Actual: actual,
+		}
+	}
 	return nil
 }
 
-// 全コミュニティをリストとして取得
+// 全コミュニティをリストとして取得（ゴミ箱に入ったものは除く）
 func (m *MemoryCommunityRepo) GetAll(
 	ctx context.Context,
 ) ([]*entity.Community, error) {
-	logger := zap.L()
-	logger.Debug("GetAll communities called")
+	zap.L().Debug("GetAll communities called")
+	return m.list(false), nil
+}
+
+// ゴミ箱に入ったものも含めて全コミュニティを取得
+func (m *MemoryCommunityRepo) GetAllIncludingDeleted(
+	ctx context.Context,
+) ([]*entity.Community, error) {
+	zap.L().Debug("GetAllIncludingDeleted communities called")
+	return m.list(true), nil
+}
+
+func (m *MemoryCommunityRepo) list(includeDeleted bool) []*entity.Community {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	result := make([]*entity.Community, 0, len(m.communities))
 	for _, comm := range m.communities {
-		result = append(result, comm)
+		if comm.IsDeleted() && !includeDeleted {
+			continue
+		}
+		result = append(result, copyCommunity(comm))
 	}
-	logger.Info("Retrieved all communities", zap.Int("count", len(result)))
-	return result, nil
+	// 実装間で順序を揃えるため ID 順に並べる
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	zap.L().Info("Retrieved all communities", zap.Int("count", len(result)))
+	return result
 }
 
-// コミュニティを削除
+// コミュニティを完全に削除
 func (m *MemoryCommunityRepo) Delete(
 	ctx context.Context,
 	id string,
@@ -82,12 +146,22 @@ func (m *MemoryCommunityRepo) Delete(
 	defer m.mu.Unlock()
 	if _, ok := m.communities[id]; !ok {
 		logger.Warn("Community to delete not found", zap.String("communityID", id))
-		return errors.New("community not found")
+		return repository.ErrCommunityNotFound
 	}
 	delete(m.communities, id)
 	logger.Info("Community deleted", zap.String("communityID", id))
 	return nil
 }
 
+// DeletedAt まで含めたコピーを作る
+func copyCommunity(c *entity.Community) *entity.Community {
+	cp := *c
+	if c.DeletedAt != nil {
+		deletedAt := *c.DeletedAt
+		cp.DeletedAt = &deletedAt
+	}
+	return &cp
+}
+
 // インタフェース実装をチェック
 var _ repository.CommunityRepository = (*MemoryCommunityRepo)(nil)
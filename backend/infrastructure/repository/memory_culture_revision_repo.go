@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type MemoryCultureRevisionRepo struct {
+	mu        sync.RWMutex
+	revisions map[string][]*entity.CultureRevision
+}
+
+func NewMemoryCultureRevisionRepo() *MemoryCultureRevisionRepo {
+	zap.L().Debug("Initializing MemoryCultureRevisionRepo")
+	return &MemoryCultureRevisionRepo{
+		revisions: make(map[string][]*entity.CultureRevision),
+	}
+}
+
+// 改訂番号を採番して追記
+func (m *MemoryCultureRevisionRepo) Append(
+	ctx context.Context,
+	rev *entity.CultureRevision,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rev.Revision = len(m.revisions[rev.CommunityID]) + 1
+	rev.CreatedAt = time.Now()
+	m.revisions[rev.CommunityID] = append(m.revisions[rev.CommunityID], rev)
+	zap.L().Info("Culture revision appended",
+		zap.String("communityID", rev.CommunityID), zap.Int("revision", rev.Revision))
+	return nil
+}
+
+// コミュニティの改訂履歴を古い順に取得
+func (m *MemoryCultureRevisionRepo) GetByCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]*entity.CultureRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	revs := m.revisions[communityID]
+	result := make([]*entity.CultureRevision, len(revs))
+	copy(result, revs)
+	return result, nil
+}
+
+// 改訂番号を指定して取得
+func (m *MemoryCultureRevisionRepo) GetByRevision(
+	ctx context.Context,
+	communityID string,
+	revision int,
+) (*entity.CultureRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	revs := m.revisions[communityID]
+	if revision < 1 || revision > len(revs) {
+		return nil, repository.ErrRevisionNotFound
+	}
+	return revs[revision-1], nil
+}
+
+// コミュニティの改訂履歴をすべて削除
+func (m *MemoryCultureRevisionRepo) DeleteByCommunity(
+	ctx context.Context,
+	communityID string,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.revisions, communityID)
+	zap.L().Info("Culture revisions deleted", zap.String("communityID", communityID))
+	return nil
+}
+
+var _ repository.CultureRevisionRepository = (*MemoryCultureRevisionRepo)(nil)
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type MemoryEventStore struct {
+	mu     sync.RWMutex
+	events []*entity.DomainEvent
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	zap.L().Debug("Initializing MemoryEventStore")
+	return &MemoryEventStore{
+		events: make([]*entity.DomainEvent, 0),
+	}
+}
+
+// 通し番号を採番して追記
+func (m *MemoryEventStore) Append(
+	ctx context.Context,
+	events ...*entity.DomainEvent,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range events {
+		e.Seq = int64(len(m.events)) + 1
+		if e.OccurredAt.IsZero() {
+			e.OccurredAt = time.Now()
+		}
+		m.events = append(m.events, e)
+		zap.L().Debug("Event appended",
+			zap.Int64("seq", e.Seq), zap.String("type", string(e.Type)))
+	}
+	return nil
+}
+
+// 範囲を指定してイベントを古い順に取得
+func (m *MemoryEventStore) List(
+	ctx context.Context,
+	afterSeq, untilSeq int64,
+) ([]*entity.DomainEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*entity.DomainEvent, 0)
+	for _, e := range m.events {
+		if e.Seq <= afterSeq {
+			continue
+		}
+		if untilSeq > 0 && e.Seq > untilSeq {
+			break
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+var _ repository.EventStore = (*MemoryEventStore)(nil)
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type MemoryLLMUsageRepo struct {
+	mu      sync.RWMutex
+	records []*entity.LLMUsageRecord
+}
+
+func NewMemoryLLMUsageRepo() *MemoryLLMUsageRepo {
+	zap.L().Debug("Initializing MemoryLLMUsageRepo")
+	return &MemoryLLMUsageRepo{}
+}
+
+// 利用量の記録を追加
+func (m *MemoryLLMUsageRepo) Save(
+	ctx context.Context,
+	record *entity.LLMUsageRecord,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+	record.CreatedAt = time.Now()
+	m.records = append(m.records, record)
+	return nil
+}
+
+// 条件に合う記録を古い順に返す
+func (m *MemoryLLMUsageRepo) Find(
+	ctx context.Context,
+	q repository.LLMUsageQuery,
+) ([]*entity.LLMUsageRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*entity.LLMUsageRecord, 0)
+	for _, r := range m.records {
+		if q.SimulationID != "" && r.SimulationID != q.SimulationID {
+			continue
+		}
+		if q.CommunityID != "" && !slices.Contains(r.Communities, q.CommunityID) {
+			continue
+		}
+		if !q.From.IsZero() && r.CreatedAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !r.CreatedAt.Before(q.To) {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+var _ repository.LLMUsageRepository = (*MemoryLLMUsageRepo)(nil)
@@ -2,11 +2,13 @@ package repository
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
 )
 
 type MemorySimulationRepo struct {
@@ -23,8 +25,10 @@ func NewMemorySimulationRepo() *MemorySimulationRepo {
 func (m *MemorySimulationRepo) Save(ctx context.Context, result *entity.SimulationResult) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	// ID 自動生成（ここでは UUID を利用）
-	result.ID = uuid.New().String()
+	// ID 自動生成（ここでは UUID を利用）。呼び出し側で採番済みならそれを使う
+	if result.ID == "" {
+		result.ID = uuid.New().String()
+	}
 	result.CreatedAt = time.Now()
 	m.simulations = append(m.simulations, result)
 	return nil
@@ -35,3 +39,61 @@ func (m *MemorySimulationRepo) GetAll(ctx context.Context) ([]*entity.Simulation
 	defer m.mu.RUnlock()
 	return m.simulations, nil
 }
+
+// 各結果の関連コミュニティから communityID を外す
+func (m *MemorySimulationRepo) RemoveCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var removed []string
+	m.simulations, removed = removeCommunityFromSimulations(m.simulations, communityID)
+	return removed, nil
+}
+
+// communityID を関連コミュニティから外した新しいスライスと、削除した結果の ID を返す
+// 関連コミュニティがなくなった結果は含めない（元の要素は書き換えない）
+func removeCommunityFromSimulations(
+	simulations []*entity.SimulationResult,
+	communityID string,
+) ([]*entity.SimulationResult, []string) {
+	result := make([]*entity.SimulationResult, 0, len(simulations))
+	var removed []string
+	for _, s := range simulations {
+		if !slices.Contains(s.Communities, communityID) {
+			result = append(result, s)
+			continue
+		}
+		if cp := s.WithoutCommunity(communityID); cp != nil {
+			result = append(result, cp)
+		} else {
+			removed = append(removed, s.ID)
+		}
+	}
+	return result, removed
+}
+
+// ID でシミュレーション結果を取得
+func (m *MemorySimulationRepo) GetByID(ctx context.Context, id string) (*entity.SimulationResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.simulations {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, repository.ErrSimulationNotFound
+}
+
+// 条件に合う結果を新しい順に取得
+func (m *MemorySimulationRepo) Find(
+	ctx context.Context,
+	query repository.SimulationQuery,
+) (*repository.SimulationPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return findSimulations(m.simulations, query)
+}
+
+var _ repository.SimulationRepository = (*MemorySimulationRepo)(nil)
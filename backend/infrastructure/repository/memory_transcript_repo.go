@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type MemoryTranscriptRepo struct {
+	mu          sync.RWMutex
+	transcripts map[string]*entity.Transcript
+}
+
+func NewMemoryTranscriptRepo() *MemoryTranscriptRepo {
+	zap.L().Debug("Initializing MemoryTranscriptRepo")
+	return &MemoryTranscriptRepo{
+		transcripts: make(map[string]*entity.Transcript),
+	}
+}
+
+// シミュレーションの記録を保存（既存なら置き換え）
+func (m *MemoryTranscriptRepo) Save(
+	ctx context.Context,
+	t *entity.Transcript,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transcripts[t.SimulationID] = t
+	zap.L().Debug("Transcript saved",
+		zap.String("simulationID", t.SimulationID), zap.Int("exchanges", len(t.Exchanges)))
+	return nil
+}
+
+// シミュレーションIDで記録を取得
+func (m *MemoryTranscriptRepo) GetBySimulation(
+	ctx context.Context,
+	simulationID string,
+) (*entity.Transcript, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.transcripts[simulationID]
+	if !ok {
+		return nil, repository.ErrTranscriptNotFound
+	}
+	return t, nil
+}
+
+// 削除したシミュレーションの記録を削除
+func (m *MemoryTranscriptRepo) DeleteBySimulations(
+	ctx context.Context,
+	simulationIDs []string,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range simulationIDs {
+		delete(m.transcripts, id)
+	}
+	return nil
+}
+
+var _ repository.TranscriptRepository = (*MemoryTranscriptRepo)(nil)
@@ -0,0 +1,640 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// 書き込みをトランザクション内に溜めておき、成功時にまとめて各メモリリポジトリへ反映する
+type MemoryUnitOfWork struct {
+	communities *MemoryCommunityRepo
+	agents      *MemoryAgentRepo
+	simulations *MemorySimulationRepo
+	revisions   *MemoryCultureRevisionRepo
+	events      *MemoryEventStore
+	transcripts *MemoryTranscriptRepo
+}
+
+func NewMemoryUnitOfWork(
+	cr *MemoryCommunityRepo,
+	ar *MemoryAgentRepo,
+	sr *MemorySimulationRepo,
+	rr *MemoryCultureRevisionRepo,
+	es *MemoryEventStore,
+	tr *MemoryTranscriptRepo,
+) *MemoryUnitOfWork {
+	zap.L().Debug("Initializing MemoryUnitOfWork")
+	return &MemoryUnitOfWork{
+		communities: cr,
+		agents:      ar,
+		simulations: sr,
+		revisions:   rr,
+		events:      es,
+		transcripts: tr,
+	}
+}
+
+func (u *MemoryUnitOfWork) Do(
+	ctx context.Context,
+	fn func(ctx context.Context, repos repository.TxRepositories) error,
+) error {
+	tx := &memoryTx{
+		uow:         u,
+		communities: make(map[string]*entity.Community),
+		baseVersion: make(map[string]int),
+		purged:      make(map[string]bool),
+	}
+	if err := fn(ctx, tx.repos()); err != nil {
+		zap.L().Debug("Memory transaction rolled back", zap.Error(err))
+		tx.versions.restore()
+		return err
+	}
+	if err := tx.commit(); err != nil {
+		tx.versions.restore()
+		return err
+	}
+	return nil
+}
+
+// 1回の Do で溜めた書き込み
+type memoryTx struct {
+	uow *MemoryUnitOfWork
+
+	mu          sync.Mutex
+	communities map[string]*entity.Community // 保存予定のコミュニティ（コピー）
+	baseVersion map[string]int               // 保存予定のコミュニティの、読み込み時点での保存先の版
+	purged      map[string]bool              // 完全削除予定のコミュニティID
+	versions    stagedVersions               // 確定しなかった場合に戻す、呼び出し側の版
+	agents      []*entity.Agent
+	simulations []*entity.SimulationResult
+	revisions   []*entity.CultureRevision
+	events      []*entity.DomainEvent
+	transcripts []*entity.Transcript
+	imports     []stagedImport // 確定時に、他の書き込みより先に反映する
+
+	// コミュニティ単位の削除（確定時に、溜めた追加分を反映した後で適用する）
+	agentPurges      []string
+	revisionPurges   []string
+	simulationPurges []string
+	transcriptPurges []string // シミュレーションID
+}
+
+func (tx *memoryTx) repos() repository.TxRepositories {
+	return repository.TxRepositories{
+		Communities: &memoryTxCommunityRepo{tx: tx},
+		Agents:      &memoryTxAgentRepo{tx: tx},
+		Simulations: &memoryTxSimulationRepo{tx: tx},
+		Revisions:   &memoryTxCultureRevisionRepo{tx: tx},
+		Events:      &memoryTxEventStore{tx: tx},
+		Transcripts: &memoryTxTranscriptRepo{tx: tx},
+		World:       &memoryTxWorldRepo{tx: tx},
+	}
+}
+
+func (tx *memoryTx) world() *MemoryWorldRepo {
+	u := tx.uow
+	return &MemoryWorldRepo{
+		communities: u.communities,
+		agents:      u.agents,
+		simulations: u.simulations,
+		revisions:   u.revisions,
+	}
+}
+
+// 溜めた書き込みを全リポジトリをロックした状態でまとめて反映する
+func (tx *memoryTx) commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	u := tx.uow
+
+	u.communities.mu.Lock()
+	defer u.communities.mu.Unlock()
+	u.agents.mu.Lock()
+	defer u.agents.mu.Unlock()
+	u.simulations.mu.Lock()
+	defer u.simulations.mu.Unlock()
+	u.revisions.mu.Lock()
+	defer u.revisions.mu.Unlock()
+	u.events.mu.Lock()
+	defer u.events.mu.Unlock()
+	u.transcripts.mu.Lock()
+	defer u.transcripts.mu.Unlock()
+
+	// 読み込んだ後に他のトランザクションが更新していれば、何も反映せず競合とする
+	for id, base := range tx.baseVersion {
+		if err := u.communities.checkVersion(id, base); err != nil {
+			zap.L().Warn("Memory transaction conflicted", zap.Error(err))
+			return err
+		}
+	}
+
+	if len(tx.imports) > 0 {
+		world := tx.world()
+		w := world.current()
+		for _, imp := range tx.imports {
+			var err error
+			if w, err = importWorld(w, imp.snapshot, imp.mode); err != nil {
+				return err
+			}
+		}
+		world.set(w)
+	}
+	for id := range tx.purged {
+		delete(u.communities.communities, id)
+	}
+	for id, c := range tx.communities {
+		u.communities.communities[id] = c
+	}
+	for _, a := range tx.agents {
+		u.agents.Agents = upsertAgent(u.agents.Agents, a)
+	}
+	u.simulations.simulations = append(u.simulations.simulations, tx.simulations...)
+	// 改訂番号と通し番号は、他のトランザクションとの競合を避けるため確定時に振り直す
+	for _, r := range tx.revisions {
+		r.Revision = len(u.revisions.revisions[r.CommunityID]) + 1
+		u.revisions.revisions[r.CommunityID] = append(u.revisions.revisions[r.CommunityID], r)
+	}
+	for _, e := range tx.events {
+		e.Seq = int64(len(u.events.events)) + 1
+		u.events.events = append(u.events.events, e)
+	}
+	for _, t := range tx.transcripts {
+		u.transcripts.transcripts[t.SimulationID] = t
+	}
+	for _, id := range tx.agentPurges {
+		u.agents.Agents = removeAgentsOf(u.agents.Agents, id)
+	}
+	for _, id := range tx.revisionPurges {
+		delete(u.revisions.revisions, id)
+	}
+	for _, id := range tx.simulationPurges {
+		u.simulations.simulations, _ = removeCommunityFromSimulations(
+			u.simulations.simulations, id)
+	}
+	for _, id := range tx.transcriptPurges {
+		delete(u.transcripts.transcripts, id)
+	}
+
+	zap.L().Debug("Memory transaction committed",
+		zap.Int("imports", len(tx.imports)),
+		zap.Int("communities", len(tx.communities)),
+		zap.Int("revisions", len(tx.revisions)),
+		zap.Int("events", len(tx.events)))
+	return nil
+}
+
+// トランザクション内のコミュニティリポジトリ（未確定の書き込みも読める）
+type memoryTxCommunityRepo struct{ tx *memoryTx }
+
+func (r *memoryTxCommunityRepo) GetByID(
+	ctx context.Context,
+	id string,
+) (*entity.Community, error) {
+	c, err := r.GetByIDIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsDeleted() {
+		return nil, repository.ErrCommunityNotFound
+	}
+	return c, nil
+}
+
+func (r *memoryTxCommunityRepo) GetByIDIncludingDeleted(
+	ctx context.Context,
+	id string,
+) (*entity.Community, error) {
+	r.tx.mu.Lock()
+	if r.tx.purged[id] {
+		r.tx.mu.Unlock()
+		return nil, repository.ErrCommunityNotFound
+	}
+	if c, ok := r.tx.communities[id]; ok {
+		r.tx.mu.Unlock()
+		return copyCommunity(c), nil
+	}
+	r.tx.mu.Unlock()
+	return r.tx.uow.communities.GetByIDIncludingDeleted(ctx, id)
+}
+
+func (r *memoryTxCommunityRepo) Save(
+	ctx context.Context,
+	c *entity.Community,
+) error {
+	stored := r.tx.uow.communities.version(c.ID)
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	current, staged := stored, false
+	if s, ok := r.tx.communities[c.ID]; ok {
+		current, staged = s.Version, true
+	} else if r.tx.purged[c.ID] {
+		current = 0
+	}
+	if c.Version != current {
+		return &repository.ConflictError{
+			Entity: "community", ID: c.ID, Expected: c.Version, Actual: current,
+		}
+	}
+	if _, ok := r.tx.baseVersion[c.ID]; !ok && !staged {
+		r.tx.baseVersion[c.ID] = stored
+	}
+	r.tx.versions.bump(c)
+	r.tx.communities[c.ID] = copyCommunity(c)
+	delete(r.tx.purged, c.ID)
+	return nil
+}
+
+func (r *memoryTxCommunityRepo) GetAll(
+	ctx context.Context,
+) ([]*entity.Community, error) {
+	return r.list(ctx, false)
+}
+
+func (r *memoryTxCommunityRepo) GetAllIncludingDeleted(
+	ctx context.Context,
+) ([]*entity.Community, error) {
+	return r.list(ctx, true)
+}
+
+func (r *memoryTxCommunityRepo) list(
+	ctx context.Context,
+	includeDeleted bool,
+) ([]*entity.Community, error) {
+	stored, err := r.tx.uow.communities.GetAllIncludingDeleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	merged := make(map[string]*entity.Community, len(stored))
+	for _, c := range stored {
+		merged[c.ID] = c
+	}
+	for id, c := range r.tx.communities {
+		merged[id] = copyCommunity(c)
+	}
+	result := make([]*entity.Community, 0, len(merged))
+	for id, c := range merged {
+		if r.tx.purged[id] || (c.IsDeleted() && !includeDeleted) {
+			continue
+		}
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *memoryTxCommunityRepo) Delete(
+	ctx context.Context,
+	id string,
+) error {
+	if _, err := r.GetByIDIncludingDeleted(ctx, id); err != nil {
+		return err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	delete(r.tx.communities, id)
+	delete(r.tx.baseVersion, id)
+	r.tx.purged[id] = true
+	return nil
+}
+
+// トランザクション内のエージェントリポジトリ
+type memoryTxAgentRepo struct{ tx *memoryTx }
+
+func (r *memoryTxAgentRepo) GetByID(
+	ctx context.Context,
+	id string,
+) (*entity.Agent, error) {
+	r.tx.mu.Lock()
+	for _, a := range r.tx.agents {
+		if a.ID == id {
+			r.tx.mu.Unlock()
+			return a, nil
+		}
+	}
+	r.tx.mu.Unlock()
+	return r.tx.uow.agents.GetByID(ctx, id)
+}
+
+func (r *memoryTxAgentRepo) Save(
+	ctx context.Context,
+	agent *entity.Agent,
+) error {
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	r.tx.agents = upsertAgent(r.tx.agents, agent)
+	return nil
+}
+
+func (r *memoryTxAgentRepo) GetAll(
+	ctx context.Context,
+) ([]*entity.Agent, error) {
+	result, err := r.tx.uow.agents.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	for _, a := range r.tx.agents {
+		result = upsertAgent(result, a)
+	}
+	return result, nil
+}
+
+func (r *memoryTxAgentRepo) GetAgentsByCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]*entity.Agent, error) {
+	all, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []*entity.Agent
+	for _, a := range all {
+		if a.CommunityID == communityID {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+func (r *memoryTxAgentRepo) DeleteByCommunity(
+	ctx context.Context,
+	communityID string,
+) error {
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	r.tx.agents = removeAgentsOf(r.tx.agents, communityID)
+	r.tx.agentPurges = append(r.tx.agentPurges, communityID)
+	return nil
+}
+
+// トランザクション内のシミュレーション履歴リポジトリ
+type memoryTxSimulationRepo struct{ tx *memoryTx }
+
+func (r *memoryTxSimulationRepo) Save(
+	ctx context.Context,
+	result *entity.SimulationResult,
+) error {
+	if result.ID == "" {
+		result.ID = uuid.New().String()
+	}
+	result.CreatedAt = time.Now()
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	r.tx.simulations = append(r.tx.simulations, result)
+	return nil
+}
+
+func (r *memoryTxSimulationRepo) GetAll(
+	ctx context.Context,
+) ([]*entity.SimulationResult, error) {
+	stored, err := r.tx.uow.simulations.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	result := make([]*entity.SimulationResult, 0, len(stored)+len(r.tx.simulations))
+	result = append(result, stored...)
+	return append(result, r.tx.simulations...), nil
+}
+
+func (r *memoryTxSimulationRepo) GetByID(
+	ctx context.Context,
+	id string,
+) (*entity.SimulationResult, error) {
+	all, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range all {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, repository.ErrSimulationNotFound
+}
+
+func (r *memoryTxSimulationRepo) Find(
+	ctx context.Context,
+	query repository.SimulationQuery,
+) (*repository.SimulationPage, error) {
+	all, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return findSimulations(all, query)
+}
+
+// 確定時に保存済みの結果からも外す。返す ID は呼び出し時点で削除されることになる結果のもの
+func (r *memoryTxSimulationRepo) RemoveCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]string, error) {
+	stored, err := r.tx.uow.simulations.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, removed := removeCommunityFromSimulations(stored, communityID)
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	var staged []string
+	r.tx.simulations, staged = removeCommunityFromSimulations(r.tx.simulations, communityID)
+	r.tx.simulationPurges = append(r.tx.simulationPurges, communityID)
+	return append(removed, staged...), nil
+}
+
+// トランザクション内の文化の改訂履歴リポジトリ
+type memoryTxCultureRevisionRepo struct{ tx *memoryTx }
+
+func (r *memoryTxCultureRevisionRepo) Append(
+	ctx context.Context,
+	rev *entity.CultureRevision,
+) error {
+	stored, err := r.tx.uow.revisions.GetByCommunity(ctx, rev.CommunityID)
+	if err != nil {
+		return err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	// 仮の番号（確定時に振り直す）
+	rev.Revision = len(stored) + 1
+	for _, staged := range r.tx.revisions {
+		if staged.CommunityID == rev.CommunityID {
+			rev.Revision++
+		}
+	}
+	rev.CreatedAt = time.Now()
+	r.tx.revisions = append(r.tx.revisions, rev)
+	return nil
+}
+
+func (r *memoryTxCultureRevisionRepo) GetByCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]*entity.CultureRevision, error) {
+	result, err := r.tx.uow.revisions.GetByCommunity(ctx, communityID)
+	if err != nil {
+		return nil, err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	for _, rev := range r.tx.revisions {
+		if rev.CommunityID == communityID {
+			result = append(result, rev)
+		}
+	}
+	return result, nil
+}
+
+func (r *memoryTxCultureRevisionRepo) GetByRevision(
+	ctx context.Context,
+	communityID string,
+	revision int,
+) (*entity.CultureRevision, error) {
+	revs, err := r.GetByCommunity(ctx, communityID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range revs {
+		if rev.Revision == revision {
+			return rev, nil
+		}
+	}
+	return nil, repository.ErrRevisionNotFound
+}
+
+func (r *memoryTxCultureRevisionRepo) DeleteByCommunity(
+	ctx context.Context,
+	communityID string,
+) error {
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	staged := r.tx.revisions[:0]
+	for _, rev := range r.tx.revisions {
+		if rev.CommunityID != communityID {
+			staged = append(staged, rev)
+		}
+	}
+	r.tx.revisions = staged
+	r.tx.revisionPurges = append(r.tx.revisionPurges, communityID)
+	return nil
+}
+
+// トランザクション内のイベントストア（確定時に通し番号を振る）
+type memoryTxEventStore struct{ tx *memoryTx }
+
+func (r *memoryTxEventStore) Append(
+	ctx context.Context,
+	events ...*entity.DomainEvent,
+) error {
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	for _, e := range events {
+		if e.OccurredAt.IsZero() {
+			e.OccurredAt = time.Now()
+		}
+		r.tx.events = append(r.tx.events, e)
+	}
+	return nil
+}
+
+func (r *memoryTxEventStore) List(
+	ctx context.Context,
+	afterSeq, untilSeq int64,
+) ([]*entity.DomainEvent, error) {
+	// 未確定のイベントには通し番号がないため、確定済みのものだけを返す
+	return r.tx.uow.events.List(ctx, afterSeq, untilSeq)
+}
+
+// トランザクション内のシミュレーション記録リポジトリ
+type memoryTxTranscriptRepo struct{ tx *memoryTx }
+
+func (r *memoryTxTranscriptRepo) Save(
+	ctx context.Context,
+	t *entity.Transcript,
+) error {
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	r.tx.transcripts = append(r.tx.transcripts, t)
+	return nil
+}
+
+func (r *memoryTxTranscriptRepo) DeleteBySimulations(
+	ctx context.Context,
+	simulationIDs []string,
+) error {
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	staged := r.tx.transcripts[:0]
+	for _, t := range r.tx.transcripts {
+		if !slices.Contains(simulationIDs, t.SimulationID) {
+			staged = append(staged, t)
+		}
+	}
+	r.tx.transcripts = staged
+	r.tx.transcriptPurges = append(r.tx.transcriptPurges, simulationIDs...)
+	return nil
+}
+
+func (r *memoryTxTranscriptRepo) GetBySimulation(
+	ctx context.Context,
+	simulationID string,
+) (*entity.Transcript, error) {
+	r.tx.mu.Lock()
+	for i := len(r.tx.transcripts) - 1; i >= 0; i-- {
+		if t := r.tx.transcripts[i]; t.SimulationID == simulationID {
+			r.tx.mu.Unlock()
+			return t, nil
+		}
+	}
+	r.tx.mu.Unlock()
+	return r.tx.uow.transcripts.GetBySimulation(ctx, simulationID)
+}
+
+// 確定時に取り込むスナップショット
+type stagedImport struct {
+	snapshot *entity.WorldSnapshot
+	mode     entity.WorldImportMode
+}
+
+// トランザクション内のワールドリポジトリ
+// 取り込みは確定時に反映するため、同じトランザクション内の読み取りには現れない
+type memoryTxWorldRepo struct{ tx *memoryTx }
+
+func (r *memoryTxWorldRepo) Export(
+	ctx context.Context,
+) (*entity.WorldSnapshot, error) {
+	return r.tx.world().Export(ctx)
+}
+
+// 取り込めないスナップショットは、確定を待たずにその場でエラーにする
+func (r *memoryTxWorldRepo) Import(
+	ctx context.Context,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) error {
+	world := r.tx.world()
+	world.lock()
+	_, err := importWorld(world.current(), snapshot, mode)
+	world.unlock()
+	if err != nil {
+		return err
+	}
+	r.tx.mu.Lock()
+	defer r.tx.mu.Unlock()
+	r.tx.imports = append(r.tx.imports, stagedImport{snapshot: snapshot, mode: mode})
+	return nil
+}
+
+var _ repository.UnitOfWork = (*MemoryUnitOfWork)(nil)
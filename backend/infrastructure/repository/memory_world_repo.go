@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// 各メモリリポジトリをまとめてスナップショットとして読み書きする
+type MemoryWorldRepo struct {
+	communities *MemoryCommunityRepo
+	agents      *MemoryAgentRepo
+	simulations *MemorySimulationRepo
+	revisions   *MemoryCultureRevisionRepo
+}
+
+func NewMemoryWorldRepo(
+	cr *MemoryCommunityRepo,
+	ar *MemoryAgentRepo,
+	sr *MemorySimulationRepo,
+	rr *MemoryCultureRevisionRepo,
+) *MemoryWorldRepo {
+	zap.L().Debug("Initializing MemoryWorldRepo")
+	return &MemoryWorldRepo{
+		communities: cr,
+		agents:      ar,
+		simulations: sr,
+		revisions:   rr,
+	}
+}
+
+// 全リポジトリを決まった順でロックする
+func (m *MemoryWorldRepo) lock() {
+	m.communities.mu.Lock()
+	m.agents.mu.Lock()
+	m.simulations.mu.Lock()
+	m.revisions.mu.Lock()
+}
+
+func (m *MemoryWorldRepo) unlock() {
+	m.revisions.mu.Unlock()
+	m.simulations.mu.Unlock()
+	m.agents.mu.Unlock()
+	m.communities.mu.Unlock()
+}
+
+// ワールド全体をスナップショットとして書き出す
+func (m *MemoryWorldRepo) Export(
+	ctx context.Context,
+) (*entity.WorldSnapshot, error) {
+	m.lock()
+	defer m.unlock()
+
+	snapshot := &entity.WorldSnapshot{
+		FormatVersion: entity.WorldSnapshotFormatVersion,
+		ExportedAt:    time.Now(),
+		Communities:   make([]*entity.Community, 0, len(m.communities.communities)),
+		Agents:        make([]*entity.Agent, 0, len(m.agents.Agents)),
+		Simulations:   make([]*entity.SimulationResult, 0, len(m.simulations.simulations)),
+		Revisions:     make([]*entity.CultureRevision, 0),
+	}
+	for _, c := range m.communities.communities {
+		snapshot.Communities = append(snapshot.Communities, copyCommunity(c))
+	}
+	sort.Slice(snapshot.Communities, func(i, j int) bool {
+		return snapshot.Communities[i].ID < snapshot.Communities[j].ID
+	})
+	for _, a := range m.agents.Agents {
+		cp := *a
+		snapshot.Agents = append(snapshot.Agents, &cp)
+	}
+	for _, s := range m.simulations.simulations {
+		cp := *s
+		snapshot.Simulations = append(snapshot.Simulations, &cp)
+	}
+	revisionIDs := make([]string, 0, len(m.revisions.revisions))
+	for id := range m.revisions.revisions {
+		revisionIDs = append(revisionIDs, id)
+	}
+	sort.Strings(revisionIDs)
+	for _, id := range revisionIDs {
+		for _, r := range m.revisions.revisions[id] {
+			cp := *r
+			snapshot.Revisions = append(snapshot.Revisions, &cp)
+		}
+	}
+
+	zap.L().Info("World exported",
+		zap.Int("communities", len(snapshot.Communities)),
+		zap.Int("agents", len(snapshot.Agents)),
+		zap.Int("simulations", len(snapshot.Simulations)))
+	return snapshot, nil
+}
+
+// スナップショットを取り込む
+// 変更はすべてロック中に行うため、他の読み書きから途中の状態は見えない
+func (m *MemoryWorldRepo) Import(
+	ctx context.Context,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) error {
+	m.lock()
+	defer m.unlock()
+
+	w, err := importWorld(m.current(), snapshot, mode)
+	if err != nil {
+		return err
+	}
+	m.set(w)
+	zap.L().Info("World imported", zap.String("mode", string(mode)),
+		zap.Int("communities", len(w.communities)),
+		zap.Int("agents", len(w.agents)),
+		zap.Int("simulations", len(w.simulations)))
+	return nil
+}
+
+// memoryWorld: 各メモリリポジトリの中身の組（ロック中にだけ読み書きする）
+type memoryWorld struct {
+	communities map[string]*entity.Community
+	agents      []*entity.Agent
+	simulations []*entity.SimulationResult
+	revisions   map[string][]*entity.CultureRevision
+}
+
+func (m *MemoryWorldRepo) current() memoryWorld {
+	return memoryWorld{
+		communities: m.communities.communities,
+		agents:      m.agents.Agents,
+		simulations: m.simulations.simulations,
+		revisions:   m.revisions.revisions,
+	}
+}
+
+func (m *MemoryWorldRepo) set(w memoryWorld) {
+	m.communities.communities = w.communities
+	m.agents.Agents = w.agents
+	m.simulations.simulations = w.simulations
+	m.revisions.revisions = w.revisions
+}
+
+// importWorld: base にスナップショットを取り込んだ結果を新しく組み立てる（base は変更しない）
+func importWorld(
+	base memoryWorld,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) (memoryWorld, error) {
+	if mode != entity.WorldImportReplace && mode != entity.WorldImportMerge {
+		return memoryWorld{}, fmt.Errorf("unknown import mode: %s", mode)
+	}
+
+	w := memoryWorld{
+		communities: make(map[string]*entity.Community),
+		agents:      make([]*entity.Agent, 0),
+		simulations: make([]*entity.SimulationResult, 0),
+		revisions:   make(map[string][]*entity.CultureRevision),
+	}
+	if mode == entity.WorldImportMerge {
+		for id, c := range base.communities {
+			w.communities[id] = c
+		}
+		w.agents = append(w.agents, base.agents...)
+		w.simulations = append(w.simulations, base.simulations...)
+		for id, revs := range base.revisions {
+			w.revisions[id] = append([]*entity.CultureRevision(nil), revs...)
+		}
+	}
+
+	for _, c := range snapshot.Communities {
+		w.communities[c.ID] = copyCommunity(c)
+	}
+	for _, a := range snapshot.Agents {
+		cp := *a
+		w.agents = upsertAgent(w.agents, &cp)
+	}
+	for _, s := range snapshot.Simulations {
+		cp := *s
+		w.simulations = upsertSimulation(w.simulations, &cp)
+	}
+	for _, r := range snapshot.Revisions {
+		cp := *r
+		w.revisions[r.CommunityID] = upsertRevision(w.revisions[r.CommunityID], &cp)
+	}
+	// 改訂番号は連番であることを前提にしているため、欠番を許さない
+	for id, revs := range w.revisions {
+		for i, r := range revs {
+			if r.Revision != i+1 {
+				return memoryWorld{}, fmt.Errorf(
+					"%w: revisions of community %s are not sequential",
+					entity.ErrInvalidWorldSnapshot, id)
+			}
+		}
+	}
+	return w, nil
+}
+
+// 同じ ID があれば置き換え、なければ末尾に追加する
+func upsertAgent(agents []*entity.Agent, a *entity.Agent) []*entity.Agent {
+	for i, existing := range agents {
+		if existing.ID == a.ID {
+			agents[i] = a
+			return agents
+		}
+	}
+	return append(agents, a)
+}
+
+// 同じ ID があれば置き換え、なければ末尾に追加する
+func upsertSimulation(
+	simulations []*entity.SimulationResult,
+	s *entity.SimulationResult,
+) []*entity.SimulationResult {
+	for i, existing := range simulations {
+		if existing.ID == s.ID {
+			simulations[i] = s
+			return simulations
+		}
+	}
+	return append(simulations, s)
+}
+
+// 同じ改訂番号があれば置き換え、なければ番号順に挿入する
+func upsertRevision(
+	revisions []*entity.CultureRevision,
+	r *entity.CultureRevision,
+) []*entity.CultureRevision {
+	for i, existing := range revisions {
+		if existing.Revision == r.Revision {
+			revisions[i] = r
+			return revisions
+		}
+	}
+	revisions = append(revisions, r)
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions
+}
+
+var _ repository.WorldRepository = (*MemoryWorldRepo)(nil)
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// シミュレーション履歴のページ位置（最後に返した結果の作成日時と ID）
+// 新しい順 (created_at DESC, id DESC) に並べたとき、これより後ろを次のページとする
+type simulationCursor struct {
+	createdAt int64
+	id        string
+}
+
+func encodeSimulationCursor(s *entity.SimulationResult) string {
+	raw := strconv.FormatInt(toUnixNano(s.CreatedAt), 10) + ":" + s.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSimulationCursor(cursor string) (*simulationCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", repository.ErrInvalidCursor, err)
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, repository.ErrInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", repository.ErrInvalidCursor, err)
+	}
+	return &simulationCursor{createdAt: createdAt, id: id}, nil
+}
+
+// a が新しい順で b より前に来るか
+func simulationNewerThan(a, b *entity.SimulationResult) bool {
+	at, bt := toUnixNano(a.CreatedAt), toUnixNano(b.CreatedAt)
+	if at != bt {
+		return at > bt
+	}
+	return a.ID > b.ID
+}
+
+// メモリ上の結果一覧を条件で絞り込み、新しい順に1ページ分返す
+func findSimulations(
+	all []*entity.SimulationResult,
+	q repository.SimulationQuery,
+) (*repository.SimulationPage, error) {
+	var cursor *simulationCursor
+	if q.Cursor != "" {
+		c, err := decodeSimulationCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	}
+
+	matched := make([]*entity.SimulationResult, 0)
+	for _, s := range all {
+		if q.CommunityID != "" && !slices.Contains(s.Communities, q.CommunityID) {
+			continue
+		}
+		if q.Type != "" && s.Type != q.Type {
+			continue
+		}
+		if !q.From.IsZero() && s.CreatedAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !s.CreatedAt.Before(q.To) {
+			continue
+		}
+		if cursor != nil {
+			t := toUnixNano(s.CreatedAt)
+			if t > cursor.createdAt || (t == cursor.createdAt && s.ID >= cursor.id) {
+				continue
+			}
+		}
+		matched = append(matched, s)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return simulationNewerThan(matched[i], matched[j])
+	})
+
+	page := &repository.SimulationPage{Simulations: matched}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		page.Simulations = matched[:q.Limit]
+		page.NextCursor = encodeSimulationCursor(page.Simulations[q.Limit-1])
+	}
+	return page, nil
+}
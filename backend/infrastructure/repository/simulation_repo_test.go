@@ -0,0 +1,257 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// 保存時に ID（未指定の場合）と作成日時を振り、保存した順に返す
+func TestSimulationRepoSaveAndGet(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		named := &entity.SimulationResult{ID: "s1", Type: entity.SimulationTypeDiplomacy,
+			Communities: []string{"c1", "c2"}, ResultJSON: `{"outcome":"peace"}`}
+		generated := &entity.SimulationResult{Type: entity.SimulationTypeCultureEvolution,
+			Communities: []string{"c1"}, ResultJSON: `{}`}
+		for _, sim := range []*entity.SimulationResult{named, generated} {
+			if err := s.simulations.Save(ctx, sim); err != nil {
+				t.Fatalf("failed to save simulation: %v", err)
+			}
+			if sim.ID == "" || sim.CreatedAt.IsZero() {
+				t.Errorf("saved simulation = %+v, want an ID and a creation time", sim)
+			}
+		}
+		if named.ID != "s1" {
+			t.Errorf("ID = %s, want the given s1", named.ID)
+		}
+
+		got, err := s.simulations.GetByID(ctx, "s1")
+		if err != nil {
+			t.Fatalf("failed to get simulation: %v", err)
+		}
+		if got.Type != entity.SimulationTypeDiplomacy ||
+			!slices.Equal(got.Communities, []string{"c1", "c2"}) ||
+			got.ResultJSON != named.ResultJSON || !got.CreatedAt.Equal(named.CreatedAt) {
+			t.Errorf("simulation = %+v, want %+v", got, named)
+		}
+		if _, err := s.simulations.GetByID(ctx, "missing"); !errors.Is(
+			err, domainrepo.ErrSimulationNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrSimulationNotFound)
+		}
+
+		all, err := s.simulations.GetAll(ctx)
+		if err != nil {
+			t.Fatalf("failed to get simulations: %v", err)
+		}
+		if len(all) != 2 || all[0].ID != "s1" || all[1].ID != generated.ID {
+			t.Errorf("simulations = %+v, want s1 then %s", all, generated.ID)
+		}
+	})
+}
+
+// saveSimulation: changes のコミュニティに関連する結果を保存する
+func saveSimulation(
+	t *testing.T,
+	repo domainrepo.SimulationRepository,
+	id string,
+	communityIDs ...string,
+) {
+	t.Helper()
+	changes := make([]entity.CommunityChange, len(communityIDs))
+	for i, communityID := range communityIDs {
+		changes[i] = entity.CommunityChange{CommunityID: communityID, NewPopulation: i + 1}
+	}
+	sim, err := entity.NewSimulationResult(id, entity.SimulationTypeDiplomacy,
+		map[string]string{"outcome": "peace"}, "", changes...)
+	if err != nil {
+		t.Fatalf("failed to create simulation: %v", err)
+	}
+	if err := repo.Save(context.Background(), sim); err != nil {
+		t.Fatalf("failed to save simulation: %v", err)
+	}
+}
+
+// 関連コミュニティと変化から外し、関連コミュニティがなくなった結果は削除する
+func TestSimulationRepoRemoveCommunity(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		saveSimulation(t, s.simulations, "s1", "c1", "c2")
+		saveSimulation(t, s.simulations, "s2", "c1")
+		saveSimulation(t, s.simulations, "s3", "c2")
+
+		removed, err := s.simulations.RemoveCommunity(ctx, "c1")
+		if err != nil {
+			t.Fatalf("failed to remove community: %v", err)
+		}
+		if !slices.Equal(removed, []string{"s2"}) {
+			t.Errorf("removed = %v, want [s2]", removed)
+		}
+		if _, err := s.simulations.GetByID(ctx, "s2"); !errors.Is(
+			err, domainrepo.ErrSimulationNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrSimulationNotFound)
+		}
+
+		got, err := s.simulations.GetByID(ctx, "s1")
+		if err != nil {
+			t.Fatalf("failed to get simulation: %v", err)
+		}
+		var record entity.SimulationRecord
+		if err := json.Unmarshal([]byte(got.ResultJSON), &record); err != nil {
+			t.Fatalf("failed to decode result: %v", err)
+		}
+		if !slices.Equal(got.Communities, []string{"c2"}) || len(record.Changes) != 1 ||
+			record.Changes[0].CommunityID != "c2" || record.Changes[0].NewPopulation != 2 ||
+			string(record.Outcome) != `{"outcome":"peace"}` {
+			t.Errorf("simulation = %+v, want only c2's change with the outcome kept", got)
+		}
+		if all, _ := s.simulations.GetAll(ctx); len(all) != 2 {
+			t.Errorf("simulations = %+v, want s1 and s3", all)
+		}
+
+		if removed, err := s.simulations.RemoveCommunity(ctx, "missing"); err != nil ||
+			len(removed) != 0 {
+			t.Errorf("removing an unrelated community = %v, %v; want nothing", removed, err)
+		}
+	})
+}
+
+func simulationIDs(sims []*entity.SimulationResult) []string {
+	ids := make([]string, len(sims))
+	for i, sim := range sims {
+		ids[i] = sim.ID
+	}
+	return ids
+}
+
+// findAll: NextCursor をたどって条件に合う結果をすべて集める
+func findAll(
+	t *testing.T,
+	repo domainrepo.SimulationRepository,
+	q domainrepo.SimulationQuery,
+) (ids []string, pages int) {
+	t.Helper()
+	for {
+		page, err := repo.Find(context.Background(), q)
+		if err != nil {
+			t.Fatalf("failed to find simulations: %v", err)
+		}
+		if len(page.Simulations) > q.Limit {
+			t.Fatalf("page has %d simulations, over the limit %d",
+				len(page.Simulations), q.Limit)
+		}
+		ids = append(ids, simulationIDs(page.Simulations)...)
+		pages++
+		if page.NextCursor == "" {
+			return ids, pages
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// 条件で絞り込んだ結果を新しい順に返し、カーソルで重複も漏れもなく続きを読める
+func TestSimulationRepoFind(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		sims := []*entity.SimulationResult{
+			{ID: "s1", Type: entity.SimulationTypeCultureEvolution, Communities: []string{"c1"}},
+			{ID: "s2", Type: entity.SimulationTypeDiplomacy, Communities: []string{"c1", "c2"}},
+			{ID: "s3", Type: entity.SimulationTypeCultureEvolution, Communities: []string{"c2"}},
+			{ID: "s4", Type: entity.SimulationTypeInterference, Communities: []string{"c1"}},
+			{ID: "s5", Type: entity.SimulationTypeCultureEvolution, Communities: []string{"c1"}},
+		}
+		for _, sim := range sims {
+			if err := s.simulations.Save(ctx, sim); err != nil {
+				t.Fatalf("failed to save simulation: %v", err)
+			}
+			// 期間の条件を確かめるため、作成日時が重ならないようにする
+			time.Sleep(time.Millisecond)
+		}
+
+		tests := []struct {
+			name      string
+			query     domainrepo.SimulationQuery
+			want      []string
+			wantPages int
+		}{
+			{name: "all", query: domainrepo.SimulationQuery{Limit: 2},
+				want: []string{"s5", "s4", "s3", "s2", "s1"}, wantPages: 3},
+			{name: "exact pages", query: domainrepo.SimulationQuery{Limit: 5},
+				want: []string{"s5", "s4", "s3", "s2", "s1"}, wantPages: 1},
+			{name: "community", query: domainrepo.SimulationQuery{CommunityID: "c1", Limit: 1},
+				want: []string{"s5", "s4", "s2", "s1"}, wantPages: 4},
+			{name: "type", query: domainrepo.SimulationQuery{
+				Type: entity.SimulationTypeCultureEvolution, Limit: 2},
+				want: []string{"s5", "s3", "s1"}, wantPages: 2},
+			{name: "community and type", query: domainrepo.SimulationQuery{
+				CommunityID: "c2", Type: entity.SimulationTypeCultureEvolution, Limit: 10},
+				want: []string{"s3"}, wantPages: 1},
+			{name: "time range includes from and excludes to", query: domainrepo.SimulationQuery{
+				From: sims[1].CreatedAt, To: sims[3].CreatedAt, Limit: 1},
+				want: []string{"s3", "s2"}, wantPages: 2},
+			{name: "no match", query: domainrepo.SimulationQuery{CommunityID: "c3", Limit: 1},
+				want: nil, wantPages: 1},
+		}
+		for _, tt := range tests {
+			ids, pages := findAll(t, s.simulations, tt.query)
+			if !slices.Equal(ids, tt.want) || pages != tt.wantPages {
+				t.Errorf("%s: got %v in %d pages, want %v in %d pages",
+					tt.name, ids, pages, tt.want, tt.wantPages)
+			}
+		}
+	})
+}
+
+// 読んでいる途中に追加された結果は、続きのページに割り込まない
+func TestSimulationRepoFindCursorIsStable(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for _, id := range []string{"s1", "s2", "s3"} {
+			if err := s.simulations.Save(ctx, &entity.SimulationResult{ID: id}); err != nil {
+				t.Fatalf("failed to save simulation: %v", err)
+			}
+		}
+		first, err := s.simulations.Find(ctx, domainrepo.SimulationQuery{Limit: 2})
+		if err != nil {
+			t.Fatalf("failed to find simulations: %v", err)
+		}
+		if err := s.simulations.Save(ctx, &entity.SimulationResult{ID: "s4"}); err != nil {
+			t.Fatalf("failed to save simulation: %v", err)
+		}
+		next, err := s.simulations.Find(ctx, domainrepo.SimulationQuery{
+			Cursor: first.NextCursor, Limit: 2,
+		})
+		if err != nil {
+			t.Fatalf("failed to find simulations: %v", err)
+		}
+		if ids := simulationIDs(next.Simulations); !slices.Equal(ids, []string{"s1"}) ||
+			next.NextCursor != "" {
+			t.Errorf("next page = %v (cursor %q), want only s1", ids, next.NextCursor)
+		}
+	})
+}
+
+// 壊れたカーソルは ErrInvalidCursor にする
+func TestSimulationRepoFindInvalidCursor(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		for _, cursor := range []string{
+			"not base64!",
+			base64.RawURLEncoding.EncodeToString([]byte("no separator")),
+			base64.RawURLEncoding.EncodeToString([]byte("later:s1")),
+		} {
+			_, err := s.simulations.Find(context.Background(), domainrepo.SimulationQuery{
+				Cursor: cursor, Limit: 1,
+			})
+			if !errors.Is(err, domainrepo.ErrInvalidCursor) {
+				t.Errorf("cursor %q: error = %v, want %v", cursor, err, domainrepo.ErrInvalidCursor)
+			}
+		}
+	})
+}
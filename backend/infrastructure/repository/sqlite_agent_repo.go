@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type SQLiteAgentRepo struct {
+	db sqlExecutor
+}
+
+func NewSQLiteAgentRepo(db *sql.DB) *SQLiteAgentRepo {
+	zap.L().Debug("Initializing SQLiteAgentRepo")
+	return &SQLiteAgentRepo{db: db}
+}
+
+const sqliteAgentColumns = `id, name, community_id, personality`
+
+// 複数行をエージェントの一覧に変換する（登録順）
+func scanAgents(rows *sql.Rows) ([]*entity.Agent, error) {
+	defer rows.Close()
+	var result []*entity.Agent
+	for rows.Next() {
+		var a entity.Agent
+		if err := rows.Scan(&a.ID, &a.Name, &a.CommunityID, &a.Personality); err != nil {
+			return nil, fmt.Errorf("failed to scan agent: %w", err)
+		}
+		result = append(result, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	return result, nil
+}
+
+// ID に基づいてエージェントを返す
+func (r *SQLiteAgentRepo) GetByID(
+	ctx context.Context,
+	id string,
+) (*entity.Agent, error) {
+	logger := zap.L()
+	logger.Debug("GetByID called", zap.String("agentID", id))
+
+	var a entity.Agent
+	err := r.db.QueryRowContext(ctx,
+		`SELECT `+sqliteAgentColumns+` FROM agents WHERE id = ?`, id,
+	).Scan(&a.ID, &a.Name, &a.CommunityID, &a.Personality)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Agent not found", zap.String("agentID", id))
+		return nil, repository.ErrAgentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	return &a, nil
+}
+
+// エージェントを保存する（既存なら更新、新規なら追加）
+func (r *SQLiteAgentRepo) Save(
+	ctx context.Context,
+	agent *entity.Agent,
+) error {
+	zap.L().Debug("Saving agent", zap.String("agentID", agent.ID))
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO agents (`+sqliteAgentColumns+`)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			community_id = excluded.community_id,
+			personality = excluded.personality`,
+		agent.ID, agent.Name, agent.CommunityID, agent.Personality,
+	); err != nil {
+		return fmt.Errorf("failed to save agent: %w", err)
+	}
+	zap.L().Info("Agent saved", zap.String("agentID", agent.ID))
+	return nil
+}
+
+// communityID に基づくエージェントを返す
+func (r *SQLiteAgentRepo) GetAgentsByCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]*entity.Agent, error) {
+	logger := zap.L()
+	logger.Debug("GetAgentsByCommunity called", zap.String("communityID", communityID))
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+sqliteAgentColumns+` FROM agents WHERE community_id = ? ORDER BY seq`,
+		communityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	result, err := scanAgents(rows)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Agents retrieved",
+		zap.String("communityID", communityID), zap.Int("count", len(result)))
+	return result, nil
+}
+
+// すべてのエージェントを登録順に返す
+func (r *SQLiteAgentRepo) GetAll(
+	ctx context.Context,
+) ([]*entity.Agent, error) {
+	zap.L().Debug("GetAll agents called")
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+sqliteAgentColumns+` FROM agents ORDER BY seq`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	result, err := scanAgents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = make([]*entity.Agent, 0)
+	}
+	return result, nil
+}
+
+// コミュニティに属するエージェントをすべて削除する
+func (r *SQLiteAgentRepo) DeleteByCommunity(
+	ctx context.Context,
+	communityID string,
+) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM agents WHERE community_id = ?`, communityID)
+	if err != nil {
+		return fmt.Errorf("failed to delete agents: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	zap.L().Info("Agents deleted",
+		zap.String("communityID", communityID), zap.Int64("count", n))
+	return nil
+}
+
+var _ repository.AgentRepository = (*SQLiteAgentRepo)(nil)
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type SQLiteCommunityRepo struct {
+	db       sqlExecutor
+	versions *stagedVersions // トランザクション内なら、確定しなかった場合に戻す版
+}
+
+func NewSQLiteCommunityRepo(db *sql.DB) *SQLiteCommunityRepo {
+	zap.L().Debug("Initializing SQLiteCommunityRepo")
+	return &SQLiteCommunityRepo{db: db}
+}
+
+const sqliteCommunityColumns = `id, name, description, population, culture, updated_at, version, deleted_at`
+
+// 1行分をコミュニティに変換する
+func scanCommunity(row interface{ Scan(...any) error }) (*entity.Community, error) {
+	var (
+		c         entity.Community
+		updatedAt int64
+		deletedAt sql.NullInt64
+	)
+	if err := row.Scan(
+		&c.ID, &c.Name, &c.Description, &c.Population, &c.Culture, &updatedAt, &c.Version,
+		&deletedAt,
+	); err != nil {
+		return nil, err
+	}
+	c.UpdatedAt = fromUnixNano(updatedAt)
+	if deletedAt.Valid {
+		t := fromUnixNano(deletedAt.Int64)
+		c.DeletedAt = &t
+	}
+	return &c, nil
+}
+
+// DeletedAt を列の値に変換する（削除されていなければ NULL）
+func communityDeletedAt(c *entity.Community) sql.NullInt64 {
+	if c.DeletedAt == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: toUnixNano(*c.DeletedAt), Valid: true}
+}
+
+// IDでコミュニティを取得（ゴミ箱に入ったものは見つからない扱い）
+func (r *SQLiteCommunityRepo) GetByID(
+	ctx context.Context,
+	id string,
+) (*entity.Community, error) {
+	return r.getByID(ctx, id, false)
+}
+
+// ゴミ箱に入ったものも含めてIDでコミュニティを取得
+func (r *SQLiteCommunityRepo) GetByIDIncludingDeleted(
+	ctx context.Context,
+	id string,
+) (*entity.Community, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *SQLiteCommunityRepo) getByID(
+	ctx context.Context,
+	id string,
+	includeDeleted bool,
+) (*entity.Community, error) {
+	logger := zap.L()
+	logger.Debug("GetByID called", zap.String("communityID", id))
+
+	query := `SELECT ` + sqliteCommunityColumns + ` FROM communities WHERE id = ?`
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	c, err := scanCommunity(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("Community not found", zap.String("communityID", id))
+		return nil, repository.ErrCommunityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get community: %w", err)
+	}
+	return c, nil
+}
+
+// コミュニティを保存（既存なら更新、新規なら追加）
+// 読み込んだ後に他で更新されていれば競合エラー
+func (r *SQLiteCommunityRepo) Save(
+	ctx context.Context,
+	c *entity.Community,
+) error {
+	logger := zap.L()
+	logger.Debug("Saving community",
+		zap.String("communityID", c.ID), zap.Int("version", c.Version))
+
+	var (
+		res sql.Result
+		err error
+	)
+	if c.Version == 0 {
+		// 新規作成（版 0 のまま残っている既存行も上書きできる）
+		res, err = r.db.ExecContext(ctx, `INSERT INTO communities (`+sqliteCommunityColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, 1, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				name = excluded.name,
+				description = excluded.description,
+				population = excluded.population,
+				culture = excluded.culture,
+				updated_at = excluded.updated_at,
+				version = 1,
+				deleted_at = excluded.deleted_at
+			WHERE communities.version = 0`,
+			c.ID, c.Name, c.Description, c.Population, c.Culture, toUnixNano(c.UpdatedAt),
+			communityDeletedAt(c),
+		)
+	} else {
+		res, err = r.db.ExecContext(ctx, `UPDATE communities SET
+				name = ?, description = ?, population = ?, culture = ?,
+				updated_at = ?, version = version + 1, deleted_at = ?
+			WHERE id = ? AND version = ?`,
+			c.Name, c.Description, c.Population, c.Culture, toUnixNano(c.UpdatedAt),
+			communityDeletedAt(c), c.ID, c.Version,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save community: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save community: %w", err)
+	}
+	if n == 0 {
+		conflict := &repository.ConflictError{Entity: "community", ID: c.ID, Expected: c.Version}
+		if err := r.db.QueryRowContext(ctx,
+			`SELECT version FROM communities WHERE id = ?`, c.ID,
+		).Scan(&conflict.Actual); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to save community: %w", err)
+		}
+		logger.Warn("Community version conflict", zap.Error(conflict))
+		return conflict
+	}
+	r.versions.bump(c)
+	logger.Info("Community saved",
+		zap.String("communityID", c.ID), zap.Int("version", c.Version))
+	return nil
+}
+
+// 版を確認せずにそのまま書き込む（スナップショットの読み込み用）
+func (r *SQLiteCommunityRepo) put(
+	ctx context.Context,
+	c *entity.Community,
+) error {
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO communities (`+sqliteCommunityColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			description = excluded.description,
+			population = excluded.population,
+			culture = excluded.culture,
+			updated_at = excluded.updated_at,
+			version = excluded.version,
+			deleted_at = excluded.deleted_at`,
+		c.ID, c.Name, c.Description, c.Population, c.Culture, toUnixNano(c.UpdatedAt), c.Version,
+		communityDeletedAt(c),
+	); err != nil {
+		return fmt.Errorf("failed to save community: %w", err)
+	}
+	return nil
+}
+
+// 全コミュニティを ID 順に取得（ゴミ箱に入ったものは除く）
+func (r *SQLiteCommunityRepo) GetAll(
+	ctx context.Context,
+) ([]*entity.Community, error) {
+	zap.L().Debug("GetAll communities called")
+	return r.list(ctx, false)
+}
+
+// ゴミ箱に入ったものも含めて全コミュニティを ID 順に取得
+func (r *SQLiteCommunityRepo) GetAllIncludingDeleted(
+	ctx context.Context,
+) ([]*entity.Community, error) {
+	zap.L().Debug("GetAllIncludingDeleted communities called")
+	return r.list(ctx, true)
+}
+
+func (r *SQLiteCommunityRepo) list(
+	ctx context.Context,
+	includeDeleted bool,
+) ([]*entity.Community, error) {
+	query := `SELECT ` + sqliteCommunityColumns + ` FROM communities`
+	if !includeDeleted {
+		query += ` WHERE deleted_at IS NULL`
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get communities: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]*entity.Community, 0)
+	for rows.Next() {
+		c, err := scanCommunity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan community: %w", err)
+		}
+		result = append(result, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get communities: %w", err)
+	}
+	zap.L().Info("Retrieved all communities", zap.Int("count", len(result)))
+	return result, nil
+}
+
+// コミュニティを完全に削除
+func (r *SQLiteCommunityRepo) Delete(
+	ctx context.Context,
+	id string,
+) error {
+	logger := zap.L()
+	logger.Debug("Delete called", zap.String("communityID", id))
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM communities WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete community: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		logger.Warn("Community to delete not found", zap.String("communityID", id))
+		return repository.ErrCommunityNotFound
+	}
+	logger.Info("Community deleted", zap.String("communityID", id))
+	return nil
+}
+
+// インタフェース実装をチェック
+var _ repository.CommunityRepository = (*SQLiteCommunityRepo)(nil)
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type SQLiteCultureRevisionRepo struct {
+	db sqlExecutor
+}
+
+func NewSQLiteCultureRevisionRepo(db *sql.DB) *SQLiteCultureRevisionRepo {
+	zap.L().Debug("Initializing SQLiteCultureRevisionRepo")
+	return &SQLiteCultureRevisionRepo{db: db}
+}
+
+const sqliteCultureRevisionColumns = `community_id, revision, prev_culture, new_culture,
+	prev_population, population_delta, simulation_id, simulation_type, created_at`
+
+// 1行分を改訂に変換する
+func scanCultureRevision(row interface{ Scan(...any) error }) (*entity.CultureRevision, error) {
+	var (
+		r         entity.CultureRevision
+		createdAt int64
+	)
+	if err := row.Scan(
+		&r.CommunityID, &r.Revision, &r.PrevCulture, &r.NewCulture,
+		&r.PrevPopulation, &r.PopulationDelta, &r.SimulationID, &r.SimulationType,
+		&createdAt,
+	); err != nil {
+		return nil, err
+	}
+	r.CreatedAt = fromUnixNano(createdAt)
+	return &r, nil
+}
+
+// 改訂番号を採番して追記
+func (r *SQLiteCultureRevisionRepo) Append(
+	ctx context.Context,
+	rev *entity.CultureRevision,
+) error {
+	rev.CreatedAt = time.Now()
+	// 採番と挿入を1文で行い、同時実行でも番号が重複しないようにする
+	if err := r.db.QueryRowContext(ctx, `INSERT INTO culture_revisions
+		(`+sqliteCultureRevisionColumns+`)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ?, ?, ?
+		FROM culture_revisions WHERE community_id = ?
+		RETURNING revision`,
+		rev.CommunityID, rev.PrevCulture, rev.NewCulture,
+		rev.PrevPopulation, rev.PopulationDelta, rev.SimulationID, rev.SimulationType,
+		toUnixNano(rev.CreatedAt), rev.CommunityID,
+	).Scan(&rev.Revision); err != nil {
+		return fmt.Errorf("failed to append culture revision: %w", err)
+	}
+	zap.L().Info("Culture revision appended",
+		zap.String("communityID", rev.CommunityID), zap.Int("revision", rev.Revision))
+	return nil
+}
+
+// コミュニティの改訂履歴を古い順に取得
+func (r *SQLiteCultureRevisionRepo) GetByCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]*entity.CultureRevision, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+sqliteCultureRevisionColumns+`
+		FROM culture_revisions WHERE community_id = ? ORDER BY revision`, communityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get culture revisions: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]*entity.CultureRevision, 0)
+	for rows.Next() {
+		rev, err := scanCultureRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan culture revision: %w", err)
+		}
+		result = append(result, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get culture revisions: %w", err)
+	}
+	return result, nil
+}
+
+// 改訂番号を指定して取得
+func (r *SQLiteCultureRevisionRepo) GetByRevision(
+	ctx context.Context,
+	communityID string,
+	revision int,
+) (*entity.CultureRevision, error) {
+	rev, err := scanCultureRevision(r.db.QueryRowContext(ctx,
+		`SELECT `+sqliteCultureRevisionColumns+`
+		FROM culture_revisions WHERE community_id = ? AND revision = ?`,
+		communityID, revision))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get culture revision: %w", err)
+	}
+	return rev, nil
+}
+
+// コミュニティの改訂履歴をすべて削除
+func (r *SQLiteCultureRevisionRepo) DeleteByCommunity(
+	ctx context.Context,
+	communityID string,
+) error {
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM culture_revisions WHERE community_id = ?`, communityID,
+	); err != nil {
+		return fmt.Errorf("failed to delete culture revisions: %w", err)
+	}
+	zap.L().Info("Culture revisions deleted", zap.String("communityID", communityID))
+	return nil
+}
+
+var _ repository.CultureRevisionRepository = (*SQLiteCultureRevisionRepo)(nil)
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // cgo 不要の SQLite ドライバ
+)
+
+// *sql.DB と *sql.Tx の共通部分
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// スキーマのマイグレーション
+// 適用済みの要素は書き換えず、変更は必ず末尾に追加すること
+var sqliteMigrations = []string{
+	// 1: 初期スキーマ
+	`CREATE TABLE communities (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		population  INTEGER NOT NULL DEFAULT 0,
+		culture     TEXT NOT NULL DEFAULT '',
+		updated_at  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE agents (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT NOT NULL UNIQUE,
+		name         TEXT NOT NULL,
+		community_id TEXT NOT NULL,
+		personality  TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX idx_agents_community_id ON agents (community_id);
+	CREATE TABLE simulations (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		id          TEXT NOT NULL UNIQUE,
+		type        TEXT NOT NULL,
+		communities TEXT NOT NULL DEFAULT '[]',
+		result_json TEXT NOT NULL DEFAULT '',
+		created_at  INTEGER NOT NULL
+	);`,
+	// 2: 文化の改訂履歴
+	`CREATE TABLE culture_revisions (
+		community_id     TEXT NOT NULL,
+		revision         INTEGER NOT NULL,
+		prev_culture     TEXT NOT NULL,
+		new_culture      TEXT NOT NULL,
+		prev_population  INTEGER NOT NULL,
+		population_delta INTEGER NOT NULL,
+		simulation_id    TEXT NOT NULL DEFAULT '',
+		simulation_type  TEXT NOT NULL DEFAULT '',
+		created_at       INTEGER NOT NULL,
+		PRIMARY KEY (community_id, revision)
+	);`,
+	// 3: ドメインイベントのログ
+	`CREATE TABLE events (
+		seq           INTEGER PRIMARY KEY AUTOINCREMENT,
+		type          TEXT NOT NULL,
+		aggregate_id  TEXT NOT NULL DEFAULT '',
+		simulation_id TEXT NOT NULL DEFAULT '',
+		payload       TEXT NOT NULL,
+		occurred_at   INTEGER NOT NULL
+	);`,
+	// 4: 楽観的排他制御用の版
+	`ALTER TABLE communities ADD COLUMN version INTEGER NOT NULL DEFAULT 0;`,
+	// 5: ゴミ箱（削除されていなければ NULL）
+	`ALTER TABLE communities ADD COLUMN deleted_at INTEGER;`,
+	// 6: シミュレーション履歴を新しい順に引くための索引
+	`CREATE INDEX idx_simulations_created_at ON simulations (created_at, id);`,
+	// 7: シミュレーションごとの LLM とのやり取り
+	`CREATE TABLE transcripts (
+		simulation_id TEXT PRIMARY KEY,
+		exchanges     TEXT NOT NULL,
+		created_at    INTEGER NOT NULL
+	);`,
+	// 8: シミュレーションごとの LLM の利用量
+	`CREATE TABLE llm_usage (
+		seq               INTEGER PRIMARY KEY AUTOINCREMENT,
+		id                TEXT NOT NULL UNIQUE,
+		simulation_id     TEXT NOT NULL DEFAULT '',
+		simulation_type   TEXT NOT NULL DEFAULT '',
+		communities       TEXT NOT NULL DEFAULT '[]',
+		calls             INTEGER NOT NULL,
+		prompt_tokens     INTEGER NOT NULL,
+		completion_tokens INTEGER NOT NULL,
+		cost_usd          REAL NOT NULL,
+		by_model          TEXT NOT NULL DEFAULT '{}',
+		created_at        INTEGER NOT NULL
+	);
+	CREATE INDEX idx_llm_usage_created_at ON llm_usage (created_at);
+	CREATE INDEX idx_llm_usage_simulation_id ON llm_usage (simulation_id);`,
+}
+
+// SQLite ファイルを開き、未適用のマイグレーションを適用する
+func OpenSQLite(
+	ctx context.Context,
+	path string,
+) (*sql.DB, error) {
+	logger := zap.L()
+
+	// 読んでから書くトランザクションが途中で SQLITE_BUSY にならないよう、
+	// トランザクションは最初から書き込みロックを取る (BEGIN IMMEDIATE)
+	dsn := fmt.Sprintf(
+		"file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate",
+		path,
+	)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect sqlite: %w", err)
+	}
+
+	if err := migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logger.Info("SQLite opened", zap.String("path", path))
+	return db, nil
+}
+
+// schema_migrations に記録されていないマイグレーションを順に適用する
+func migrateSQLite(
+	ctx context.Context,
+	db *sql.DB,
+) error {
+	logger := zap.L()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`,
+	).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UnixNano(),
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+		logger.Info("SQLite migration applied", zap.Int("version", version))
+	}
+	return nil
+}
+
+// time.Time を INTEGER カラム用の値に変換する（ゼロ値は 0）
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// INTEGER カラムの値を time.Time に戻す（0 はゼロ値）
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,40 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/infrastructure/repository"
+)
+
+// 開き直しても保存した内容が残り、適用済みのマイグレーションは再適用しない
+func TestOpenSQLiteReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "zousui.db")
+
+	db, err := repository.OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	if err := repository.NewSQLiteCommunityRepo(db).Save(ctx, &entity.Community{
+		ID: "c1", Name: "川の民", Population: 100,
+	}); err != nil {
+		t.Fatalf("failed to save community: %v", err)
+	}
+	db.Close()
+
+	db, err = repository.OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatalf("failed to reopen sqlite: %v", err)
+	}
+	defer db.Close()
+	c, err := repository.NewSQLiteCommunityRepo(db).GetByID(ctx, "c1")
+	if err != nil {
+		t.Fatalf("failed to get community: %v", err)
+	}
+	if c.Name != "川の民" || c.Population != 100 || c.Version != 1 {
+		t.Errorf("community = %+v after reopening", c)
+	}
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type SQLiteEventStore struct {
+	db sqlExecutor
+}
+
+func NewSQLiteEventStore(db *sql.DB) *SQLiteEventStore {
+	zap.L().Debug("Initializing SQLiteEventStore")
+	return &SQLiteEventStore{db: db}
+}
+
+// 通し番号を採番して追記
+func (r *SQLiteEventStore) Append(
+	ctx context.Context,
+	events ...*entity.DomainEvent,
+) error {
+	for _, e := range events {
+		if e.OccurredAt.IsZero() {
+			e.OccurredAt = time.Now()
+		}
+		if err := r.db.QueryRowContext(ctx, `INSERT INTO events
+			(type, aggregate_id, simulation_id, payload, occurred_at)
+			VALUES (?, ?, ?, ?, ?) RETURNING seq`,
+			string(e.Type), e.AggregateID, e.SimulationID, string(e.Payload),
+			toUnixNano(e.OccurredAt),
+		).Scan(&e.Seq); err != nil {
+			return fmt.Errorf("failed to append event: %w", err)
+		}
+		zap.L().Debug("Event appended",
+			zap.Int64("seq", e.Seq), zap.String("type", string(e.Type)))
+	}
+	return nil
+}
+
+// 範囲を指定してイベントを古い順に取得
+func (r *SQLiteEventStore) List(
+	ctx context.Context,
+	afterSeq, untilSeq int64,
+) ([]*entity.DomainEvent, error) {
+	query := `SELECT seq, type, aggregate_id, simulation_id, payload, occurred_at
+		FROM events WHERE seq > ?`
+	args := []any{afterSeq}
+	if untilSeq > 0 {
+		query += ` AND seq <= ?`
+		args = append(args, untilSeq)
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]*entity.DomainEvent, 0)
+	for rows.Next() {
+		var (
+			e          entity.DomainEvent
+			eventType  string
+			payload    string
+			occurredAt int64
+		)
+		if err := rows.Scan(
+			&e.Seq, &eventType, &e.AggregateID, &e.SimulationID, &payload, &occurredAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		e.Type = entity.DomainEventType(eventType)
+		e.Payload = []byte(payload)
+		e.OccurredAt = fromUnixNano(occurredAt)
+		result = append(result, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	return result, nil
+}
+
+var _ repository.EventStore = (*SQLiteEventStore)(nil)
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type SQLiteLLMUsageRepo struct {
+	db sqlExecutor
+}
+
+func NewSQLiteLLMUsageRepo(db *sql.DB) *SQLiteLLMUsageRepo {
+	zap.L().Debug("Initializing SQLiteLLMUsageRepo")
+	return &SQLiteLLMUsageRepo{db: db}
+}
+
+// 利用量の記録を追加
+func (r *SQLiteLLMUsageRepo) Save(
+	ctx context.Context,
+	record *entity.LLMUsageRecord,
+) error {
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+	record.CreatedAt = time.Now()
+
+	communities, err := json.Marshal(record.Communities)
+	if err != nil {
+		return fmt.Errorf("failed to marshal communities: %w", err)
+	}
+	byModel, err := json.Marshal(record.ByModel)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage by model: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO llm_usage
+		(id, simulation_id, simulation_type, communities, calls, prompt_tokens,
+			completion_tokens, cost_usd, by_model, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.ID, record.SimulationID, record.SimulationType, string(communities),
+		record.Usage.Calls, record.Usage.PromptTokens, record.Usage.CompletionTokens,
+		record.Usage.CostUSD, string(byModel), toUnixNano(record.CreatedAt),
+	); err != nil {
+		return fmt.Errorf("failed to save llm usage: %w", err)
+	}
+	return nil
+}
+
+// 条件に合う記録を古い順に返す
+func (r *SQLiteLLMUsageRepo) Find(
+	ctx context.Context,
+	q repository.LLMUsageQuery,
+) ([]*entity.LLMUsageRecord, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if q.SimulationID != "" {
+		where = append(where, `simulation_id = ?`)
+		args = append(args, q.SimulationID)
+	}
+	if q.CommunityID != "" {
+		where = append(where,
+			`EXISTS (SELECT 1 FROM json_each(llm_usage.communities) WHERE value = ?)`)
+		args = append(args, q.CommunityID)
+	}
+	if !q.From.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, toUnixNano(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, toUnixNano(q.To))
+	}
+
+	query := `SELECT id, simulation_id, simulation_type, communities, calls, prompt_tokens,
+		completion_tokens, cost_usd, by_model, created_at FROM llm_usage`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY seq`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get llm usage: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]*entity.LLMUsageRecord, 0)
+	for rows.Next() {
+		var (
+			u                    entity.LLMUsageRecord
+			communities, byModel string
+			createdAt            int64
+		)
+		if err := rows.Scan(&u.ID, &u.SimulationID, &u.SimulationType, &communities,
+			&u.Usage.Calls, &u.Usage.PromptTokens, &u.Usage.CompletionTokens,
+			&u.Usage.CostUSD, &byModel, &createdAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan llm usage: %w", err)
+		}
+		if err := json.Unmarshal([]byte(communities), &u.Communities); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal communities: %w", err)
+		}
+		if err := json.Unmarshal([]byte(byModel), &u.ByModel); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal usage by model: %w", err)
+		}
+		u.Usage.TotalTokens = u.Usage.PromptTokens + u.Usage.CompletionTokens
+		u.CreatedAt = fromUnixNano(createdAt)
+		result = append(result, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get llm usage: %w", err)
+	}
+	return result, nil
+}
+
+var _ repository.LLMUsageRepository = (*SQLiteLLMUsageRepo)(nil)
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+type SQLiteSimulationRepo struct {
+	db sqlExecutor
+}
+
+func NewSQLiteSimulationRepo(db *sql.DB) *SQLiteSimulationRepo {
+	return &SQLiteSimulationRepo{db: db}
+}
+
+func (r *SQLiteSimulationRepo) Save(ctx context.Context, result *entity.SimulationResult) error {
+	// ID 自動生成（ここでは UUID を利用）。呼び出し側で採番済みならそれを使う
+	if result.ID == "" {
+		result.ID = uuid.New().String()
+	}
+	result.CreatedAt = time.Now()
+
+	communities, err := json.Marshal(result.Communities)
+	if err != nil {
+		return fmt.Errorf("failed to marshal communities: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO simulations
+		(id, type, communities, result_json, created_at) VALUES (?, ?, ?, ?, ?)`,
+		result.ID, result.Type, string(communities), result.ResultJSON,
+		toUnixNano(result.CreatedAt),
+	); err != nil {
+		return fmt.Errorf("failed to save simulation: %w", err)
+	}
+	return nil
+}
+
+const sqliteSimulationColumns = `id, type, communities, result_json, created_at`
+
+// 1行分をシミュレーション結果に変換する
+func scanSimulation(row interface{ Scan(...any) error }) (*entity.SimulationResult, error) {
+	var (
+		s           entity.SimulationResult
+		communities string
+		createdAt   int64
+	)
+	if err := row.Scan(
+		&s.ID, &s.Type, &communities, &s.ResultJSON, &createdAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(communities), &s.Communities); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal communities: %w", err)
+	}
+	s.CreatedAt = fromUnixNano(createdAt)
+	return &s, nil
+}
+
+func (r *SQLiteSimulationRepo) query(
+	ctx context.Context,
+	query string,
+	args ...any,
+) ([]*entity.SimulationResult, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get simulations: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]*entity.SimulationResult, 0)
+	for rows.Next() {
+		s, err := scanSimulation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan simulation: %w", err)
+		}
+		result = append(result, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get simulations: %w", err)
+	}
+	return result, nil
+}
+
+// 保存した順に全件を返す
+func (r *SQLiteSimulationRepo) GetAll(ctx context.Context) ([]*entity.SimulationResult, error) {
+	return r.query(ctx, `SELECT `+sqliteSimulationColumns+` FROM simulations ORDER BY seq`)
+}
+
+// ID でシミュレーション結果を取得
+func (r *SQLiteSimulationRepo) GetByID(ctx context.Context, id string) (*entity.SimulationResult, error) {
+	s, err := scanSimulation(r.db.QueryRowContext(ctx,
+		`SELECT `+sqliteSimulationColumns+` FROM simulations WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrSimulationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get simulation: %w", err)
+	}
+	return s, nil
+}
+
+// 条件に合う結果を新しい順に取得
+func (r *SQLiteSimulationRepo) Find(
+	ctx context.Context,
+	q repository.SimulationQuery,
+) (*repository.SimulationPage, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if q.CommunityID != "" {
+		where = append(where,
+			`EXISTS (SELECT 1 FROM json_each(simulations.communities) WHERE value = ?)`)
+		args = append(args, q.CommunityID)
+	}
+	if q.Type != "" {
+		where = append(where, `type = ?`)
+		args = append(args, q.Type)
+	}
+	if !q.From.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, toUnixNano(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, toUnixNano(q.To))
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeSimulationCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, `(created_at < ? OR (created_at = ? AND id < ?))`)
+		args = append(args, cursor.createdAt, cursor.createdAt, cursor.id)
+	}
+
+	query := `SELECT ` + sqliteSimulationColumns + ` FROM simulations`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if q.Limit > 0 {
+		// 続きがあるか判定するため 1 件多く取る
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	simulations, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	page := &repository.SimulationPage{Simulations: simulations}
+	if q.Limit > 0 && len(simulations) > q.Limit {
+		page.Simulations = simulations[:q.Limit]
+		page.NextCursor = encodeSimulationCursor(page.Simulations[q.Limit-1])
+	}
+	return page, nil
+}
+
+// 各結果の関連コミュニティと変化から communityID を外す
+// 関連コミュニティがなくなる結果は削除し、その ID を返す
+func (r *SQLiteSimulationRepo) RemoveCommunity(
+	ctx context.Context,
+	communityID string,
+) ([]string, error) {
+	affected, err := r.query(ctx, `SELECT `+sqliteSimulationColumns+` FROM simulations
+		WHERE EXISTS (SELECT 1 FROM json_each(simulations.communities) WHERE value = ?)`,
+		communityID)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, s := range affected {
+		cp := s.WithoutCommunity(communityID)
+		if cp == nil {
+			if _, err := r.db.ExecContext(ctx,
+				`DELETE FROM simulations WHERE id = ?`, s.ID,
+			); err != nil {
+				return nil, fmt.Errorf("failed to delete simulation: %w", err)
+			}
+			removed = append(removed, s.ID)
+			continue
+		}
+		communities, err := json.Marshal(cp.Communities)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal communities: %w", err)
+		}
+		if _, err := r.db.ExecContext(ctx,
+			`UPDATE simulations SET communities = ?, result_json = ? WHERE id = ?`,
+			string(communities), cp.ResultJSON, s.ID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to update simulation: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+var _ repository.SimulationRepository = (*SQLiteSimulationRepo)(nil)
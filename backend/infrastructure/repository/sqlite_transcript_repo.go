@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type SQLiteTranscriptRepo struct {
+	db sqlExecutor
+}
+
+func NewSQLiteTranscriptRepo(db *sql.DB) *SQLiteTranscriptRepo {
+	zap.L().Debug("Initializing SQLiteTranscriptRepo")
+	return &SQLiteTranscriptRepo{db: db}
+}
+
+// シミュレーションの記録を保存（既存なら置き換え）
+func (r *SQLiteTranscriptRepo) Save(
+	ctx context.Context,
+	t *entity.Transcript,
+) error {
+	exchanges, err := json.Marshal(t.Exchanges)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO transcripts
+		(simulation_id, exchanges, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (simulation_id) DO UPDATE SET
+			exchanges = excluded.exchanges,
+			created_at = excluded.created_at`,
+		t.SimulationID, string(exchanges), toUnixNano(t.CreatedAt),
+	); err != nil {
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+	zap.L().Debug("Transcript saved",
+		zap.String("simulationID", t.SimulationID), zap.Int("exchanges", len(t.Exchanges)))
+	return nil
+}
+
+// シミュレーションIDで記録を取得
+func (r *SQLiteTranscriptRepo) GetBySimulation(
+	ctx context.Context,
+	simulationID string,
+) (*entity.Transcript, error) {
+	var (
+		exchanges string
+		createdAt int64
+	)
+	err := r.db.QueryRowContext(ctx,
+		`SELECT exchanges, created_at FROM transcripts WHERE simulation_id = ?`,
+		simulationID,
+	).Scan(&exchanges, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrTranscriptNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transcript: %w", err)
+	}
+	t := &entity.Transcript{
+		SimulationID: simulationID,
+		CreatedAt:    fromUnixNano(createdAt),
+	}
+	if err := json.Unmarshal([]byte(exchanges), &t.Exchanges); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transcript: %w", err)
+	}
+	return t, nil
+}
+
+// 削除したシミュレーションの記録を削除
+func (r *SQLiteTranscriptRepo) DeleteBySimulations(
+	ctx context.Context,
+	simulationIDs []string,
+) error {
+	for _, id := range simulationIDs {
+		if _, err := r.db.ExecContext(ctx,
+			`DELETE FROM transcripts WHERE simulation_id = ?`, id,
+		); err != nil {
+			return fmt.Errorf("failed to delete transcript: %w", err)
+		}
+	}
+	return nil
+}
+
+var _ repository.TranscriptRepository = (*SQLiteTranscriptRepo)(nil)
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// 1つの SQLite トランザクションで各リポジトリへの書き込みを確定する
+// トランザクションは BEGIN IMMEDIATE で始まる（OpenSQLite の _txlock）ので、
+// 書き込み同士は開始時に順番待ちになる。待ちきれなかった場合は競合として扱う
+type SQLiteUnitOfWork struct {
+	db *sql.DB
+}
+
+func NewSQLiteUnitOfWork(db *sql.DB) *SQLiteUnitOfWork {
+	zap.L().Debug("Initializing SQLiteUnitOfWork")
+	return &SQLiteUnitOfWork{db: db}
+}
+
+func (u *SQLiteUnitOfWork) Do(
+	ctx context.Context,
+	fn func(ctx context.Context, repos repository.TxRepositories) error,
+) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return busyAsConflict(fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback()
+
+	versions := &stagedVersions{}
+	if err := fn(ctx, repository.TxRepositories{
+		Communities: &SQLiteCommunityRepo{db: tx, versions: versions},
+		Agents:      &SQLiteAgentRepo{db: tx},
+		Simulations: &SQLiteSimulationRepo{db: tx},
+		Revisions:   &SQLiteCultureRevisionRepo{db: tx},
+		Events:      &SQLiteEventStore{db: tx},
+		Transcripts: &SQLiteTranscriptRepo{db: tx},
+		World:       &SQLiteWorldRepo{tx: tx},
+	}); err != nil {
+		zap.L().Debug("SQLite transaction rolled back", zap.Error(err))
+		versions.restore()
+		return busyAsConflict(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		versions.restore()
+		return busyAsConflict(fmt.Errorf("failed to commit transaction: %w", err))
+	}
+	return nil
+}
+
+// busyAsConflict: busy_timeout を過ぎてもロックを取れなかったエラーを、
+// 再試行すればよい競合 (repository.ErrVersionConflict) にする
+func busyAsConflict(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	// 拡張エラーコードの下位 8 ビットが基本のエラーコード
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		zap.L().Warn("SQLite database is busy", zap.Error(err))
+		return fmt.Errorf("%w: database is busy: %w", repository.ErrVersionConflict, err)
+	default:
+		return err
+	}
+}
+
+var _ repository.UnitOfWork = (*SQLiteUnitOfWork)(nil)
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// 各テーブルをまとめてスナップショットとして読み書きする
+type SQLiteWorldRepo struct {
+	db *sql.DB
+	tx *sql.Tx // UnitOfWork のトランザクション内で使う場合だけ設定する
+}
+
+func NewSQLiteWorldRepo(db *sql.DB) *SQLiteWorldRepo {
+	zap.L().Debug("Initializing SQLiteWorldRepo")
+	return &SQLiteWorldRepo{db: db}
+}
+
+// ワールド全体をスナップショットとして書き出す（1つの読み取りトランザクション内で行う）
+func (r *SQLiteWorldRepo) Export(
+	ctx context.Context,
+) (*entity.WorldSnapshot, error) {
+	tx := r.tx
+	if tx == nil {
+		var err error
+		if tx, err = r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+			return nil, fmt.Errorf("failed to begin export: %w", err)
+		}
+		defer tx.Rollback()
+	}
+
+	communities, err := (&SQLiteCommunityRepo{db: tx}).GetAllIncludingDeleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	agents, err := (&SQLiteAgentRepo{db: tx}).GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	simulations, err := (&SQLiteSimulationRepo{db: tx}).GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+sqliteCultureRevisionColumns+`
+		FROM culture_revisions ORDER BY community_id, revision`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get culture revisions: %w", err)
+	}
+	defer rows.Close()
+	revisions := make([]*entity.CultureRevision, 0)
+	for rows.Next() {
+		rev, err := scanCultureRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan culture revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get culture revisions: %w", err)
+	}
+
+	zap.L().Info("World exported",
+		zap.Int("communities", len(communities)),
+		zap.Int("agents", len(agents)),
+		zap.Int("simulations", len(simulations)))
+	return &entity.WorldSnapshot{
+		FormatVersion: entity.WorldSnapshotFormatVersion,
+		ExportedAt:    time.Now(),
+		Communities:   communities,
+		Agents:        agents,
+		Simulations:   simulations,
+		Revisions:     revisions,
+	}, nil
+}
+
+// スナップショットを1つのトランザクションで取り込む
+// UnitOfWork のトランザクション内では、その確定を待って反映する
+func (r *SQLiteWorldRepo) Import(
+	ctx context.Context,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) error {
+	if mode != entity.WorldImportReplace && mode != entity.WorldImportMerge {
+		return fmt.Errorf("unknown import mode: %s", mode)
+	}
+	if r.tx != nil {
+		return importSQLiteWorld(ctx, r.tx, snapshot, mode)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+	if err := importSQLiteWorld(ctx, tx, snapshot, mode); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+	zap.L().Info("World imported", zap.String("mode", string(mode)),
+		zap.Int("communities", len(snapshot.Communities)),
+		zap.Int("agents", len(snapshot.Agents)),
+		zap.Int("simulations", len(snapshot.Simulations)))
+	return nil
+}
+
+// importSQLiteWorld: tx 内でスナップショットを書き込む（確定は呼び出し側が行う）
+func importSQLiteWorld(
+	ctx context.Context,
+	tx *sql.Tx,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) error {
+
+	if mode == entity.WorldImportReplace {
+		for _, table := range []string{
+			"culture_revisions", "simulations", "agents", "communities",
+		} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table, err)
+			}
+		}
+	}
+
+	communityRepo := &SQLiteCommunityRepo{db: tx}
+	for _, c := range snapshot.Communities {
+		if err := communityRepo.put(ctx, c); err != nil {
+			return err
+		}
+	}
+	agentRepo := &SQLiteAgentRepo{db: tx}
+	for _, a := range snapshot.Agents {
+		if err := agentRepo.Save(ctx, a); err != nil {
+			return err
+		}
+	}
+	// 履歴は ID と日時を保ったまま書き込む
+	for _, s := range snapshot.Simulations {
+		communities, err := json.Marshal(s.Communities)
+		if err != nil {
+			return fmt.Errorf("failed to marshal communities: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO simulations
+			(id, type, communities, result_json, created_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				type = excluded.type,
+				communities = excluded.communities,
+				result_json = excluded.result_json,
+				created_at = excluded.created_at`,
+			s.ID, s.Type, string(communities), s.ResultJSON, toUnixNano(s.CreatedAt),
+		); err != nil {
+			return fmt.Errorf("failed to import simulation: %w", err)
+		}
+	}
+	for _, rev := range snapshot.Revisions {
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO culture_revisions
+			(`+sqliteCultureRevisionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rev.CommunityID, rev.Revision, rev.PrevCulture, rev.NewCulture,
+			rev.PrevPopulation, rev.PopulationDelta, rev.SimulationID,
+			rev.SimulationType, toUnixNano(rev.CreatedAt),
+		); err != nil {
+			return fmt.Errorf("failed to import culture revision: %w", err)
+		}
+	}
+
+	// 改訂番号は連番であることを前提にしているため、欠番を許さない
+	var gapped string
+	err := tx.QueryRowContext(ctx, `SELECT community_id FROM culture_revisions
+		GROUP BY community_id HAVING MAX(revision) != COUNT(*) LIMIT 1`).Scan(&gapped)
+	if err == nil {
+		return fmt.Errorf("%w: revisions of community %s are not sequential",
+			entity.ErrInvalidWorldSnapshot, gapped)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check culture revisions: %w", err)
+	}
+	return nil
+}
+
+var _ repository.WorldRepository = (*SQLiteWorldRepo)(nil)
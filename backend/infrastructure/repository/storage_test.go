@@ -0,0 +1,78 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/infrastructure/repository"
+)
+
+// テストで使うリポジトリ一式
+// メモリ実装と SQLite 実装で同じテストを通し、振る舞いが揃っていることを確かめる
+type testStorage struct {
+	communities domainrepo.CommunityRepository
+	agents      domainrepo.AgentRepository
+	simulations domainrepo.SimulationRepository
+	revisions   domainrepo.CultureRevisionRepository
+	events      domainrepo.EventStore
+	transcripts domainrepo.TranscriptRepository
+	usage       domainrepo.LLMUsageRepository
+	uow         domainrepo.UnitOfWork
+}
+
+func newMemoryStorage(t *testing.T) *testStorage {
+	t.Helper()
+	cr := repository.NewMemoryCommunityRepo()
+	ar := repository.NewMemoryAgentRepo()
+	sr := repository.NewMemorySimulationRepo()
+	rr := repository.NewMemoryCultureRevisionRepo()
+	es := repository.NewMemoryEventStore()
+	tr := repository.NewMemoryTranscriptRepo()
+	return &testStorage{
+		communities: cr,
+		agents:      ar,
+		simulations: sr,
+		revisions:   rr,
+		events:      es,
+		transcripts: tr,
+		usage:       repository.NewMemoryLLMUsageRepo(),
+		uow:         repository.NewMemoryUnitOfWork(cr, ar, sr, rr, es, tr),
+	}
+}
+
+func newSQLiteStorage(t *testing.T) *testStorage {
+	t.Helper()
+	db, err := repository.OpenSQLite(context.Background(),
+		filepath.Join(t.TempDir(), "zousui.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &testStorage{
+		communities: repository.NewSQLiteCommunityRepo(db),
+		agents:      repository.NewSQLiteAgentRepo(db),
+		simulations: repository.NewSQLiteSimulationRepo(db),
+		revisions:   repository.NewSQLiteCultureRevisionRepo(db),
+		events:      repository.NewSQLiteEventStore(db),
+		transcripts: repository.NewSQLiteTranscriptRepo(db),
+		usage:       repository.NewSQLiteLLMUsageRepo(db),
+		uow:         repository.NewSQLiteUnitOfWork(db),
+	}
+}
+
+var storages = map[string]func(t *testing.T) *testStorage{
+	"memory": newMemoryStorage,
+	"sqlite": newSQLiteStorage,
+}
+
+// forEachStorage: 各実装で fn を実行する
+func forEachStorage(t *testing.T, fn func(t *testing.T, s *testStorage)) {
+	t.Helper()
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			fn(t, newStorage(t))
+		})
+	}
+}
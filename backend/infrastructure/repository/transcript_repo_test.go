@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// 指定したシミュレーションの記録だけを削除する（存在しない ID は無視する）
+func TestTranscriptRepoDeleteBySimulations(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for _, id := range []string{"s1", "s2", "s3"} {
+			if err := s.transcripts.Save(ctx, &entity.Transcript{SimulationID: id}); err != nil {
+				t.Fatalf("failed to save transcript: %v", err)
+			}
+		}
+		if err := s.transcripts.DeleteBySimulations(
+			ctx, []string{"s1", "s3", "missing"}); err != nil {
+			t.Fatalf("failed to delete transcripts: %v", err)
+		}
+		for id, wantFound := range map[string]bool{"s1": false, "s2": true, "s3": false} {
+			_, err := s.transcripts.GetBySimulation(ctx, id)
+			if found := err == nil; found != wantFound {
+				t.Errorf("%s: found = %v (%v), want %v", id, found, err, wantFound)
+			}
+			if err != nil && !errors.Is(err, domainrepo.ErrTranscriptNotFound) {
+				t.Errorf("%s: error = %v, want %v", id, err, domainrepo.ErrTranscriptNotFound)
+			}
+		}
+	})
+}
+
+// やり取りの内容をそのまま読み戻せ、同じシミュレーションへの保存は置き換える
+func TestTranscriptRepoSaveAndGet(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		startedAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		sampling := entity.NewLLMSampling(0.2)
+		chosen := 1
+		transcript := &entity.Transcript{
+			SimulationID: "s1",
+			CreatedAt:    startedAt.Add(time.Minute),
+			Exchanges: []*entity.LLMExchange{
+				{Seq: 1, Gateway: "multi", System: "システム", Prompt: "問い合わせ",
+					UserInput: "入力", Response: `{"newCulture":"祭り"}`, StartedAt: startedAt,
+					LatencyMs: 1200, Sampling: &sampling, AnsweredBy: "gemini",
+					Aggregation: &entity.LLMAggregation{
+						Strategy: entity.LLMAggregateFirstValid, Chosen: &chosen, Note: "note",
+						Candidates: []entity.LLMCandidate{
+							{Gateway: "a", Error: "boom", LatencyMs: 5, TimedOut: true},
+							{Gateway: "b", Response: "ok", Valid: true, LatencyMs: 7},
+						},
+					}},
+				{Seq: 2, ParentSeq: 1, Stage: entity.LLMStageRepair, Gateway: "gemini",
+					Model: "gemini-2.0-flash", Prompt: "直して", Error: "failed",
+					StartedAt: startedAt, Cached: true, PromptTokens: 10, CompletionTokens: 5,
+					CostUSD: 0.0125},
+			},
+		}
+		if err := s.transcripts.Save(ctx, transcript); err != nil {
+			t.Fatalf("failed to save transcript: %v", err)
+		}
+
+		got, err := s.transcripts.GetBySimulation(ctx, "s1")
+		if err != nil {
+			t.Fatalf("failed to get transcript: %v", err)
+		}
+		gotJSON, _ := json.Marshal(got.Exchanges)
+		wantJSON, _ := json.Marshal(transcript.Exchanges)
+		if got.SimulationID != "s1" || !got.CreatedAt.Equal(transcript.CreatedAt) ||
+			string(gotJSON) != string(wantJSON) {
+			t.Errorf("transcript = %s at %v, want %s at %v",
+				gotJSON, got.CreatedAt, wantJSON, transcript.CreatedAt)
+		}
+
+		if err := s.transcripts.Save(ctx, &entity.Transcript{
+			SimulationID: "s1", Exchanges: transcript.Exchanges[:1],
+		}); err != nil {
+			t.Fatalf("failed to replace transcript: %v", err)
+		}
+		if got, _ := s.transcripts.GetBySimulation(ctx, "s1"); len(got.Exchanges) != 1 {
+			t.Errorf("replaced transcript has %d exchanges, want 1", len(got.Exchanges))
+		}
+		if _, err := s.transcripts.GetBySimulation(ctx, "missing"); !errors.Is(
+			err, domainrepo.ErrTranscriptNotFound) {
+			t.Errorf("error = %v, want %v", err, domainrepo.ErrTranscriptNotFound)
+		}
+	})
+}
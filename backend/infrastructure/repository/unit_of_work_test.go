@@ -0,0 +1,333 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// stageWorld: トランザクション内で各リポジトリに1件ずつ書き込み、同じトランザクションから読めることを確かめる
+func stageWorld(
+	t *testing.T,
+	ctx context.Context,
+	repos domainrepo.TxRepositories,
+	c *entity.Community,
+) {
+	t.Helper()
+	if err := repos.Communities.Save(ctx, c); err != nil {
+		t.Fatalf("failed to save community: %v", err)
+	}
+	if err := repos.Agents.Save(ctx, &entity.Agent{ID: "a1", Name: "長老",
+		CommunityID: c.ID}); err != nil {
+		t.Fatalf("failed to save agent: %v", err)
+	}
+	if err := repos.Simulations.Save(ctx, &entity.SimulationResult{ID: "s1",
+		Type: entity.SimulationTypeCultureEvolution, Communities: []string{c.ID}}); err != nil {
+		t.Fatalf("failed to save simulation: %v", err)
+	}
+	if err := repos.Revisions.Append(ctx, &entity.CultureRevision{CommunityID: c.ID,
+		NewCulture: c.Culture}); err != nil {
+		t.Fatalf("failed to append revision: %v", err)
+	}
+	if err := repos.Events.Append(ctx, &entity.DomainEvent{
+		Type: entity.EventCommunityCreated, AggregateID: c.ID, Payload: []byte(`{}`),
+	}); err != nil {
+		t.Fatalf("failed to append event: %v", err)
+	}
+	if err := repos.Transcripts.Save(ctx, &entity.Transcript{SimulationID: "s1"}); err != nil {
+		t.Fatalf("failed to save transcript: %v", err)
+	}
+
+	if got, err := repos.Communities.GetByID(ctx, c.ID); err != nil || got.Culture != c.Culture {
+		t.Errorf("community in tx = %+v, %v", got, err)
+	}
+	if _, err := repos.Agents.GetByID(ctx, "a1"); err != nil {
+		t.Errorf("agent in tx: %v", err)
+	}
+	if _, err := repos.Simulations.GetByID(ctx, "s1"); err != nil {
+		t.Errorf("simulation in tx: %v", err)
+	}
+	if _, err := repos.Revisions.GetByRevision(ctx, c.ID, 1); err != nil {
+		t.Errorf("revision in tx: %v", err)
+	}
+	if _, err := repos.Transcripts.GetBySimulation(ctx, "s1"); err != nil {
+		t.Errorf("transcript in tx: %v", err)
+	}
+}
+
+// fn が nil を返したときだけ、すべての書き込みを確定する
+func TestUnitOfWorkCommit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		c := &entity.Community{ID: "c1", Name: "川の民", Culture: "漁業"}
+		if err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			stageWorld(t, ctx, repos, c)
+			return nil
+		}); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+
+		if got, err := s.communities.GetByID(ctx, "c1"); err != nil || got.Version != 1 {
+			t.Errorf("community = %+v, %v; want version 1", got, err)
+		}
+		if c.Version != 1 {
+			t.Errorf("caller's version = %d, want 1", c.Version)
+		}
+		if _, err := s.agents.GetByID(ctx, "a1"); err != nil {
+			t.Errorf("agent: %v", err)
+		}
+		if _, err := s.simulations.GetByID(ctx, "s1"); err != nil {
+			t.Errorf("simulation: %v", err)
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c1"); len(revs) != 1 ||
+			revs[0].Revision != 1 {
+			t.Errorf("revisions = %+v, want one numbered 1", revs)
+		}
+		if events, _ := s.events.List(ctx, 0, 0); len(events) != 1 || events[0].Seq != 1 {
+			t.Errorf("events = %+v, want one numbered 1", events)
+		}
+		if _, err := s.transcripts.GetBySimulation(ctx, "s1"); err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	})
+}
+
+// fn がエラーを返したら、どの書き込みも反映せず、進めた版も戻す
+func TestUnitOfWorkRollback(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		existing := &entity.Community{ID: "c0", Name: "山の民", Culture: "狩猟"}
+		if err := s.communities.Save(ctx, existing); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+
+		boom := errors.New("boom")
+		c := &entity.Community{ID: "c1", Name: "川の民", Culture: "漁業"}
+		err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			stageWorld(t, ctx, repos, c)
+			existing.Culture = "祭り"
+			if err := repos.Communities.Save(ctx, existing); err != nil {
+				t.Fatalf("failed to update community: %v", err)
+			}
+			return boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("error = %v, want %v", err, boom)
+		}
+
+		if c.Version != 0 || existing.Version != 1 {
+			t.Errorf("caller's versions = %d, %d; want them restored to 0 and 1",
+				c.Version, existing.Version)
+		}
+		if _, err := s.communities.GetByID(ctx, "c1"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("community error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+		if got, _ := s.communities.GetByID(ctx, "c0"); got.Culture != "狩猟" || got.Version != 1 {
+			t.Errorf("existing community = %+v, want it unchanged", got)
+		}
+		if _, err := s.agents.GetByID(ctx, "a1"); !errors.Is(err, domainrepo.ErrAgentNotFound) {
+			t.Errorf("agent error = %v, want %v", err, domainrepo.ErrAgentNotFound)
+		}
+		if _, err := s.simulations.GetByID(ctx, "s1"); !errors.Is(
+			err, domainrepo.ErrSimulationNotFound) {
+			t.Errorf("simulation error = %v, want %v", err, domainrepo.ErrSimulationNotFound)
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c1"); len(revs) != 0 {
+			t.Errorf("revisions = %+v, want none", revs)
+		}
+		if events, _ := s.events.List(ctx, 0, 0); len(events) != 0 {
+			t.Errorf("events = %+v, want none", events)
+		}
+		if _, err := s.transcripts.GetBySimulation(ctx, "s1"); !errors.Is(
+			err, domainrepo.ErrTranscriptNotFound) {
+			t.Errorf("transcript error = %v, want %v", err, domainrepo.ErrTranscriptNotFound)
+		}
+
+		// ロールバックした後も同じ内容をもう一度書き込める
+		if err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			stageWorld(t, ctx, repos, c)
+			return nil
+		}); err != nil {
+			t.Fatalf("failed to commit after rollback: %v", err)
+		}
+	})
+}
+
+// コミュニティの完全削除で関連データをまとめて消し、他のコミュニティのデータは残す
+func TestUnitOfWorkPurgeCommunity(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		for _, c := range []*entity.Community{{ID: "c1"}, {ID: "c2"}} {
+			if err := s.communities.Save(ctx, c); err != nil {
+				t.Fatalf("failed to save community: %v", err)
+			}
+			if err := s.agents.Save(ctx, &entity.Agent{
+				ID: "a-" + c.ID, CommunityID: c.ID,
+			}); err != nil {
+				t.Fatalf("failed to save agent: %v", err)
+			}
+			if err := s.revisions.Append(ctx, &entity.CultureRevision{
+				CommunityID: c.ID,
+			}); err != nil {
+				t.Fatalf("failed to append revision: %v", err)
+			}
+		}
+		saveSimulation(t, s.simulations, "s1", "c1")
+		saveSimulation(t, s.simulations, "s2", "c1", "c2")
+		for _, id := range []string{"s1", "s2"} {
+			if err := s.transcripts.Save(ctx, &entity.Transcript{SimulationID: id}); err != nil {
+				t.Fatalf("failed to save transcript: %v", err)
+			}
+		}
+
+		purge := func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			if err := repos.Agents.DeleteByCommunity(ctx, "c1"); err != nil {
+				return err
+			}
+			if err := repos.Revisions.DeleteByCommunity(ctx, "c1"); err != nil {
+				return err
+			}
+			removed, err := repos.Simulations.RemoveCommunity(ctx, "c1")
+			if err != nil {
+				return err
+			}
+			if !slices.Equal(removed, []string{"s1"}) {
+				t.Errorf("removed = %v, want [s1]", removed)
+			}
+			if err := repos.Transcripts.DeleteBySimulations(ctx, removed); err != nil {
+				return err
+			}
+			return repos.Communities.Delete(ctx, "c1")
+		}
+
+		// 途中で失敗すれば何も消さない
+		boom := errors.New("boom")
+		if err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+			if err := purge(ctx, repos); err != nil {
+				return err
+			}
+			return boom
+		}); !errors.Is(err, boom) {
+			t.Fatalf("error = %v, want %v", err, boom)
+		}
+		if _, err := s.communities.GetByID(ctx, "c1"); err != nil {
+			t.Errorf("community purged by a rolled back transaction: %v", err)
+		}
+		if _, err := s.transcripts.GetBySimulation(ctx, "s1"); err != nil {
+			t.Errorf("transcript purged by a rolled back transaction: %v", err)
+		}
+
+		if err := s.uow.Do(ctx, purge); err != nil {
+			t.Fatalf("failed to purge community: %v", err)
+		}
+		if _, err := s.communities.GetByIDIncludingDeleted(ctx, "c1"); !errors.Is(
+			err, domainrepo.ErrCommunityNotFound) {
+			t.Errorf("community error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+		}
+		if agents, _ := s.agents.GetAll(ctx); len(agents) != 1 || agents[0].ID != "a-c2" {
+			t.Errorf("agents = %v, want only a-c2", agentIDs(agents))
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c1"); len(revs) != 0 {
+			t.Errorf("revisions of c1 = %+v, want none", revs)
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c2"); len(revs) != 1 {
+			t.Errorf("revisions of c2 = %+v, want one", revs)
+		}
+		if _, err := s.simulations.GetByID(ctx, "s1"); !errors.Is(
+			err, domainrepo.ErrSimulationNotFound) {
+			t.Errorf("simulation error = %v, want %v", err, domainrepo.ErrSimulationNotFound)
+		}
+		if sim, err := s.simulations.GetByID(ctx, "s2"); err != nil ||
+			!slices.Equal(sim.Communities, []string{"c2"}) {
+			t.Errorf("simulation s2 = %+v, %v; want only c2", sim, err)
+		}
+		if _, err := s.transcripts.GetBySimulation(ctx, "s1"); !errors.Is(
+			err, domainrepo.ErrTranscriptNotFound) {
+			t.Errorf("transcript error = %v, want %v", err, domainrepo.ErrTranscriptNotFound)
+		}
+		if _, err := s.transcripts.GetBySimulation(ctx, "s2"); err != nil {
+			t.Errorf("transcript of s2: %v", err)
+		}
+	})
+}
+
+// スナップショットの取り込みも、同じトランザクションの他の書き込みと一緒に確定する
+func TestUnitOfWorkWorldImport(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s *testStorage) {
+		ctx := context.Background()
+		if err := s.communities.Save(ctx, &entity.Community{ID: "c0"}); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+		importWithEvent := func(
+			snapshot *entity.WorldSnapshot,
+			mode entity.WorldImportMode,
+			after error,
+		) error {
+			return s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+				if err := repos.World.Import(ctx, snapshot, mode); err != nil {
+					return err
+				}
+				if err := repos.Events.Append(ctx, &entity.DomainEvent{
+					Type: entity.EventWorldImported, Payload: []byte(`{}`),
+				}); err != nil {
+					return err
+				}
+				return after
+			})
+		}
+
+		if err := importWithEvent(&entity.WorldSnapshot{
+			Communities: []*entity.Community{{ID: "c1", Culture: "漁業", Version: 3}},
+			Revisions: []*entity.CultureRevision{
+				{CommunityID: "c1", Revision: 1, NewCulture: "漁業"},
+			},
+		}, entity.WorldImportReplace, nil); err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		if all, _ := s.communities.GetAll(ctx); len(all) != 1 || all[0].ID != "c1" ||
+			all[0].Version != 3 {
+			t.Errorf("communities = %+v, want only c1 at version 3", all)
+		}
+		if revs, _ := s.revisions.GetByCommunity(ctx, "c1"); len(revs) != 1 {
+			t.Errorf("revisions = %+v, want one", revs)
+		}
+		if events, _ := s.events.List(ctx, 0, 0); len(events) != 1 {
+			t.Errorf("events = %+v, want one", events)
+		}
+
+		// 取り込めないスナップショットや、後の処理の失敗では、取り込みもイベントも残らない
+		boom := errors.New("boom")
+		for _, tt := range []struct {
+			name     string
+			snapshot *entity.WorldSnapshot
+			after    error
+			want     error
+		}{
+			{name: "gapped revisions", snapshot: &entity.WorldSnapshot{
+				Communities: []*entity.Community{{ID: "c2"}},
+				Revisions:   []*entity.CultureRevision{{CommunityID: "c2", Revision: 2}},
+			}, want: entity.ErrInvalidWorldSnapshot},
+			{name: "failure after import", snapshot: &entity.WorldSnapshot{
+				Communities: []*entity.Community{{ID: "c2"}},
+			}, after: boom, want: boom},
+		} {
+			if err := importWithEvent(tt.snapshot, entity.WorldImportMerge,
+				tt.after); !errors.Is(err, tt.want) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+			}
+			if _, err := s.communities.GetByID(ctx, "c2"); !errors.Is(
+				err, domainrepo.ErrCommunityNotFound) {
+				t.Errorf("%s: community error = %v, want %v",
+					tt.name, err, domainrepo.ErrCommunityNotFound)
+			}
+			if events, _ := s.events.List(ctx, 0, 0); len(events) != 1 {
+				t.Errorf("%s: events = %+v, want only the first import", tt.name, events)
+			}
+		}
+	})
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,13 +13,15 @@ import (
 
 type CommunityController struct {
 	communityUC *usecase.CommunityUsecase
+	historyUC   *usecase.CultureHistoryUsecase
 }
 
 func NewCommunityController(
 	uc *usecase.CommunityUsecase,
+	huc *usecase.CultureHistoryUsecase,
 ) *CommunityController {
 	zap.L().Debug("Initializing CommunityController")
-	return &CommunityController{communityUC: uc}
+	return &CommunityController{communityUC: uc, historyUC: huc}
 }
 
 // POST /communities
@@ -51,7 +54,7 @@ func (cc *CommunityController) CreateCommunity(
 	logger.Debug("Creating community", zap.String("communityID", newComm.ID))
 
 	if err := cc.communityUC.CreateCommunity(c, newComm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -91,7 +94,7 @@ func (cc *CommunityController) DeleteCommunity(
 	err := cc.communityUC.DeleteCommunity(c, id)
 	if err != nil {
 		logger.Error("Failed to delete community", zap.String("communityID", id), zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -99,15 +102,56 @@ func (cc *CommunityController) DeleteCommunity(
 	c.JSON(http.StatusOK, gin.H{"message": "deleted community", "id": id})
 }
 
+// POST /communities/:id/restore
+func (cc *CommunityController) RestoreCommunity(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	id := c.Param("id")
+	logger.Debug("Restoring community", zap.String("communityID", id))
+
+	comm, err := cc.communityUC.RestoreCommunity(c, id)
+	if err != nil {
+		logger.Error("Failed to restore community", zap.String("communityID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Community restored", zap.String("communityID", id))
+	c.JSON(http.StatusOK, gin.H{"message": "restored community", "community": comm})
+}
+
+// POST /communities/:id/purge
+func (cc *CommunityController) PurgeCommunity(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	id := c.Param("id")
+	logger.Debug("Purging community", zap.String("communityID", id))
+
+	if err := cc.communityUC.PurgeCommunity(c, id); err != nil {
+		logger.Error("Failed to purge community", zap.String("communityID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Community purged", zap.String("communityID", id))
+	c.JSON(http.StatusOK, gin.H{"message": "purged community", "id": id})
+}
+
+// GET /communities?include=deleted
 // コミュニティ一覧をJSONで返す
 func (cc *CommunityController) GetCommunities(
 	c *gin.Context,
 ) {
 	logger := zap.L()
 
-	logger.Debug("Fetching all communities")
+	includeDeleted := c.Query("include") == "deleted"
+	logger.Debug("Fetching all communities", zap.Bool("includeDeleted", includeDeleted))
 
-	communities, err := cc.communityUC.GetAllCommunities(c)
+	communities, err := cc.communityUC.GetAllCommunities(c, includeDeleted)
 	if err != nil {
 		logger.Error("Failed to fetch communities", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -117,3 +161,52 @@ func (cc *CommunityController) GetCommunities(
 	logger.Info("Communities fetched", zap.Int("count", len(communities)))
 	c.JSON(http.StatusOK, communities)
 }
+
+// GET /communities/:id/history
+func (cc *CommunityController) GetCultureHistory(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	id := c.Param("id")
+	logger.Debug("Fetching culture history", zap.String("communityID", id))
+
+	revisions, err := cc.historyUC.GetHistory(c, id)
+	if err != nil {
+		logger.Warn("Failed to fetch culture history",
+			zap.String("communityID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("Culture history fetched",
+		zap.String("communityID", id), zap.Int("count", len(revisions)))
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GET /communities/:id/revisions/:rev
+func (cc *CommunityController) GetCultureRevision(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	id := c.Param("id")
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		logger.Warn("Invalid revision number", zap.String("rev", c.Param("rev")))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rev must be an integer"})
+		return
+	}
+	logger.Debug("Fetching culture revision",
+		zap.String("communityID", id), zap.Int("revision", rev))
+
+	revision, err := cc.historyUC.GetRevision(c, id, rev)
+	if err != nil {
+		logger.Warn("Failed to fetch culture revision",
+			zap.String("communityID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
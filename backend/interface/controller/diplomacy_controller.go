@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/usecase"
 	"go.uber.org/zap"
 )
@@ -25,21 +27,15 @@ func (dc *DiplomacyController) SimulateDiplomacy(
 ) {
 	logger := zap.L()
 
-	commA := c.Query("commA")
-	commB := c.Query("commB")
-	logger.Debug("Simulating diplomacy", zap.String("commA", commA),
-		zap.String("commB", commB))
-
-	if commA == "" || commB == "" {
-		logger.Warn("Missing parameters for diplomacy simulation")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "commA and commB are required"})
+	commA, commB, ok := diplomacyParams(c)
+	if !ok {
 		return
 	}
 
-	if err := dc.diploUC.ExecuteDiplomacy(c, commA, commB); err != nil {
+	if _, err := dc.diploUC.ExecuteDiplomacy(c, commA, commB); err != nil {
 		logger.Error("Diplomacy simulation failed", zap.Error(err),
 			zap.String("commA", commA), zap.String("commB", commB))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -47,3 +43,35 @@ func (dc *DiplomacyController) SimulateDiplomacy(
 		zap.String("commB", commB))
 	c.JSON(http.StatusOK, gin.H{"message": "Diplomacy simulation done"})
 }
+
+// POST /simulate/diplomacy/stream?commA=...&commB=...
+// LLM の応答の断片と保存した結果を Server-Sent Events で送る
+func (dc *DiplomacyController) SimulateDiplomacyStream(
+	c *gin.Context,
+) {
+	commA, commB, ok := diplomacyParams(c)
+	if !ok {
+		return
+	}
+
+	streamSimulation(c, func(ctx context.Context) (*entity.SimulationResult, error) {
+		return dc.diploUC.ExecuteDiplomacy(ctx, commA, commB)
+	})
+}
+
+// diplomacyParams: クエリパラメータから2つのコミュニティIDを読む（足りなければ 400 を返す）
+func diplomacyParams(c *gin.Context) (string, string, bool) {
+	logger := zap.L()
+
+	commA := c.Query("commA")
+	commB := c.Query("commB")
+	logger.Debug("Simulating diplomacy", zap.String("commA", commA),
+		zap.String("commB", commB))
+
+	if commA == "" || commB == "" {
+		logger.Warn("Missing parameters for diplomacy simulation")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "commA and commB are required"})
+		return "", "", false
+	}
+	return commA, commB, true
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// ユースケースのエラーを HTTP ステータスに対応付ける
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrCommunityNotFound),
+		errors.Is(err, repository.ErrAgentNotFound),
+		errors.Is(err, repository.ErrRevisionNotFound),
+		errors.Is(err, repository.ErrSimulationNotFound),
+		errors.Is(err, repository.ErrTranscriptNotFound),
+		errors.Is(err, repository.ErrLLMUsageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, repository.ErrVersionConflict),
+		errors.Is(err, repository.ErrCommunityNotInTrash),
+		errors.Is(err, repository.ErrCommunityExists):
+		// 他のリクエストが先に更新した（再試行できる）、ゴミ箱の状態と合わない、
+		// または同じ ID のコミュニティが既にある（ゴミ箱に入ったものを含む）
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrLLMRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, repository.ErrLLMBudgetExceeded):
+		// 設定した予算を使い切ったので、新しい LLM の利用を断った
+		return http.StatusPaymentRequired
+	case errors.Is(err, repository.ErrLLMUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, repository.ErrLLMSafetyBlocked):
+		// 入力やコミュニティの内容が LLM の安全性の基準で拒否された
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repository.ErrLLMOutput),
+		errors.Is(err, repository.ErrLLMInvalidRequest):
+		// LLM から使える応答が得られなかった、または LLM の設定が誤っている
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
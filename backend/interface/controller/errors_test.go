@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", fmt.Errorf("get: %w", repository.ErrCommunityNotFound), http.StatusNotFound},
+		{"no usage", fmt.Errorf("get: %w", repository.ErrLLMUsageNotFound), http.StatusNotFound},
+		{"invalid cursor", repository.ErrInvalidCursor, http.StatusBadRequest},
+		{"version conflict", &repository.ConflictError{Entity: "community", ID: "c1"},
+			http.StatusConflict},
+		{"community exists", fmt.Errorf("create: %w", repository.ErrCommunityExists),
+			http.StatusConflict},
+		{"not in trash", repository.ErrCommunityNotInTrash, http.StatusConflict},
+		{"rate limited", &repository.LLMError{Kind: repository.ErrLLMRateLimited},
+			http.StatusTooManyRequests},
+		{"budget exceeded", repository.ErrLLMBudgetExceeded, http.StatusPaymentRequired},
+		{"unavailable", &repository.LLMError{Kind: repository.ErrLLMUnavailable},
+			http.StatusServiceUnavailable},
+		{"safety blocked", &repository.LLMError{Kind: repository.ErrLLMSafetyBlocked},
+			http.StatusUnprocessableEntity},
+		{"bad output", &repository.LLMOutputError{Err: errors.New("no json")},
+			http.StatusBadGateway},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorStatus(tt.err); got != tt.want {
+				t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"go.uber.org/zap"
+)
+
+// イベントログの参照と、ログからのワールド再構築を行うコントローラ
+type EventController struct {
+	eventLogUC *usecase.EventLogUsecase
+}
+
+func NewEventController(
+	uc *usecase.EventLogUsecase,
+) *EventController {
+	zap.L().Debug("Initializing EventController")
+	return &EventController{eventLogUC: uc}
+}
+
+// クエリパラメータを通し番号として読む（未指定なら 0）
+func querySeq(c *gin.Context, key string) (int64, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, true
+	}
+	seq, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seq < 0 {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": key + " must be a non-negative integer"})
+		return 0, false
+	}
+	return seq, true
+}
+
+// GET /events?after=...&until=...
+func (ec *EventController) ListEvents(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	after, ok := querySeq(c, "after")
+	if !ok {
+		return
+	}
+	until, ok := querySeq(c, "until")
+	if !ok {
+		return
+	}
+
+	events, err := ec.eventLogUC.ListEvents(c, after, until)
+	if err != nil {
+		logger.Error("Failed to list events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// GET /world/replay?until=...
+func (ec *EventController) ReplayWorld(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	until, ok := querySeq(c, "until")
+	if !ok {
+		return
+	}
+
+	snapshot, err := ec.eventLogUC.Replay(c, until)
+	if err != nil {
+		logger.Error("Failed to replay world", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// POST /world/rebuild?until=...
+func (ec *EventController) RebuildWorld(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	until, ok := querySeq(c, "until")
+	if !ok {
+		return
+	}
+
+	if err := ec.eventLogUC.Rebuild(c, until); err != nil {
+		logger.Error("Failed to rebuild world", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("World rebuilt", zap.Int64("until", until))
+	c.JSON(http.StatusOK, gin.H{"message": "world rebuilt", "until": until})
+}
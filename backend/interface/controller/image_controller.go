@@ -43,13 +43,13 @@ type imageResponse struct {
 	} `json:"data"`
 }
 
-// POST /communities/:communityID/generateImage
+// POST /communities/:id/generateImage
 func (ic *ImageController) GenerateImage(
 	c *gin.Context,
 ) {
 	logger := zap.L()
 
-	communityID := c.Param("communityID")
+	communityID := c.Param("id")
 	logger.Debug("GenerateImage called", zap.String("communityID", communityID))
 
 	comm, err := ic.communityUC.GetCommunityByID(c, communityID)
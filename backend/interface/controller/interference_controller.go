@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/usecase"
 	"go.uber.org/zap"
 )
@@ -33,26 +35,17 @@ func (ic *InterferenceController) SimulateInterferenceBetweenCommunities(
 ) {
 	logger := zap.L()
 
-	var req InterferenceRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		logger.Error("invalid request body", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
-		return
-	}
-
-	if req.CommA == "" || req.CommB == "" || req.CommA == req.CommB {
-		logger.Error("commA and commB must be provided and different")
-		c.JSON(http.StatusBadRequest,
-			gin.H{"error": "commA and commB must be provided and different"})
+	req, ok := bindInterferenceRequest(c)
+	if !ok {
 		return
 	}
 
 	// Usecase実行
-	if err := ic.interferenceUC.Execute(
+	if _, err := ic.interferenceUC.Execute(
 		c, req.CommA, req.CommB, req.UserInput,
 	); err != nil {
 		logger.Error("failed to execute interference simulation", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -63,3 +56,39 @@ func (ic *InterferenceController) SimulateInterferenceBetweenCommunities(
 		"commB":   req.CommB,
 	})
 }
+
+// POST /simulate/interference/stream
+// LLM の応答の断片と保存した結果を Server-Sent Events で送る
+func (ic *InterferenceController) SimulateInterferenceBetweenCommunitiesStream(
+	c *gin.Context,
+) {
+	req, ok := bindInterferenceRequest(c)
+	if !ok {
+		return
+	}
+
+	streamSimulation(c, func(ctx context.Context) (*entity.SimulationResult, error) {
+		return ic.interferenceUC.Execute(ctx, req.CommA, req.CommB, req.UserInput)
+	})
+}
+
+// bindInterferenceRequest: リクエストボディを読み、2つのコミュニティが異なるか確かめる
+// （不正なら 400 を返す）
+func bindInterferenceRequest(c *gin.Context) (InterferenceRequest, bool) {
+	logger := zap.L()
+
+	var req InterferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("invalid request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return req, false
+	}
+
+	if req.CommA == "" || req.CommB == "" || req.CommA == req.CommB {
+		logger.Error("commA and commB must be provided and different")
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "commA and commB must be provided and different"})
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"go.uber.org/zap"
+)
+
+// LLM ゲートウェイの稼働状況（流量制限・サーキットブレーカー）を返す管理用コントローラ
+type LLMAdminController struct {
+	statsUC *usecase.LLMStatsUsecase
+}
+
+func NewLLMAdminController(
+	uc *usecase.LLMStatsUsecase,
+) *LLMAdminController {
+	zap.L().Debug("Initializing LLMAdminController")
+	return &LLMAdminController{statsUC: uc}
+}
+
+// GET /admin/llm/stats
+func (ac *LLMAdminController) GetStats(
+	c *gin.Context,
+) {
+	c.JSON(http.StatusOK, gin.H{"limiters": ac.statsUC.GetLimiterStats()})
+}
+
+// GET /admin/llm/breakers
+func (ac *LLMAdminController) GetBreakers(
+	c *gin.Context,
+) {
+	c.JSON(http.StatusOK, gin.H{"breakers": ac.statsUC.GetBreakerStats()})
+}
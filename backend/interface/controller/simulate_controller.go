@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/usecase"
 	"go.uber.org/zap"
 )
@@ -29,10 +30,10 @@ func (sc *SimulateController) Simulate(
 	communityID := c.Param("communityID")
 	logger.Debug("Simulate called", zap.String("communityID", communityID))
 
-	if err := sc.simulateUC.Execute(context.Background(), communityID); err != nil {
+	if _, err := sc.simulateUC.Execute(c, communityID); err != nil {
 		logger.Error("Simulation failed",
 			zap.String("communityID", communityID), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -40,7 +41,21 @@ func (sc *SimulateController) Simulate(
 	c.JSON(http.StatusOK, gin.H{"message": "Simulation executed successfully."})
 }
 
+// POST /simulate/:communityID/stream
+// LLM の応答の断片と保存した結果を Server-Sent Events で送る
+func (sc *SimulateController) SimulateStream(
+	c *gin.Context,
+) {
+	communityID := c.Param("communityID")
+	zap.L().Debug("Simulate stream called", zap.String("communityID", communityID))
+
+	streamSimulation(c, func(ctx context.Context) (*entity.SimulationResult, error) {
+		return sc.simulateUC.Execute(ctx, communityID)
+	})
+}
+
 // ルーティング設定
 func (sc *SimulateController) SetupRoutes(r *gin.Engine) {
 	r.POST("/simulate/:communityID", sc.Simulate)
+	r.POST("/simulate/:communityID/stream", sc.SimulateStream)
 }
@@ -0,0 +1,98 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/infrastructure/repository"
+	"github.com/rayfiyo/zousui/backend/interface/controller"
+	"github.com/rayfiyo/zousui/backend/usecase"
+)
+
+// barrierGateway: n 件の問い合わせがそろうまで応答を返さないゲートウェイ
+type barrierGateway struct {
+	response string
+
+	mu      sync.Mutex
+	waiting int
+	release chan struct{}
+}
+
+func (g *barrierGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	g.mu.Lock()
+	g.waiting--
+	if g.waiting == 0 {
+		close(g.release)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.release:
+		return g.response, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (g *barrierGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 同じコミュニティへの2つのシミュレーションを同時に要求すると、
+// 片方は 200、版の競合で失敗したもう片方は 409 を返す
+func TestSimulateConcurrentConflictStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	cr := repository.NewMemoryCommunityRepo()
+	ar := repository.NewMemoryAgentRepo()
+	sr := repository.NewMemorySimulationRepo()
+	uow := repository.NewMemoryUnitOfWork(cr, ar, sr,
+		repository.NewMemoryCultureRevisionRepo(), repository.NewMemoryEventStore(),
+		repository.NewMemoryTranscriptRepo())
+	if err := cr.Save(ctx, &entity.Community{
+		ID: "c1", Name: "川の民", Population: 100, Culture: "漁業",
+	}); err != nil {
+		t.Fatalf("failed to save community: %v", err)
+	}
+
+	gw := &barrierGateway{
+		response: `{"newCulture": "祭りの文化", "populationChange": 5}`,
+		waiting:  2,
+		release:  make(chan struct{}),
+	}
+	uc := usecase.NewSimulateCultureEvolutionUsecase(cr, ar, uow, gw,
+		usecase.NewLLMUsageUsecase(repository.NewMemoryLLMUsageRepo(), entity.LLMBudget{}))
+	r := gin.New()
+	controller.NewSimulateController(uc).SetupRoutes(r)
+
+	statuses := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/simulate/c1", nil))
+			statuses[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Ints(statuses)
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusConflict {
+		t.Errorf("statuses = %v, want [%d %d]", statuses, http.StatusOK, http.StatusConflict)
+	}
+}
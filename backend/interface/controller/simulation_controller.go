@@ -2,24 +2,97 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"go.uber.org/zap"
 )
 
 type SimulationController struct {
-	simulationRepo repository.SimulationRepository
+	historyUC *usecase.SimulationHistoryUsecase
 }
 
-func NewSimulationController(repo repository.SimulationRepository) *SimulationController {
-	return &SimulationController{simulationRepo: repo}
+func NewSimulationController(
+	uc *usecase.SimulationHistoryUsecase,
+) *SimulationController {
+	zap.L().Debug("Initializing SimulationController")
+	return &SimulationController{historyUC: uc}
 }
 
+// クエリパラメータを RFC3339 の日時として読む（未指定ならゼロ値）
+func queryTime(c *gin.Context, key string) (time.Time, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": key + " must be an RFC3339 timestamp"})
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// GET /simulations/history?community=&type=&from=&to=&cursor=&limit=
 func (sc *SimulationController) GetSimulationHistory(c *gin.Context) {
-	simulations, err := sc.simulationRepo.GetAll(c)
+	logger := zap.L()
+
+	query := repository.SimulationQuery{
+		CommunityID: c.Query("community"),
+		Type:        c.Query("type"),
+		Cursor:      c.Query("cursor"),
+	}
+	var ok bool
+	if query.From, ok = queryTime(c, "from"); !ok {
+		return
+	}
+	if query.To, ok = queryTime(c, "to"); !ok {
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	page, err := sc.historyUC.Find(c, query)
+	if err != nil {
+		logger.Error("Failed to fetch simulation history", zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /simulations/:id
+func (sc *SimulationController) GetSimulation(c *gin.Context) {
+	id := c.Param("id")
+	simulation, err := sc.historyUC.GetByID(c, id)
+	if err != nil {
+		zap.L().Warn("Failed to fetch simulation",
+			zap.String("simulationID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, simulation)
+}
+
+// GET /simulations/:id/transcript
+func (sc *SimulationController) GetTranscript(c *gin.Context) {
+	id := c.Param("id")
+	transcript, err := sc.historyUC.GetTranscript(c, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		zap.L().Warn("Failed to fetch transcript",
+			zap.String("simulationID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, simulations)
+	c.JSON(http.StatusOK, transcript)
 }
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"go.uber.org/zap"
+)
+
+// Server-Sent Events のイベント名
+const (
+	sseEventToken  = "token"  // LLM の応答の断片 {"text": "..."}
+	sseEventReset  = "reset"  // LLM が生成をやり直した（それまでの断片は捨てる）
+	sseEventResult = "result" // 保存したシミュレーション結果 (GET /simulations/:id と同じ形)
+	sseEventError  = "error"  // 途中で失敗した {"error": "...", "status": 502}
+)
+
+type simulationOutcome struct {
+	result *entity.SimulationResult
+	err    error
+}
+
+// streamSimulation: シミュレーションを実行しながら、LLM の応答の断片と保存した結果を
+// Server-Sent Events で送る
+// LLM が応答を生成し始める前に失敗した場合は、ストリーミングしない API と同じく
+// ステータスと JSON のエラーを返す
+// クライアントが切断するとリクエストの context が取り消され、LLM への問い合わせも止まる
+func streamSimulation(
+	c *gin.Context,
+	run func(ctx context.Context) (*entity.SimulationResult, error),
+) {
+	logger := zap.L()
+
+	// ハンドラが戻った後も動き続けることがあるので、gin.Context ではなくリクエストの context を使う
+	reqCtx := c.Request.Context()
+	events := make(chan entity.LLMStreamEvent)
+	done := make(chan simulationOutcome, 1)
+	ctx := entity.ContextWithLLMStream(reqCtx, func(ev entity.LLMStreamEvent) {
+		select {
+		case events <- ev:
+		case <-reqCtx.Done():
+		}
+	})
+	go func() {
+		result, err := run(ctx)
+		done <- simulationOutcome{result: result, err: err}
+	}()
+
+	started := false // レスポンスのヘッダを送ったか
+	dirty := false   // 最後のやり直しの後に断片を送ったか
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // プロキシにバッファさせない
+		c.Status(http.StatusOK)
+	}
+	send := func(event string, data any) {
+		start()
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	for {
+		select {
+		case ev := <-events:
+			if ev.Reset {
+				if dirty {
+					send(sseEventReset, gin.H{})
+					dirty = false
+				}
+				continue
+			}
+			send(sseEventToken, gin.H{"text": ev.Text})
+			dirty = true
+		case out := <-done:
+			if out.err != nil {
+				logger.Error("Streaming simulation failed", zap.Error(out.err))
+				if !started {
+					c.JSON(errorStatus(out.err), gin.H{"error": out.err.Error()})
+					return
+				}
+				send(sseEventError, gin.H{
+					"error":  out.err.Error(),
+					"status": errorStatus(out.err),
+				})
+				return
+			}
+			send(sseEventResult, out.result)
+			return
+		case <-reqCtx.Done():
+			logger.Info("Client disconnected from simulation stream", zap.Error(reqCtx.Err()))
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"go.uber.org/zap"
+)
+
+// LLM の利用量（トークン数・費用）を返すコントローラ
+type UsageController struct {
+	usageUC *usecase.LLMUsageUsecase
+}
+
+func NewUsageController(
+	uc *usecase.LLMUsageUsecase,
+) *UsageController {
+	zap.L().Debug("Initializing UsageController")
+	return &UsageController{usageUC: uc}
+}
+
+// GET /usage?community=&from=&to=
+func (uc *UsageController) GetUsage(c *gin.Context) {
+	query := repository.LLMUsageQuery{CommunityID: c.Query("community")}
+	var ok bool
+	if query.From, ok = queryTime(c, "from"); !ok {
+		return
+	}
+	if query.To, ok = queryTime(c, "to"); !ok {
+		return
+	}
+
+	report, err := uc.usageUC.GetUsage(c, query)
+	if err != nil {
+		zap.L().Error("Failed to aggregate llm usage", zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GET /simulations/:id/usage
+func (uc *UsageController) GetSimulationUsage(c *gin.Context) {
+	id := c.Param("id")
+	report, err := uc.usageUC.GetSimulationUsage(c, id)
+	if err != nil {
+		zap.L().Warn("Failed to fetch simulation llm usage",
+			zap.String("simulationID", id), zap.Error(err))
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
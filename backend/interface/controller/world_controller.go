@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"go.uber.org/zap"
+)
+
+// ワールド全体のスナップショットを書き出し・取り込みするコントローラ
+type WorldController struct {
+	worldUC *usecase.WorldUsecase
+}
+
+func NewWorldController(
+	uc *usecase.WorldUsecase,
+) *WorldController {
+	zap.L().Debug("Initializing WorldController")
+	return &WorldController{worldUC: uc}
+}
+
+// GET /world/export
+func (wc *WorldController) ExportWorld(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	snapshot, err := wc.worldUC.Export(c)
+	if err != nil {
+		logger.Error("Failed to export world", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("World exported")
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// POST /world/import?mode=replace|merge
+func (wc *WorldController) ImportWorld(
+	c *gin.Context,
+) {
+	logger := zap.L()
+
+	mode := entity.WorldImportMode(c.DefaultQuery("mode", string(entity.WorldImportReplace)))
+	logger.Debug("Importing world", zap.String("mode", string(mode)))
+
+	if err := wc.worldUC.ImportFrom(c, c.Request.Body, mode); err != nil {
+		if errors.Is(err, entity.ErrInvalidWorldSnapshot) {
+			logger.Warn("Invalid world snapshot", zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("Failed to import world", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("World imported", zap.String("mode", string(mode)))
+	c.JSON(http.StatusOK, gin.H{"message": "world imported", "mode": mode})
+}
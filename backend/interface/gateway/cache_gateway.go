@@ -0,0 +1,262 @@
+package gateway
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// キャッシュファイルの1件分の応答
+type llmCacheEntry struct {
+	Key       string    `json:"key"` // ゲートウェイ名・モデル・プロンプト・パラメータのハッシュ
+	Gateway   string    `json:"gateway"`
+	Model     string    `json:"model,omitempty"`
+	Response  string    `json:"response"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+type llmCacheFile struct {
+	Entries []llmCacheEntry `json:"entries"` // 最近使った順
+}
+
+// LLMCache: 問い合わせごとの応答を有効期限付きで保持する LRU キャッシュ
+// 複数のゲートウェイで1つのキャッシュを共有できる
+type LLMCache struct {
+	ttl        time.Duration // 0 以下なら期限切れにしない
+	maxEntries int           // 0 以下なら件数を制限しない
+	path       string        // 空ならファイルに保存しない
+	clock      clock
+
+	mu      sync.Mutex
+	order   *list.List // 先頭ほど最近使った (*llmCacheEntry)
+	entries map[string]*list.Element
+	gen     uint64 // 追加のたびに進める
+
+	// ファイルへの書き出しは mu の外で行い、書き出し同士だけを順番にする
+	writeMu sync.Mutex
+	written uint64 // 書き出し済みの gen
+}
+
+// NewLLMCache: キャッシュを作る
+// path を指定した場合は保存済みの応答を読み込み、追加のたびに書き出す
+func NewLLMCache(
+	ttl time.Duration,
+	maxEntries int,
+	path string,
+) (*LLMCache, error) {
+	zap.L().Debug("Initializing LLMCache",
+		zap.Duration("ttl", ttl), zap.Int("maxEntries", maxEntries),
+		zap.String("path", path))
+	c := &LLMCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		path:       path,
+		clock:      systemClock{},
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+	if path == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read llm cache: %w", err)
+	}
+	var f llmCacheFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode llm cache %s: %w", path, err)
+	}
+	now := c.clock.Now()
+	for _, e := range f.Entries {
+		if c.expired(&e, now) {
+			continue
+		}
+		if _, ok := c.entries[e.Key]; ok {
+			continue
+		}
+		c.entries[e.Key] = c.order.PushBack(&e)
+	}
+	c.evict()
+	zap.L().Info("LLM cache loaded",
+		zap.String("path", path), zap.Int("entries", c.order.Len()))
+	return c, nil
+}
+
+func (c *LLMCache) expired(e *llmCacheEntry, now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// evict: 件数の上限を超えた分を、最近使っていないものから捨てる
+func (c *LLMCache) evict() {
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*llmCacheEntry).Key)
+	}
+}
+
+// get: 期限内の応答があれば返す
+func (c *LLMCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*llmCacheEntry)
+	if c.expired(e, c.clock.Now()) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return e.Response, true
+}
+
+// put: 応答を追加し、ファイルを使う場合は書き出す
+// 書き出す内容は mu を持ったまま写し取り、書き出しは mu を放してから行う
+func (c *LLMCache) put(e llmCacheEntry) error {
+	c.mu.Lock()
+	if c.ttl > 0 {
+		e.ExpiresAt = c.clock.Now().Add(c.ttl)
+	}
+	if el, ok := c.entries[e.Key]; ok {
+		el.Value = &e
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[e.Key] = c.order.PushFront(&e)
+	}
+	c.evict()
+	c.gen++
+	gen := c.gen
+
+	if c.path == "" {
+		c.mu.Unlock()
+		return nil
+	}
+	f := llmCacheFile{Entries: make([]llmCacheEntry, 0, c.order.Len())}
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		f.Entries = append(f.Entries, *el.Value.(*llmCacheEntry))
+	}
+	c.mu.Unlock()
+
+	return c.write(gen, f)
+}
+
+// write: gen の時点の内容を書き出す
+// より新しい内容を先に書き出していれば何もしない（古い内容で上書きしない）
+func (c *LLMCache) write(gen uint64, f llmCacheFile) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if gen <= c.written {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode llm cache: %w", err)
+	}
+	if err := writeFileAtomic(c.path, b); err != nil {
+		return fmt.Errorf("failed to write llm cache: %w", err)
+	}
+	c.written = gen
+	return nil
+}
+
+// 他のゲートウェイを包み、同じ問い合わせには前回の応答を返す
+// 失敗した問い合わせはキャッシュしない
+type CachingLLMGateway struct {
+	inner repository.LLMGateway
+	cache *LLMCache
+	name  string // 同じキャッシュを共有するゲートウェイを区別する名前
+	model string
+}
+
+func NewCachingLLMGateway(
+	inner repository.LLMGateway,
+	cache *LLMCache,
+	name, model string,
+) *CachingLLMGateway {
+	zap.L().Debug("Initializing CachingLLMGateway", zap.String("gateway", name))
+	return &CachingLLMGateway{inner: inner, cache: cache, name: name, model: model}
+}
+
+func (g *CachingLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *CachingLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+	key := llmCacheKey(g.name, g.model, req)
+
+	// キャッシュを読まないよう指定された場合も、得た応答でキャッシュは更新する
+	if entity.LLMCacheBypassFromContext(ctx) {
+		logger.Debug("LLM cache bypassed", zap.String("gateway", g.name))
+	} else if resp, ok := g.cache.get(key); ok {
+		logger.Info("LLM cache hit", zap.String("gateway", g.name), zap.String("key", key))
+		if rec := entity.TranscriptRecorderFromContext(ctx); rec != nil {
+			e := newLLMExchange(ctx, g.name, g.model, req)
+			e.Cached = true
+			exchange := rec.Begin(e)
+			rec.Finish(exchange, redactUserInput(resp, redactionTarget(ctx, req)), nil)
+		}
+		entity.StreamLLMResponse(ctx, resp)
+		return resp, nil
+	}
+
+	resp, err := g.inner.Generate(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if err := g.cache.put(llmCacheEntry{
+		Key:      key,
+		Gateway:  g.name,
+		Model:    g.model,
+		Response: resp,
+	}); err != nil {
+		// 応答自体は得られているので、保存に失敗しても呼び出し側には返す
+		logger.Warn("Failed to store llm cache", zap.String("gateway", g.name), zap.Error(err))
+	}
+	return resp, nil
+}
+
+// llmCacheKey: 応答に影響する問い合わせのパラメータ（メッセージ・生成の設定・応答の形式・
+// シミュレーションの種類）も含めたキー
+func llmCacheKey(name, model string, req *entity.LLMRequest) string {
+	var schema string
+	if req.Schema != nil {
+		schema = req.Schema.Name
+	}
+	// 生成の設定は JSON にして比べる（ポインタの項目も値で比べられる）
+	sampling, _ := json.Marshal(req.Sampling)
+	sum := sha256.Sum256([]byte(name + "\x00" + model + "\x00" + req.SystemPrompt() + "\x00" +
+		req.Prompt() + "\x00" + req.UserInput + "\x00" + string(sampling) + "\x00" +
+		schema + "\x00" + req.SimulationType))
+	return hex.EncodeToString(sum[:])
+}
+
+var _ repository.LLMGateway = (*CachingLLMGateway)(nil)
@@ -0,0 +1,298 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// countingGateway: プロンプトと問い合わせの回数を応答にするゲートウェイ
+type countingGateway struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (g *countingGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	return fmt.Sprintf("%s #%d", req.Prompt(), g.calls), nil
+}
+
+func (g *countingGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// cacheStep: 時計を進めてから1回問い合わせ、キャッシュから返したかを確かめる
+type cacheStep struct {
+	advance time.Duration
+	prompt  string
+	wantHit bool
+}
+
+func TestCachingGatewayLRUAndTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		maxEntries int
+		steps      []cacheStep
+	}{
+		{
+			name: "returns the previous response for the same request",
+			steps: []cacheStep{
+				{prompt: "a"}, {prompt: "b"}, {prompt: "a", wantHit: true},
+				{advance: 24 * time.Hour, prompt: "b", wantHit: true},
+			},
+		},
+		{
+			name: "evicts the least recently used entry", maxEntries: 2,
+			steps: []cacheStep{
+				{prompt: "a"}, {prompt: "b"},
+				{prompt: "a", wantHit: true}, // b が最も古くなる
+				{prompt: "c"},
+				{prompt: "a", wantHit: true}, {prompt: "c", wantHit: true},
+				{prompt: "b"},
+			},
+		},
+		{
+			name: "expires entries after the ttl", ttl: time.Minute,
+			steps: []cacheStep{
+				{prompt: "a"},
+				{advance: 59 * time.Second, prompt: "a", wantHit: true},
+				{advance: time.Second, prompt: "a"},
+				// 問い合わせ直した時点から期限を数え直す
+				{advance: 30 * time.Second, prompt: "a", wantHit: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := gateway.NewLLMCache(tt.ttl, tt.maxEntries, "")
+			if err != nil {
+				t.Fatalf("failed to create cache: %v", err)
+			}
+			clock := newFakeClock()
+			cache.SetClock(clock)
+			inner := &countingGateway{}
+			g := gateway.NewCachingLLMGateway(inner, cache, "fake", "model")
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				calls := inner.calls
+				if _, err := g.GenerateCultureUpdate(
+					context.Background(), step.prompt, ""); err != nil {
+					t.Fatalf("step %d: failed to generate: %v", i, err)
+				}
+				if hit := inner.calls == calls; hit != step.wantHit {
+					t.Fatalf("step %d (%s): hit = %v, want %v", i, step.prompt, hit, step.wantHit)
+				}
+			}
+		})
+	}
+}
+
+// 応答に影響するパラメータやゲートウェイ名が違えば別の問い合わせとして扱う
+func TestCachingGatewayKey(t *testing.T) {
+	cache, err := gateway.NewLLMCache(0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	inner := &countingGateway{}
+	g := gateway.NewCachingLLMGateway(inner, cache, "fake", "model")
+	other := gateway.NewCachingLLMGateway(inner, cache, "other", "model")
+	ctx := context.Background()
+
+	base := func() *entity.LLMRequest { return entity.NewLLMRequest("prompt", "input") }
+	variants := []func(r *entity.LLMRequest){
+		func(r *entity.LLMRequest) {},
+		func(r *entity.LLMRequest) { r.UserInput = "other input" },
+		func(r *entity.LLMRequest) { r.Sampling = entity.NewLLMSampling(0.5) },
+		func(r *entity.LLMRequest) { r.Sampling = entity.NewLLMSampling(0.7) },
+		func(r *entity.LLMRequest) { r.Schema = entity.CultureUpdateSchema },
+		func(r *entity.LLMRequest) { r.SimulationType = entity.SimulationTypeDiplomacy },
+		func(r *entity.LLMRequest) {
+			r.Messages = append([]entity.LLMMessage{
+				{Role: entity.LLMRoleSystem, Content: "system"}}, r.Messages...)
+		},
+	}
+	for _, variant := range variants {
+		req := base()
+		variant(req)
+		if _, err := g.Generate(ctx, req); err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+	}
+	if inner.calls != len(variants) {
+		t.Errorf("calls = %d, want %d distinct requests", inner.calls, len(variants))
+	}
+	// 同じ内容の生成の設定は別のポインタでも同じ問い合わせ
+	req := base()
+	req.Sampling = entity.NewLLMSampling(0.5)
+	g.Generate(ctx, req)
+	if inner.calls != len(variants) {
+		t.Errorf("equal sampling was not served from the cache")
+	}
+	other.Generate(ctx, base())
+	if inner.calls != len(variants)+1 {
+		t.Errorf("another gateway sharing the cache got a hit")
+	}
+}
+
+// 失敗した問い合わせはキャッシュしない
+func TestCachingGatewaySkipsFailures(t *testing.T) {
+	cache, err := gateway.NewLLMCache(0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	inner := &scriptedGateway{errs: []error{fmt.Errorf("boom")}, response: "ok"}
+	g := gateway.NewCachingLLMGateway(inner, cache, "fake", "")
+	ctx := context.Background()
+
+	if _, err := g.GenerateCultureUpdate(ctx, "prompt", ""); err == nil {
+		t.Fatalf("got no error")
+	}
+	for range 2 {
+		if resp, err := g.GenerateCultureUpdate(ctx, "prompt", ""); err != nil || resp != "ok" {
+			t.Fatalf("got (%q, %v), want ok", resp, err)
+		}
+	}
+	if inner.Calls() != 2 {
+		t.Errorf("calls = %d, want 2", inner.Calls())
+	}
+}
+
+// キャッシュを読まないよう指定されても、得た応答でキャッシュは更新する
+// キャッシュから返した応答はやり取りの記録に cached 付きで残る
+func TestCachingGatewayBypassAndTranscript(t *testing.T) {
+	cache, err := gateway.NewLLMCache(0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	inner := &countingGateway{}
+	g := gateway.NewCachingLLMGateway(inner, cache, "fake", "model")
+	ctx := context.Background()
+
+	g.GenerateCultureUpdate(ctx, "prompt", "")
+	fresh, _ := g.GenerateCultureUpdate(entity.ContextWithLLMCacheBypass(ctx), "prompt", "")
+	if fresh != "prompt #2" {
+		t.Fatalf("bypassed response = %q, want prompt #2", fresh)
+	}
+
+	rec := entity.NewTranscriptRecorder()
+	cached, _ := g.GenerateCultureUpdate(
+		entity.ContextWithTranscriptRecorder(ctx, rec), "prompt", "")
+	if cached != "prompt #2" || inner.calls != 2 {
+		t.Errorf("got %q after %d calls, want the bypassed response from the cache",
+			cached, inner.calls)
+	}
+	exchanges := rec.Transcript("sim").Exchanges
+	if len(exchanges) != 1 || !exchanges[0].Cached || exchanges[0].Response != cached ||
+		exchanges[0].Gateway != "fake" || exchanges[0].Model != "model" {
+		t.Errorf("exchanges = %+v, want one cached exchange", exchanges)
+	}
+}
+
+// ファイルに書き出した応答は、作り直したキャッシュでも使える
+func TestLLMCacheFilePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm_cache.json")
+	ctx := context.Background()
+
+	cache, err := gateway.NewLLMCache(0, 0, path)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	inner := &countingGateway{}
+	g := gateway.NewCachingLLMGateway(inner, cache, "fake", "")
+	// a を使い直した後の d の追加で、使った順が書き出される
+	for _, prompt := range []string{"a", "b", "c", "a", "d"} {
+		g.GenerateCultureUpdate(ctx, prompt, "")
+	}
+
+	// 件数の上限を下げて読み込むと、最近使ったものから残す
+	reloaded, err := gateway.NewLLMCache(0, 2, path)
+	if err != nil {
+		t.Fatalf("failed to reload cache: %v", err)
+	}
+	inner = &countingGateway{}
+	g = gateway.NewCachingLLMGateway(inner, reloaded, "fake", "")
+	for _, step := range []cacheStep{
+		{prompt: "d", wantHit: true}, {prompt: "a", wantHit: true}, {prompt: "c"},
+	} {
+		calls := inner.calls
+		resp, err := g.GenerateCultureUpdate(ctx, step.prompt, "")
+		if err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+		if hit := inner.calls == calls; hit != step.wantHit {
+			t.Errorf("%s: hit = %v (%q), want %v", step.prompt, hit, resp, step.wantHit)
+		}
+	}
+	if resp, _ := g.GenerateCultureUpdate(ctx, "a", ""); resp != "a #1" {
+		t.Errorf("reloaded response = %q, want the original a #1", resp)
+	}
+}
+
+// 期限切れの応答は読み込まない
+func TestLLMCacheFileSkipsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm_cache.json")
+	ctx := context.Background()
+
+	cache, err := gateway.NewLLMCache(time.Hour, 0, path)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	clock := newFakeClock()
+	cache.SetClock(clock)
+	g := gateway.NewCachingLLMGateway(&countingGateway{}, cache, "fake", "")
+	clock.Advance(-2 * time.Hour)
+	g.GenerateCultureUpdate(ctx, "old", "") // 1時間前に期限切れ
+	clock.Advance(2 * time.Hour)
+	g.GenerateCultureUpdate(ctx, "new", "")
+
+	var f struct {
+		Entries []struct {
+			Response string `json:"response"`
+		} `json:"entries"`
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cache file: %v", err)
+	}
+	if err := json.Unmarshal(b, &f); err != nil || len(f.Entries) != 2 {
+		t.Fatalf("cache file = %s, want 2 entries", b)
+	}
+
+	reloaded, err := gateway.NewLLMCache(time.Hour, 0, path)
+	if err != nil {
+		t.Fatalf("failed to reload cache: %v", err)
+	}
+	inner := &countingGateway{}
+	g = gateway.NewCachingLLMGateway(inner, reloaded, "fake", "")
+	g.GenerateCultureUpdate(ctx, "new", "")
+	g.GenerateCultureUpdate(ctx, "old", "")
+	if inner.calls != 1 {
+		t.Errorf("calls = %d, want only the expired entry to be fetched again", inner.calls)
+	}
+}
+
+// 壊れたキャッシュファイルは読み込まずにエラーにする
+func TestLLMCacheRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm_cache.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("failed to write cache file: %v", err)
+	}
+	if _, err := gateway.NewLLMCache(0, 0, path); err == nil {
+		t.Errorf("got no error for a corrupt cache file")
+	}
+}
@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+	"go.uber.org/zap"
+)
+
+// カセットに記録された応答が無い
+var ErrCassetteMiss = errors.New("no recorded llm response in cassette")
+
+// カセットファイルの1件分のやり取り
+type cassetteInteraction struct {
+	Key       string `json:"key"` // ゲートウェイ名と正規化したプロンプトのハッシュ
+	Gateway   string `json:"gateway"`
+	Prompt    string `json:"prompt"`
+	UserInput string `json:"userInput,omitempty"`
+	Response  string `json:"response,omitempty"`
+	Error     string `json:"error,omitempty"` // 失敗した問い合わせはエラーも再現する
+	// 分類できた失敗は、再生時も同じ分類の *repository.LLMError にする
+	ErrorKind    string `json:"errorKind,omitempty"` // rate_limited, unavailable など
+	Provider     string `json:"provider,omitempty"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
+
+// replayError: 記録した失敗を、分類と再試行までの時間を含めて作り直す
+func (i cassetteInteraction) replayError() error {
+	err := errors.New(i.Error)
+	kind, ok := llmErrorKinds[i.ErrorKind]
+	if !ok {
+		return err
+	}
+	provider := i.Provider
+	if provider == "" {
+		provider = "cassette"
+	}
+	return &repository.LLMError{
+		Kind:       kind,
+		Provider:   provider,
+		RetryAfter: time.Duration(i.RetryAfterMs) * time.Millisecond,
+		Err:        err,
+	}
+}
+
+// recordError: 失敗を記録する（分類できた失敗は分類と提供元のメッセージを分けて残す）
+func (i *cassetteInteraction) recordError(err error) {
+	i.Error = err.Error()
+	i.ErrorKind = llmErrorKindName(err)
+	var llmErr *repository.LLMError
+	if errors.As(err, &llmErr) {
+		i.Provider = llmErr.Provider
+		i.RetryAfterMs = llmErr.RetryAfter.Milliseconds()
+		if llmErr.Err != nil {
+			i.Error = llmErr.Err.Error()
+		}
+	}
+}
+
+type cassetteFile struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+// Cassette: 問い合わせと応答の組を保存するファイル
+// 複数のゲートウェイで1つのカセットを共有できる
+type Cassette struct {
+	path string
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	played       map[string]int // キーごとに再生した件数
+}
+
+// NewRecordingCassette: 空のカセットを作る（path は記録のたびに上書きする）
+func NewRecordingCassette(path string) *Cassette {
+	zap.L().Debug("Initializing recording cassette", zap.String("path", path))
+	return &Cassette{path: path, played: make(map[string]int)}
+}
+
+// LoadCassette: 記録済みのカセットを読み込む
+func LoadCassette(path string) (*Cassette, error) {
+	zap.L().Debug("Loading cassette", zap.String("path", path))
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var f cassetteFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	return &Cassette{
+		path:         path,
+		interactions: f.Interactions,
+		played:       make(map[string]int),
+	}, nil
+}
+
+// record: やり取りを追加し、ファイルに書き出す
+func (c *Cassette) record(i cassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, i)
+
+	b, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := writeFileAtomic(c.path, b); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic: 途中で落ちても壊れたファイルが残らないよう、一時ファイルから置き換える
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// play: キーに対応するやり取りを記録順に返す
+// 記録された件数より多く呼ばれた場合は最後のやり取りを繰り返す
+func (c *Cassette) play(key string) (cassetteInteraction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matched []cassetteInteraction
+	for _, i := range c.interactions {
+		if i.Key == key {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == 0 {
+		return cassetteInteraction{}, false
+	}
+	n := c.played[key]
+	c.played[key] = n + 1
+	if n >= len(matched) {
+		n = len(matched) - 1
+	}
+	return matched[n], true
+}
+
+// 他のゲートウェイを包み、問い合わせと応答をカセットに記録・再生する
+type CassetteLLMGateway struct {
+	inner    repository.LLMGateway // 再生時は使わない（nil でもよい）
+	cassette *Cassette
+	name     string // 同じカセットを共有するゲートウェイを区別する名前
+	mode     string // consts.CassetteModeRecord または consts.CassetteModeReplay
+}
+
+func NewCassetteLLMGateway(
+	inner repository.LLMGateway,
+	cassette *Cassette,
+	name, mode string,
+) (*CassetteLLMGateway, error) {
+	zap.L().Debug("Initializing CassetteLLMGateway",
+		zap.String("gateway", name), zap.String("mode", mode))
+
+	switch mode {
+	case consts.CassetteModeRecord:
+		if inner == nil {
+			return nil, fmt.Errorf("cassette record mode requires a gateway to record")
+		}
+	case consts.CassetteModeReplay:
+	default:
+		return nil, fmt.Errorf("unknown cassette mode: %q", mode)
+	}
+	return &CassetteLLMGateway{
+		inner:    inner,
+		cassette: cassette,
+		name:     name,
+		mode:     mode,
+	}, nil
+}
+
+func (g *CassetteLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 記録済みのカセットを使い続けられるよう、キーには system 以外のメッセージと利用者の入力だけを使う
+func (g *CassetteLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+	prompt, userInput := req.Prompt(), req.UserInput
+	key := cassetteKey(g.name, prompt, userInput)
+
+	if g.mode == consts.CassetteModeReplay {
+		i, ok := g.cassette.play(key)
+		if !ok {
+			logger.Error("Cassette miss",
+				zap.String("gateway", g.name), zap.String("key", key),
+				zap.String("prompt", prompt))
+			return "", fmt.Errorf("%w: gateway %s, key %s", ErrCassetteMiss, g.name, key)
+		}
+		logger.Debug("Cassette hit", zap.String("gateway", g.name), zap.String("key", key))
+		if i.Error != "" {
+			return "", i.replayError()
+		}
+		entity.StreamLLMResponse(ctx, i.Response)
+		return i.Response, nil
+	}
+
+	resp, err := g.inner.Generate(ctx, req)
+	i := cassetteInteraction{
+		Key:       key,
+		Gateway:   g.name,
+		Prompt:    prompt,
+		UserInput: userInput,
+		Response:  resp,
+	}
+	if err != nil {
+		// 呼び出し側の取り消しは LLM の振る舞いではないので記録しない
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		i.recordError(err)
+	}
+	if recErr := g.cassette.record(i); recErr != nil {
+		logger.Error("Failed to record cassette", zap.Error(recErr))
+		return "", recErr
+	}
+	return resp, err
+}
+
+// cassetteKey: 空白の違いを無視してプロンプトを比較するためのキー
+func cassetteKey(name, prompt, userInput string) string {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	sum := sha256.Sum256([]byte(name + "\x00" + normalize(prompt) + "\x00" +
+		normalize(userInput)))
+	return hex.EncodeToString(sum[:])
+}
+
+var _ repository.LLMGateway = (*CassetteLLMGateway)(nil)
@@ -0,0 +1,70 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+)
+
+// failingGateway: 常に同じエラーで失敗するゲートウェイ
+type failingGateway struct{ err error }
+
+func (g failingGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	return "", g.err
+}
+
+func (g failingGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 記録した失敗は、再生時も同じ分類・提供元・再試行までの時間のエラーになる
+func TestCassetteReplaysLLMErrorKind(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := gateway.NewCassetteLLMGateway(failingGateway{err: &repository.LLMError{
+		Kind:       repository.ErrLLMRateLimited,
+		Provider:   "gemini",
+		RetryAfter: 3 * time.Second,
+		Err:        errors.New("quota exceeded"),
+	}}, gateway.NewRecordingCassette(path), "primary", consts.CassetteModeRecord)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	if _, err := recorder.GenerateCultureUpdate(ctx, "prompt", "input"); err == nil {
+		t.Fatalf("recorder returned no error")
+	}
+
+	cassette, err := gateway.LoadCassette(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	player, err := gateway.NewCassetteLLMGateway(nil, cassette, "primary",
+		consts.CassetteModeReplay)
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	_, err = player.GenerateCultureUpdate(ctx, "prompt", "input")
+
+	if !errors.Is(err, repository.ErrLLMRateLimited) {
+		t.Fatalf("replayed error = %v, want %v", err, repository.ErrLLMRateLimited)
+	}
+	var llmErr *repository.LLMError
+	if !errors.As(err, &llmErr) || llmErr.Provider != "gemini" ||
+		llmErr.RetryAfter != 3*time.Second {
+		t.Errorf("replayed error = %#v, want provider gemini and retry after 3s", err)
+	}
+	if want := "gemini: llm rate limited: quota exceeded"; err.Error() != want {
+		t.Errorf("replayed message = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// サーキットブレーカーが開いているため問い合わせなかった
+var ErrCircuitOpen = errors.New("llm circuit breaker is open")
+
+// 他のゲートウェイを包み、提供元の失敗が続いたらしばらく問い合わせずに断る
+// 待ち時間が過ぎたら1件だけ試しに問い合わせ、成功すれば元に戻す
+type CircuitBreakerLLMGateway struct {
+	inner            repository.LLMGateway
+	name             string
+	failureThreshold int // 0 以下なら常に問い合わせる
+	cooldown         time.Duration
+	clock            clock
+
+	mu       sync.Mutex
+	state    string
+	openedAt time.Time
+	probing  bool // half_open で試しの問い合わせ中
+	stats    entity.LLMBreakerStats
+}
+
+func NewCircuitBreakerLLMGateway(
+	inner repository.LLMGateway,
+	name string,
+	failureThreshold int,
+	cooldown time.Duration,
+) *CircuitBreakerLLMGateway {
+	zap.L().Debug("Initializing CircuitBreakerLLMGateway",
+		zap.String("gateway", name),
+		zap.Int("failureThreshold", failureThreshold),
+		zap.Duration("cooldown", cooldown))
+	return &CircuitBreakerLLMGateway{
+		inner:            inner,
+		name:             name,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		clock:            systemClock{},
+		state:            entity.LLMBreakerClosed,
+		stats: entity.LLMBreakerStats{
+			Gateway:          name,
+			FailureThreshold: failureThreshold,
+			CooldownMs:       cooldown.Milliseconds(),
+		},
+	}
+}
+
+func (g *CircuitBreakerLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *CircuitBreakerLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	probe, err := g.allow()
+	if err != nil {
+		zap.L().Debug("LLM call rejected by circuit breaker", zap.String("gateway", g.name))
+		return "", err
+	}
+
+	resp, err := g.inner.Generate(ctx, req)
+	g.done(probe, err, ctx.Err() != nil)
+	return resp, err
+}
+
+// allow: 問い合わせてよければ、それが half_open での試しの問い合わせかを返す
+func (g *CircuitBreakerLLMGateway) allow() (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failureThreshold <= 0 {
+		return false, nil
+	}
+
+	if g.state == entity.LLMBreakerOpen && g.clock.Now().Sub(g.openedAt) >= g.cooldown {
+		g.setState(entity.LLMBreakerHalfOpen)
+	}
+	switch {
+	case g.state == entity.LLMBreakerClosed:
+		return false, nil
+	case g.state == entity.LLMBreakerHalfOpen && !g.probing:
+		g.probing = true
+		return true, nil
+	default:
+		g.stats.Rejected++
+		var retryAfter time.Duration
+		if g.state == entity.LLMBreakerOpen {
+			retryAfter = g.cooldown - g.clock.Now().Sub(g.openedAt)
+		}
+		return false, &repository.LLMError{
+			Kind:       repository.ErrLLMUnavailable,
+			Provider:   g.name,
+			RetryAfter: retryAfter,
+			Err:        fmt.Errorf("%w: %s", ErrCircuitOpen, g.state),
+		}
+	}
+}
+
+// done: 問い合わせの結果で状態を更新する
+func (g *CircuitBreakerLLMGateway) done(probe bool, err error, canceled bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failureThreshold <= 0 {
+		return
+	}
+	if probe {
+		g.probing = false
+	}
+
+	// 呼び出し側の取り消しは提供元の不調とみなさない
+	if err != nil && canceled {
+		return
+	}
+	// 内容による失敗は、提供元は応答しているので成功と同じく扱う
+	if err == nil || errors.Is(err, repository.ErrLLMSafetyBlocked) ||
+		errors.Is(err, repository.ErrLLMOutput) {
+		if err == nil {
+			g.stats.Successes++
+		}
+		g.stats.ConsecutiveFailures = 0
+		if g.state != entity.LLMBreakerClosed {
+			zap.L().Info("LLM circuit breaker closed", zap.String("gateway", g.name))
+			g.setState(entity.LLMBreakerClosed)
+		}
+		return
+	}
+
+	g.stats.Failures++
+	g.stats.ConsecutiveFailures++
+	g.stats.LastError = err.Error()
+	if probe || (g.state == entity.LLMBreakerClosed &&
+		g.stats.ConsecutiveFailures >= g.failureThreshold) {
+		g.openedAt = g.clock.Now()
+		g.setState(entity.LLMBreakerOpen)
+		zap.L().Warn("LLM circuit breaker opened",
+			zap.String("gateway", g.name),
+			zap.Int("consecutiveFailures", g.stats.ConsecutiveFailures),
+			zap.Duration("cooldown", g.cooldown), zap.Error(err))
+	}
+}
+
+// setState: 状態を変える（mu を持って呼ぶ）
+func (g *CircuitBreakerLLMGateway) setState(state string) {
+	g.state = state
+	if state == entity.LLMBreakerOpen {
+		openedAt := g.openedAt
+		g.stats.OpenedAt = &openedAt
+	}
+}
+
+// BreakerStats: サーキットブレーカーの状況
+func (g *CircuitBreakerLLMGateway) BreakerStats() entity.LLMBreakerStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// 待ち時間が過ぎていれば、次の問い合わせで試す状態として見せる
+	if g.state == entity.LLMBreakerOpen && g.clock.Now().Sub(g.openedAt) >= g.cooldown {
+		g.setState(entity.LLMBreakerHalfOpen)
+	}
+	stats := g.stats
+	stats.State = g.state
+	return stats
+}
+
+var (
+	_ repository.LLMGateway         = (*CircuitBreakerLLMGateway)(nil)
+	_ repository.LLMBreakerReporter = (*CircuitBreakerLLMGateway)(nil)
+)
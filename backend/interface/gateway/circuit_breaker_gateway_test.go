@@ -0,0 +1,251 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// switchGateway: 次の問い合わせで返すエラーを切り替えられるゲートウェイ
+type switchGateway struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (g *switchGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	if g.err != nil {
+		return "", g.err
+	}
+	return "ok", nil
+}
+
+func (g *switchGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *switchGateway) set(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.err = err
+}
+
+func (g *switchGateway) Calls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+// breakerStep: 時計を進めてから1回問い合わせ、その結果と状態を確かめる
+type breakerStep struct {
+	advance        time.Duration
+	err            error // 包んだゲートウェイが返すエラー
+	canceled       bool  // 呼び出し側が取り消した
+	wantRejected   bool  // 問い合わせずに断る
+	wantRetryAfter time.Duration
+	wantState      string
+}
+
+func TestCircuitBreakerGateway(t *testing.T) {
+	unavailable := llmError(repository.ErrLLMUnavailable, 0)
+	fail := breakerStep{err: unavailable, wantState: entity.LLMBreakerClosed}
+	ok := breakerStep{wantState: entity.LLMBreakerClosed}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []breakerStep
+	}{
+		{
+			name: "opens after consecutive failures", threshold: 3,
+			steps: []breakerStep{fail, fail,
+				{err: unavailable, wantState: entity.LLMBreakerOpen},
+				{advance: 4 * time.Second, wantRejected: true, wantRetryAfter: 6 * time.Second,
+					wantState: entity.LLMBreakerOpen},
+			},
+		},
+		{
+			name: "success resets the consecutive failures", threshold: 3,
+			steps: []breakerStep{fail, fail, ok, fail, fail},
+		},
+		{
+			name: "output and safety errors count as answers", threshold: 2,
+			steps: []breakerStep{fail,
+				{err: llmError(repository.ErrLLMOutput, 0), wantState: entity.LLMBreakerClosed},
+				fail,
+				{err: llmError(repository.ErrLLMSafetyBlocked, 0),
+					wantState: entity.LLMBreakerClosed},
+				fail,
+			},
+		},
+		{
+			name: "caller cancellation is not counted", threshold: 2,
+			steps: []breakerStep{fail,
+				{err: context.Canceled, canceled: true, wantState: entity.LLMBreakerClosed},
+				{err: unavailable, wantState: entity.LLMBreakerOpen},
+			},
+		},
+		{
+			name: "half-open probe success closes the circuit", threshold: 1,
+			steps: []breakerStep{
+				{err: unavailable, wantState: entity.LLMBreakerOpen},
+				{advance: 9 * time.Second, wantRejected: true, wantRetryAfter: time.Second,
+					wantState: entity.LLMBreakerOpen},
+				{advance: time.Second, wantState: entity.LLMBreakerClosed},
+				ok,
+			},
+		},
+		{
+			name: "half-open probe failure reopens the circuit", threshold: 1,
+			steps: []breakerStep{
+				{err: unavailable, wantState: entity.LLMBreakerOpen},
+				{advance: 10 * time.Second, err: unavailable, wantState: entity.LLMBreakerOpen},
+				{wantRejected: true, wantRetryAfter: 10 * time.Second,
+					wantState: entity.LLMBreakerOpen},
+			},
+		},
+		{
+			name: "never opens without a threshold", threshold: 0,
+			steps: []breakerStep{fail, fail, fail, fail},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			inner := &switchGateway{}
+			g := gateway.NewCircuitBreakerLLMGateway(inner, "fake", tt.threshold,
+				10*time.Second)
+			g.SetClock(clock)
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+				inner.set(step.err)
+				ctx, cancel := context.WithCancel(context.Background())
+				if step.canceled {
+					cancel()
+				}
+				calls := inner.Calls()
+				_, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+				cancel()
+
+				var llmErr *repository.LLMError
+				switch {
+				case step.wantRejected:
+					if !errors.Is(err, gateway.ErrCircuitOpen) ||
+						!errors.Is(err, repository.ErrLLMUnavailable) ||
+						!errors.As(err, &llmErr) || llmErr.RetryAfter != step.wantRetryAfter {
+						t.Fatalf("step %d: error = %v, want circuit open retrying after %v",
+							i, err, step.wantRetryAfter)
+					}
+					if inner.Calls() != calls {
+						t.Fatalf("step %d: rejected call reached the gateway", i)
+					}
+				case step.err == nil && err != nil:
+					t.Fatalf("step %d: failed to generate: %v", i, err)
+				case step.err != nil && !errors.Is(err, step.err):
+					t.Fatalf("step %d: error = %v, want %v", i, err, step.err)
+				}
+				if state := g.BreakerStats().State; state != step.wantState {
+					t.Fatalf("step %d: state = %s, want %s", i, state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+// 待ち時間が過ぎたら状況は half_open として見せる
+func TestCircuitBreakerStatsShowHalfOpen(t *testing.T) {
+	clock := newFakeClock()
+	g := gateway.NewCircuitBreakerLLMGateway(
+		&switchGateway{err: llmError(repository.ErrLLMUnavailable, 0)}, "fake", 1, time.Minute)
+	g.SetClock(clock)
+
+	g.GenerateCultureUpdate(context.Background(), "prompt", "")
+	stats := g.BreakerStats()
+	if stats.State != entity.LLMBreakerOpen || stats.OpenedAt == nil ||
+		!stats.OpenedAt.Equal(clock.Now()) || stats.ConsecutiveFailures != 1 {
+		t.Fatalf("stats = %+v, want open at %v", stats, clock.Now())
+	}
+	clock.Advance(time.Minute)
+	if state := g.BreakerStats().State; state != entity.LLMBreakerHalfOpen {
+		t.Errorf("state = %s, want %s", state, entity.LLMBreakerHalfOpen)
+	}
+}
+
+// probeGateway: 最初の問い合わせは失敗し、2回目は release を閉じるまで応答しない
+type probeGateway struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (g *probeGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	g.mu.Lock()
+	g.calls++
+	calls := g.calls
+	g.mu.Unlock()
+	if calls == 1 {
+		return "", llmError(repository.ErrLLMUnavailable, 0)
+	}
+	close(g.entered)
+	<-g.release
+	return "ok", nil
+}
+
+func (g *probeGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// half_open では試しの問い合わせを1件だけ通し、その間の問い合わせは断る
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	clock := newFakeClock()
+	inner := &probeGateway{entered: make(chan struct{}), release: make(chan struct{})}
+	g := gateway.NewCircuitBreakerLLMGateway(inner, "fake", 1, time.Second)
+	g.SetClock(clock)
+	ctx := context.Background()
+
+	g.GenerateCultureUpdate(ctx, "prompt", "")
+	clock.Advance(time.Second)
+
+	probe := make(chan error, 1)
+	go func() {
+		_, err := g.GenerateCultureUpdate(ctx, "probe", "")
+		probe <- err
+	}()
+	<-inner.entered
+
+	_, err := g.GenerateCultureUpdate(ctx, "during probe", "")
+	var llmErr *repository.LLMError
+	if !errors.Is(err, gateway.ErrCircuitOpen) || !errors.As(err, &llmErr) ||
+		llmErr.RetryAfter != 0 {
+		t.Errorf("error = %v, want circuit open without retry after", err)
+	}
+	if state := g.BreakerStats().State; state != entity.LLMBreakerHalfOpen {
+		t.Errorf("state during probe = %s, want %s", state, entity.LLMBreakerHalfOpen)
+	}
+
+	close(inner.release)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	stats := g.BreakerStats()
+	if stats.State != entity.LLMBreakerClosed || stats.Rejected != 1 || stats.Successes != 1 {
+		t.Errorf("stats = %+v, want closed with 1 rejected and 1 success", stats)
+	}
+}
@@ -0,0 +1,15 @@
+package gateway
+
+import "time"
+
+// clock: 現在時刻と待ち時間（テストでは時間を進めずに待たせる時計に差し替える）
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
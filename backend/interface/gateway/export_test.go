@@ -0,0 +1,13 @@
+package gateway
+
+// テストから時計を差し替える
+
+type Clock = clock
+
+func (g *RetryLLMGateway) SetClock(c Clock) { g.clock = c }
+
+func (g *RateLimitedLLMGateway) SetClock(c Clock) { g.clock = c }
+
+func (g *CircuitBreakerLLMGateway) SetClock(c Clock) { g.clock = c }
+
+func (c *LLMCache) SetClock(cl Clock) { c.clock = cl }
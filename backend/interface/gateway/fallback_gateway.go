@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// NamedLLMGateway: フォールバックの連鎖の1つ
+type NamedLLMGateway struct {
+	Name    string
+	Gateway repository.LLMGateway
+}
+
+// 優先順に並べたゲートウェイに問い合わせ、失敗したら次のゲートウェイに問い合わせる
+// サーキットブレーカーが開いているゲートウェイは問い合わせずに飛ばす
+type FallbackLLMGateway struct {
+	chain []NamedLLMGateway
+}
+
+func NewFallbackLLMGateway(
+	chain ...NamedLLMGateway,
+) *FallbackLLMGateway {
+	names := make([]string, len(chain))
+	for i, c := range chain {
+		names[i] = c.Name
+	}
+	zap.L().Debug("Initializing FallbackLLMGateway", zap.Strings("chain", names))
+	return &FallbackLLMGateway{chain: chain}
+}
+
+func (g *FallbackLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *FallbackLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+
+	if len(g.chain) == 0 {
+		return "", errors.New("no gateways in fallback chain")
+	}
+
+	var firstErr error
+	for i, c := range g.chain {
+		resp, err := c.Gateway.Generate(ctx, req)
+		if err == nil {
+			if i > 0 {
+				logger.Info("LLM call answered by fallback gateway",
+					zap.String("gateway", c.Name), zap.Int("position", i))
+			}
+			entity.ReportLLMAnsweredBy(ctx, c.Name)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+
+		if errors.Is(err, ErrCircuitOpen) {
+			logger.Debug("Skipping gateway with open circuit", zap.String("gateway", c.Name))
+		} else {
+			logger.Warn("LLM call failed, falling back",
+				zap.String("gateway", c.Name), zap.Error(err))
+		}
+		// 飛ばしただけのゲートウェイより、実際に失敗したゲートウェイの理由を返す
+		if firstErr == nil || (errors.Is(firstErr, ErrCircuitOpen) &&
+			!errors.Is(err, ErrCircuitOpen)) {
+			firstErr = err
+		}
+	}
+	logger.Error("All gateways in fallback chain failed", zap.Error(firstErr))
+	return "", fmt.Errorf("all gateways in fallback chain failed: %w", firstErr)
+}
+
+var _ repository.LLMGateway = (*FallbackLLMGateway)(nil)
@@ -0,0 +1,76 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// 失敗したら次のゲートウェイに回し、ブレーカーが開いたゲートウェイは問い合わせずに飛ばす
+func TestFallbackGatewaySkipsOpenCircuit(t *testing.T) {
+	primary := &switchGateway{err: llmError(repository.ErrLLMUnavailable, 0)}
+	secondary := &switchGateway{}
+	breaker := gateway.NewCircuitBreakerLLMGateway(primary, "primary", 1, time.Minute)
+	breaker.SetClock(newFakeClock())
+	g := gateway.NewFallbackLLMGateway(
+		gateway.NamedLLMGateway{Name: "primary", Gateway: breaker},
+		gateway.NamedLLMGateway{Name: "secondary", Gateway: secondary},
+	)
+
+	for i := range 2 {
+		var report entity.LLMCallReport
+		ctx := entity.ContextWithLLMCallReport(context.Background(), &report)
+		resp, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+		if err != nil || resp != "ok" {
+			t.Fatalf("call %d: got (%q, %v), want ok", i, resp, err)
+		}
+		if report.AnsweredBy != "secondary" {
+			t.Errorf("call %d: answered by %q, want secondary", i, report.AnsweredBy)
+		}
+	}
+	// 2回目はブレーカーが開いているので primary には問い合わせない
+	if primary.Calls() != 1 || secondary.Calls() != 2 {
+		t.Errorf("calls = primary %d, secondary %d; want 1 and 2",
+			primary.Calls(), secondary.Calls())
+	}
+}
+
+// すべて失敗した場合は、飛ばしただけのゲートウェイより実際に失敗した理由を返す
+func TestFallbackGatewayReturnsRealFailure(t *testing.T) {
+	breaker := gateway.NewCircuitBreakerLLMGateway(
+		&switchGateway{err: llmError(repository.ErrLLMUnavailable, 0)}, "primary", 1, time.Minute)
+	breaker.SetClock(newFakeClock())
+	breaker.GenerateCultureUpdate(context.Background(), "prompt", "") // ブレーカーを開く
+	g := gateway.NewFallbackLLMGateway(
+		gateway.NamedLLMGateway{Name: "primary", Gateway: breaker},
+		gateway.NamedLLMGateway{Name: "secondary", Gateway: &switchGateway{
+			err: llmError(repository.ErrLLMInvalidRequest, 0)}},
+	)
+
+	_, err := g.GenerateCultureUpdate(context.Background(), "prompt", "")
+	if !errors.Is(err, repository.ErrLLMInvalidRequest) || errors.Is(err, gateway.ErrCircuitOpen) {
+		t.Errorf("error = %v, want the secondary's invalid request", err)
+	}
+}
+
+// 呼び出し側が取り消したら次のゲートウェイに回さない
+func TestFallbackGatewayStopsWhenCanceled(t *testing.T) {
+	secondary := &switchGateway{}
+	g := gateway.NewFallbackLLMGateway(
+		gateway.NamedLLMGateway{Name: "primary", Gateway: &switchGateway{err: context.Canceled}},
+		gateway.NamedLLMGateway{Name: "secondary", Gateway: secondary},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.GenerateCultureUpdate(ctx, "prompt", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+	if secondary.Calls() != 0 {
+		t.Errorf("secondary calls = %d, want 0", secondary.Calls())
+	}
+}
@@ -2,14 +2,18 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
 	"github.com/rayfiyo/zousui/backend/utils/config"
 	"github.com/rayfiyo/zousui/backend/utils/consts"
 	"go.uber.org/zap"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -49,30 +53,267 @@ func NewGeminiLLMGateway(
 	}, nil
 }
 
-// LLMGatewayインタフェース
+// Gemini の応答を使えなかった理由
+var (
+	ErrGeminiNoCandidates = errors.New("gemini returned no candidates")
+	ErrGeminiBlocked      = errors.New("gemini blocked the content")
+	ErrGeminiEmptyText    = errors.New("gemini returned no text")
+)
+
+// GeminiFinishError: 出力の上限に達したなど、生成が正常に終わらなかった場合のエラー
+type GeminiFinishError struct {
+	Reason  genai.FinishReason
+	Partial string // 途中までの出力
+}
+
+func (e *GeminiFinishError) Error() string {
+	return fmt.Sprintf("gemini stopped generating: %s", e.Reason)
+}
+
 func (g *GeminiLLMGateway) GenerateCultureUpdate(
 	ctx context.Context,
 	prompt string,
 	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// LLMGatewayインタフェース
+// 応答形式の指定があれば、その JSON スキーマで出力させる
+// context に断片の受け取り先があれば、生成しながら断片を渡す
+func (g *GeminiLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
 ) (string, error) {
 	logger := zap.L()
 
-	logger.Debug("Generating culture update with Gemini", zap.String("prompt", prompt))
-	respRaw, err := g.Model.GenerateContent(ctx, genai.Text(prompt))
+	logger.Debug("Generating with Gemini", zap.String("prompt", req.Prompt()))
+	cs := g.model(req).StartChat()
+	contents := geminiContents(req.Conversation())
+	if len(contents) == 0 {
+		return "", errors.New("no message to send to gemini")
+	}
+	cs.History = contents[:len(contents)-1]
+	last := contents[len(contents)-1].Parts
+
+	var (
+		respRaw *genai.GenerateContentResponse
+		err     error
+	)
+	if stream := entity.LLMStreamFromContext(ctx); stream != nil {
+		respRaw, err = sendGeminiStream(ctx, cs, last, stream)
+	} else {
+		respRaw, err = cs.SendMessage(ctx, last...)
+	}
 	if err != nil {
 		logger.Error("Failed to generate content", zap.Error(err))
-		return "", fmt.Errorf("failed to generate content: %w", err)
+		return "", classifyGeminiError(err)
+	}
+	// 使えない応答でもトークンは消費しているので先に報告する
+	if u := respRaw.UsageMetadata; u != nil {
+		entity.ReportLLMTokens(ctx, int(u.PromptTokenCount), int(u.CandidatesTokenCount))
 	}
 
-	// 装飾の削除
-	resp := strings.ReplaceAll(fmt.Sprintln(respRaw.Candidates[0].Content.Parts),
-		"```", "")
-	resp = strings.ReplaceAll(resp, "json", "")
-	resp = strings.ReplaceAll(resp, "[", "")
-	resp = strings.ReplaceAll(resp, "]", "")
-
-	logger.Debug("Generated culture update", zap.String("response", resp))
+	resp, err := geminiText(respRaw)
+	if err != nil {
+		logger.Error("Unusable gemini response", zap.Error(err))
+		return "", classifyGeminiError(err)
+	}
+	logger.Debug("Generated response", zap.String("response", resp))
 	return resp, nil
 }
 
+// sendGeminiStream: 生成しながら最初の候補のテキストを stream に渡し、
+// 届いたチャンクを1つの応答にまとめる（利用量と終了理由は最後に届いたものを使う）
+func sendGeminiStream(
+	ctx context.Context,
+	cs *genai.ChatSession,
+	parts []genai.Part,
+	stream entity.LLMStreamFunc,
+) (*genai.GenerateContentResponse, error) {
+	stream(entity.LLMStreamEvent{Reset: true})
+
+	var (
+		text   strings.Builder
+		merged = &genai.GenerateContentResponse{}
+		cand   *genai.Candidate
+	)
+	iter := cs.SendMessageStream(ctx, parts...)
+	for {
+		chunk, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chunk.UsageMetadata != nil {
+			merged.UsageMetadata = chunk.UsageMetadata
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+		c := chunk.Candidates[0]
+		if cand == nil {
+			cand = &genai.Candidate{}
+		}
+		if c.FinishReason != genai.FinishReasonUnspecified {
+			cand.FinishReason = c.FinishReason
+		}
+		if c.Content == nil {
+			continue
+		}
+		for _, part := range c.Content.Parts {
+			if t, ok := part.(genai.Text); ok && t != "" {
+				text.WriteString(string(t))
+				stream(entity.LLMStreamEvent{Text: string(t)})
+			}
+		}
+	}
+	if cand != nil {
+		cand.Content = &genai.Content{Parts: []genai.Part{genai.Text(text.String())}}
+		merged.Candidates = []*genai.Candidate{cand}
+	}
+	return merged, nil
+}
+
+// model: 問い合わせの system メッセージ・応答形式・生成の設定を反映したモデルの設定の複製
+func (g *GeminiLLMGateway) model(req *entity.LLMRequest) *genai.GenerativeModel {
+	m := *g.Model
+	system := req.SystemPrompt()
+	if req.Schema != nil {
+		m.ResponseMIMEType = "application/json"
+		m.ResponseSchema = geminiSchema(req.Schema)
+		// 形式はスキーマで指定するので、文化の更新に限った既定の指示は使わない
+		if system == "" {
+			system = consts.GeminiJSONInstruction
+		}
+		zap.L().Debug("Using response schema", zap.String("schema", req.Schema.Name))
+	}
+	if system != "" {
+		m.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(system)}}
+	}
+
+	s := req.Sampling
+	if s.Temperature != nil {
+		m.SetTemperature(float32(*s.Temperature))
+	}
+	if s.TopP != nil {
+		m.SetTopP(float32(*s.TopP))
+	}
+	if s.MaxTokens > 0 {
+		m.SetMaxOutputTokens(int32(s.MaxTokens))
+	}
+	// 使っている SDK は seed に対応していないため、Seed は送らない
+	return &m
+}
+
+// geminiContents: 会話を Gemini の内容にする（同じ役割が続くメッセージは1つにまとめる）
+func geminiContents(msgs []entity.LLMMessage) []*genai.Content {
+	var contents []*genai.Content
+	for _, msg := range msgs {
+		role := "user"
+		if msg.Role == entity.LLMRoleAssistant {
+			role = "model"
+		}
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, genai.Text(msg.Content))
+			continue
+		}
+		contents = append(contents, &genai.Content{
+			Role:  role,
+			Parts: []genai.Part{genai.Text(msg.Content)},
+		})
+	}
+	return contents
+}
+
+// classifyGeminiError: Gemini のエラーを提供元によらない分類にする
+func classifyGeminiError(err error) error {
+	var (
+		blocked *genai.BlockedError
+		apiErr  *googleapi.Error
+		finish  *GeminiFinishError
+	)
+	switch {
+	case errors.As(err, &blocked):
+		err = fmt.Errorf("%w: %v", ErrGeminiBlocked, blocked)
+		fallthrough
+	case errors.Is(err, ErrGeminiBlocked):
+		return &repository.LLMError{
+			Kind:     repository.ErrLLMSafetyBlocked,
+			Provider: consts.LLMProviderGemini,
+			Err:      err,
+		}
+	case errors.Is(err, ErrGeminiNoCandidates), errors.Is(err, ErrGeminiEmptyText),
+		errors.As(err, &finish):
+		return badOutputError(consts.LLMProviderGemini, err)
+	case errors.As(err, &apiErr):
+		return classifyHTTPStatus(consts.LLMProviderGemini, apiErr.Code, apiErr.Header,
+			fmt.Errorf("failed to generate content: %w", err))
+	default:
+		return transportError(consts.LLMProviderGemini,
+			fmt.Errorf("failed to generate content: %w", err))
+	}
+}
+
+// geminiText: 最初の候補のテキストのパートをつなげる（JSON の取り出しは呼び出し側で行う）
+func geminiText(resp *genai.GenerateContentResponse) (string, error) {
+	if resp == nil || len(resp.Candidates) == 0 {
+		return "", ErrGeminiNoCandidates
+	}
+	cand := resp.Candidates[0]
+
+	var sb strings.Builder
+	if cand.Content != nil {
+		for _, part := range cand.Content.Parts {
+			if text, ok := part.(genai.Text); ok {
+				sb.WriteString(string(text))
+			}
+		}
+	}
+	text := sb.String()
+
+	switch cand.FinishReason {
+	case genai.FinishReasonUnspecified, genai.FinishReasonStop:
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation:
+		return "", fmt.Errorf("%w: %s", ErrGeminiBlocked, cand.FinishReason)
+	default:
+		return "", &GeminiFinishError{Reason: cand.FinishReason, Partial: text}
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", ErrGeminiEmptyText
+	}
+	return text, nil
+}
+
+// geminiSchema: 応答形式を Gemini の JSON スキーマにする
+func geminiSchema(s *entity.ResponseSchema) *genai.Schema {
+	schema := &genai.Schema{
+		Type:       genai.TypeObject,
+		Properties: make(map[string]*genai.Schema, len(s.Fields)),
+	}
+	for _, f := range s.Fields {
+		prop := &genai.Schema{}
+		switch f.Type {
+		case entity.SchemaString:
+			prop.Type = genai.TypeString
+			if len(f.Enum) > 0 {
+				prop.Format = "enum"
+				prop.Enum = f.Enum
+			}
+		case entity.SchemaInteger:
+			prop.Type = genai.TypeInteger
+			if f.Min != nil && f.Max != nil {
+				prop.Description = fmt.Sprintf("%d から %d の整数", *f.Min, *f.Max)
+			}
+		}
+		schema.Properties[f.Name] = prop
+		if f.Required {
+			schema.Required = append(schema.Required, f.Name)
+		}
+	}
+	return schema
+}
+
 var _ repository.LLMGateway = (*GeminiLLMGateway)(nil)
@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+)
+
+// 設定ファイルやカセットに書く失敗の分類の名前
+var llmErrorKinds = map[string]error{
+	"rate_limited":    repository.ErrLLMRateLimited,
+	"unavailable":     repository.ErrLLMUnavailable,
+	"invalid_request": repository.ErrLLMInvalidRequest,
+	"safety_blocked":  repository.ErrLLMSafetyBlocked,
+	"bad_output":      repository.ErrLLMOutput,
+}
+
+// llmErrorKindName: err の分類の名前（分類できない失敗は空文字列）
+func llmErrorKindName(err error) string {
+	for name, kind := range llmErrorKinds {
+		if errors.Is(err, kind) {
+			return name
+		}
+	}
+	return ""
+}
+
+// classifyHTTPStatus: 提供元の HTTP の応答コードから失敗を分類する
+func classifyHTTPStatus(
+	provider string,
+	code int,
+	header http.Header,
+	err error,
+) error {
+	kind := repository.ErrLLMInvalidRequest
+	switch {
+	case code == http.StatusTooManyRequests:
+		kind = repository.ErrLLMRateLimited
+	case code == http.StatusRequestTimeout || code >= http.StatusInternalServerError:
+		kind = repository.ErrLLMUnavailable
+	}
+	return &repository.LLMError{
+		Kind:       kind,
+		Provider:   provider,
+		RetryAfter: retryAfter(header),
+		Err:        err,
+	}
+}
+
+// transportError: 接続できない・時間切れなど、応答を受け取れなかった失敗
+func transportError(provider string, err error) error {
+	return &repository.LLMError{
+		Kind:     repository.ErrLLMUnavailable,
+		Provider: provider,
+		Err:      err,
+	}
+}
+
+// badOutputError: 応答は受け取れたが使える内容が無い
+func badOutputError(provider string, err error) error {
+	return &repository.LLMError{
+		Kind:     repository.ErrLLMOutput,
+		Provider: provider,
+		Err:      err,
+	}
+}
+
+// retryAfter: Retry-After ヘッダ（秒数または日時）を解釈する
+func retryAfter(header http.Header) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
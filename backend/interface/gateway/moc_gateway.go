@@ -2,31 +2,37 @@ package gateway
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
 	"go.uber.org/zap"
 )
 
 type MockLLMGatewayJSON struct{}
 
-// LLMに問い合わせて、文化の変化をJSONで取得する
 func (m *MockLLMGatewayJSON) GenerateCultureUpdate(
 	ctx context.Context,
 	prompt string,
 	userInput string,
+) (string, error) {
+	return m.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// LLMに問い合わせて、文化の変化をJSONで取得する（問い合わせの内容によらず同じ応答を返す）
+func (m *MockLLMGatewayJSON) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
 ) (string, error) {
 	logger := zap.L()
 
-	logger.Debug("Mock GenerateCultureUpdate called", zap.String("prompt", prompt))
+	logger.Debug("Mock Generate called", zap.String("prompt", req.Prompt()))
 	jsonResult := `{
         "newCulture": "踊りを中心にした新たな祭典文化",
         "populationChange": 15
     }`
 
 	logger.Debug("Mock response", zap.String("response", jsonResult))
-	fmt.Println("[DEBUG] Prompt to LLM:", prompt)
-	fmt.Println("[DEBUG] Return JSON:", jsonResult)
+	entity.StreamLLMResponse(ctx, jsonResult)
 	return jsonResult, nil
 }
 
@@ -1,27 +1,52 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"math/rand"
+	"slices"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
 	"github.com/rayfiyo/zousui/backend/utils/consts"
 	"go.uber.org/zap"
 )
 
 type MultiLLMGateway struct {
-	subGateways []repository.LLMGateway
+	subGateways []NamedLLMGateway
+	aggregator  repository.LLMGateway // 集約プロンプトでの再問い合わせや、候補を選ばせるゲートウェイ
+	strategies  map[string]string     // シミュレーションの種類ごとの回答のまとめ方 (entity.LLMAggregate*)
+	timeout     time.Duration         // サブゲートウェイごとの期限（0 なら期限なし）
+	quorum      int                   // 形式に合った回答がこの数そろったら残りを待たない（0 ならすべて待つ）
 }
 
+// aggregator が nil なら先頭のサブゲートウェイで再問い合わせする
+// strategies に無い種類のシミュレーションでは、回答をまとめた集約プロンプトで新たな回答を作らせる
 func NewMultiLLMGateway(
-	subGateways ...repository.LLMGateway,
+	aggregator repository.LLMGateway,
+	strategies map[string]string,
+	timeout time.Duration,
+	quorum int,
+	subGateways ...NamedLLMGateway,
 ) *MultiLLMGateway {
+	zap.L().Debug("Initializing MultiLLMGateway",
+		zap.Int("subGateways", len(subGateways)), zap.Any("strategies", strategies),
+		zap.Duration("timeout", timeout), zap.Int("quorum", quorum))
+	if aggregator == nil && len(subGateways) > 0 {
+		aggregator = subGateways[0].Gateway
+	}
 	return &MultiLLMGateway{
 		subGateways: subGateways,
+		aggregator:  aggregator,
+		strategies:  strategies,
+		timeout:     timeout,
+		quorum:      quorum,
 	}
 }
 
@@ -40,12 +65,20 @@ func mergeResponses(responses []string) string {
 	return strings.Join(responses, "\n")
 }
 
-// 各サブゲートウェイへ並列問い合わせし、各回答をマージした上で、
-// ユーザー入力を加えた集約プロンプトを作成し、再問い合わせする
 func (m *MultiLLMGateway) GenerateCultureUpdate(
 	ctx context.Context,
 	prompt string,
 	userInput string,
+) (string, error) {
+	return m.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 各サブゲートウェイへ並列問い合わせし、シミュレーションの種類ごとに指定した方法で回答をまとめる
+// 期限を過ぎた・定足数がそろって取り消したサブゲートウェイの回答は使わない
+// 候補とまとめ方はやり取りの記録に残す
+func (m *MultiLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
 ) (string, error) {
 	logger := zap.L()
 
@@ -54,62 +87,478 @@ func (m *MultiLLMGateway) GenerateCultureUpdate(
 		return "", errors.New("no sub gateways available")
 	}
 
-	// 並列呼び出し
-	type resp struct {
-		output string
-		err    error
+	cands, err := m.fanOut(ctx, req)
+	entity.ReportLLMAggregation(ctx, cands.LLMAggregation)
+	if err != nil {
+		return "", err
+	}
+	outputs := cands.outputs()
+	schema := req.Schema
+
+	var final string
+	switch cands.Strategy {
+	case entity.LLMAggregateFirstValid:
+		final = cands.firstValid()
+	case entity.LLMAggregateVote:
+		final = cands.vote(schema)
+	case entity.LLMAggregateMean, entity.LLMAggregateMedian:
+		final, err = cands.combineIntegers(schema)
+	case entity.LLMAggregateJudge:
+		final, err = m.judge(ctx, req, cands)
+	default:
+		final, err = m.synthesize(ctx, req, outputs)
+	}
+	if err != nil {
+		logger.Error("Final aggregated call failed",
+			zap.String("strategy", cands.Strategy), zap.Error(err))
+		return "", err
+	}
+	logger.Debug("Final aggregated response",
+		zap.String("strategy", cands.Strategy), zap.String("response", final))
+	// 集約プロンプトでの問い合わせは生成しながら流すので、それ以外は決まった回答をまとめて流す
+	if cands.Strategy != entity.LLMAggregateSynthesize {
+		entity.StreamLLMResponse(ctx, final)
+	}
+	return final, nil
+}
+
+// fanOut: 各サブゲートウェイへ並列に問い合わせ、届いた順に応答の形式に合うかを調べる
+// それぞれの問い合わせには m.timeout の期限を付け、形式に合った回答が m.quorum 件そろうか
+// 期限を過ぎたら、残りの問い合わせを取り消してすぐに戻る（残りの応答は待たずに捨てる）
+func (m *MultiLLMGateway) fanOut(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (*candidates, error) {
+	logger := zap.L()
+
+	type result struct {
+		i        int
+		output   string
+		err      error
+		timedOut bool
+		latency  time.Duration
 	}
-	responses := make([]resp, len(m.subGateways))
-	var wg sync.WaitGroup
-	wg.Add(len(m.subGateways))
+	// 戻った後に届く応答も、受け取り手がいなくても書き込めるよう全員分の枠を用意する
+	results := make(chan result, len(m.subGateways))
+	// 候補の生成の途中は呼び出し側に流さない
+	// 戻った後も問い合わせ続ける候補が、まとめた問い合わせの情報に書き込まないようにする
+	fanOutCtx, cancelRemaining := context.WithCancel(entity.ContextWithLLMCallReport(
+		entity.ContextWithoutLLMStream(entity.ContextWithLLMStage(ctx, entity.LLMStageFanOut)),
+		nil))
+	defer cancelRemaining()
 	for i, gw := range m.subGateways {
 		go func(i int, gw repository.LLMGateway) {
-			defer wg.Done()
-			out, err := gw.GenerateCultureUpdate(ctx, prompt, userInput)
-			responses[i] = resp{output: out, err: err}
-		}(i, gw)
+			callCtx := fanOutCtx
+			if m.timeout > 0 {
+				var cancel context.CancelFunc
+				callCtx, cancel = context.WithTimeout(fanOutCtx, m.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			out, err := gw.Generate(callCtx, req)
+			results <- result{
+				i:      i,
+				output: out,
+				err:    err,
+				// 呼び出し元の期限ではなく、サブゲートウェイごとの期限を過ぎた
+				timedOut: err != nil && fanOutCtx.Err() == nil &&
+					errors.Is(callCtx.Err(), context.DeadlineExceeded),
+				latency: time.Since(start),
+			}
+		}(i, gw.Gateway)
+	}
+
+	schema := req.Schema
+	cands := &candidates{
+		LLMAggregation: &entity.LLMAggregation{
+			Strategy:   m.strategy(req),
+			Candidates: make([]entity.LLMCandidate, len(m.subGateways)),
+		},
+		objects: make([]map[string]any, len(m.subGateways)),
+	}
+	for i, gw := range m.subGateways {
+		cands.Candidates[i].Gateway = gw.Name
+	}
+	var (
+		firstErr        error
+		valid, timedOut int
+		arrived         = make([]bool, len(m.subGateways))
+	)
+	// giveUp: まだ戻らないサブゲートウェイの候補に待つのをやめた理由を記録し、その名前を返す
+	giveUp := func(mark func(c *entity.LLMCandidate)) []string {
+		var remaining []string
+		for i, ok := range arrived {
+			if !ok {
+				mark(&cands.Candidates[i])
+				remaining = append(remaining, m.subGateways[i].Name)
+			}
+		}
+		return remaining
+	}
+	// 期限を無視して戻らないサブゲートウェイも待たない
+	var deadline <-chan time.Time
+	if m.timeout > 0 {
+		timer := time.NewTimer(m.timeout)
+		defer timer.Stop()
+		deadline = timer.C
 	}
-	wg.Wait()
 
-	valid := []string{}
-	for _, r := range responses {
-		if r.err == nil && r.output != "" {
-			valid = append(valid, r.output)
+collect:
+	for pending := len(m.subGateways); pending > 0; pending-- {
+		var r result
+		select {
+		case r = <-results:
+		case <-deadline:
+			remaining := giveUp(func(c *entity.LLMCandidate) {
+				c.Error = fmt.Sprintf("no response within %s", m.timeout)
+				c.TimedOut = true
+				c.LatencyMs = m.timeout.Milliseconds()
+				timedOut++
+			})
+			logger.Warn("LLM sub gateways timed out",
+				zap.Strings("gateways", remaining), zap.Duration("timeout", m.timeout))
+			break collect
+		case <-ctx.Done():
+			giveUp(func(c *entity.LLMCandidate) {
+				c.Error = ctx.Err().Error()
+				c.Canceled = true
+			})
+			return cands, ctx.Err()
+		}
+
+		arrived[r.i] = true
+		c := &cands.Candidates[r.i]
+		c.Response = r.output
+		c.LatencyMs = r.latency.Milliseconds()
+		switch {
+		case r.err != nil:
+			c.Error = r.err.Error()
+			if r.timedOut {
+				c.TimedOut = true
+				timedOut++
+				logger.Warn("LLM sub gateway timed out",
+					zap.String("gateway", c.Gateway), zap.Duration("timeout", m.timeout))
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		case r.output != "":
+			c.Valid = true
+			if schema != nil {
+				cands.objects[r.i], c.Valid = parseCandidate(r.output, schema)
+			}
+			if c.Valid {
+				valid++
+			}
+		}
+
+		if m.quorum > 0 && valid >= m.quorum {
+			remaining := giveUp(func(c *entity.LLMCandidate) {
+				c.Error = "canceled after quorum"
+				c.Canceled = true
+			})
+			if len(remaining) > 0 {
+				logger.Info("LLM quorum reached, canceling remaining sub gateways",
+					zap.Int("quorum", m.quorum), zap.Strings("remaining", remaining))
+			}
+			break collect
 		}
 	}
-	if len(valid) == 0 {
-		logger.Error("All sub gateway calls failed")
-		return "", errors.New("all sub gateway calls failed")
+
+	if len(cands.outputs()) == 0 {
+		logger.Error("All sub gateway calls failed", zap.Error(firstErr))
+		switch {
+		case timedOut == len(m.subGateways):
+			return cands, &repository.LLMError{
+				Kind:     repository.ErrLLMUnavailable,
+				Provider: "multi",
+				Err:      fmt.Errorf("all sub gateways timed out after %s", m.timeout),
+			}
+		case firstErr == nil:
+			return cands, errors.New("all sub gateway calls failed")
+		}
+		// 失敗の分類が分かるよう、最初の失敗を包んで返す
+		return cands, fmt.Errorf("all sub gateway calls failed: %w", firstErr)
 	}
+	return cands, nil
+}
+
+// strategy: シミュレーションの種類に応じた回答のまとめ方
+func (m *MultiLLMGateway) strategy(req *entity.LLMRequest) string {
+	if s, ok := m.strategies[req.SimulationType]; ok {
+		return s
+	}
+	return entity.LLMAggregateSynthesize
+}
+
+// synthesize: 各回答をマージした集約プロンプトを作成し、ユーザー入力を続けて再問い合わせする
+// system メッセージ・生成の設定・応答の形式は元の問い合わせのものを使う
+func (m *MultiLLMGateway) synthesize(
+	ctx context.Context,
+	req *entity.LLMRequest,
+	outputs []string,
+) (string, error) {
+	logger := zap.L()
 
 	// 複数の回答があればマージ
 	var merged string
-	if len(valid) == 1 {
-		merged = valid[0]
+	if len(outputs) == 1 {
+		merged = outputs[0]
 	} else {
-		merged = mergeResponses(valid)
+		merged = mergeResponses(outputs)
 	}
 
 	// マージ結果からランダムな単語を抽出（追加のインスピレーションとして利用）
-	randomWord := extractRandomWord(valid[rand.Intn(len(valid))])
+	randomWord := extractRandomWord(outputs[rand.Intn(len(outputs))])
 	if randomWord == "" {
 		randomWord = "革新"
 	}
 
 	// 集約プロンプトの生成
 	aggregatedPrompt := consts.AggregatedPromptHeader + "\n" + "キーワード: " +
-		randomWord + "追加情報: " + userInput + "複数のアイデア: " + merged
+		randomWord + "複数のアイデア: " + merged
 	logger.Debug("Aggregated prompt", zap.String("aggregatedPrompt", aggregatedPrompt))
 
-	// 先頭のサブゲートウェイに再問い合わせして最終結果を得る
-	finalResponse, err := m.subGateways[0].GenerateCultureUpdate(
-		ctx, aggregatedPrompt, userInput)
+	// 集約用のゲートウェイに再問い合わせして最終結果を得る
+	aggregated := req.Clone()
+	aggregated.Messages = nil
+	if system := req.SystemPrompt(); system != "" {
+		aggregated.Messages = append(aggregated.Messages,
+			entity.LLMMessage{Role: entity.LLMRoleSystem, Content: system})
+	}
+	aggregated.Messages = append(aggregated.Messages,
+		entity.LLMMessage{Role: entity.LLMRoleUser, Content: aggregatedPrompt})
+	return m.aggregator.Generate(
+		entity.ContextWithLLMStage(ctx, entity.LLMStageAggregate), aggregated)
+}
+
+// judge: 形式に合った候補を番号付きで並べ、集約用のゲートウェイに最も良いものを選ばせる
+// 選ばせられなかった場合は並び順で最初の候補を使う
+func (m *MultiLLMGateway) judge(
+	ctx context.Context,
+	req *entity.LLMRequest,
+	cands *candidates,
+) (string, error) {
+	valid := cands.valid()
+	if len(valid) <= 1 {
+		return cands.firstValid(), nil
+	}
+
+	var b strings.Builder
+	b.WriteString(consts.JudgePromptHeader)
+	b.WriteString("\n形式: {\"choice\": 番号, \"reason\": \"選んだ理由\"}\n元の指示:\n")
+	b.WriteString(req.Prompt())
+	b.WriteString("\n候補:\n")
+	for n, i := range valid {
+		fmt.Fprintf(&b, "[%d] %s\n", n+1, cands.Candidates[i].Response)
+	}
+	// 選ぶだけなので、結果がぶれないよう温度を 0 にする
+	// 選んだ理由などの応答は呼び出し側に流さない
+	judgeCtx := entity.ContextWithoutLLMStream(
+		entity.ContextWithLLMStage(ctx, entity.LLMStageJudge))
+	resp, err := m.aggregator.Generate(judgeCtx, &entity.LLMRequest{
+		Messages:       []entity.LLMMessage{{Role: entity.LLMRoleUser, Content: b.String()}},
+		Sampling:       entity.NewLLMSampling(0),
+		Schema:         entity.JudgeChoiceSchema,
+		SimulationType: req.SimulationType,
+		CommunityIDs:   req.CommunityIDs,
+	})
 	if err != nil {
-		logger.Error("Final aggregated call failed", zap.Error(err))
-		return "", err
+		// 取り消された場合は続けない
+		if ctx.Err() != nil {
+			return "", err
+		}
+		cands.Note = "judge failed: " + err.Error()
+		return cands.firstValid(), nil
+	}
+
+	var choice struct {
+		Choice int    `json:"choice"`
+		Reason string `json:"reason"`
+	}
+	obj, ok := parseCandidate(resp, entity.JudgeChoiceSchema)
+	if ok {
+		raw, _ := json.Marshal(obj)
+		ok = json.Unmarshal(raw, &choice) == nil && choice.Choice <= len(valid)
+	}
+	if !ok {
+		zap.L().Warn("Judge response is not a valid choice", zap.String("response", resp))
+		cands.Note = "judge returned an invalid choice: " + resp
+		return cands.firstValid(), nil
+	}
+	i := valid[choice.Choice-1]
+	cands.Chosen = &i
+	cands.Note = choice.Reason
+	return cands.Candidates[i].Response, nil
+}
+
+// candidates: 集約の対象の回答と、形式に合った回答を読み込んだ JSON オブジェクト
+type candidates struct {
+	*entity.LLMAggregation
+	objects []map[string]any // 形式の指定がない・形式に合わない候補は nil
+}
+
+// parseCandidate: 応答から JSON オブジェクトを取り出し、形式に合えば読み込む
+func parseCandidate(resp string, schema *entity.ResponseSchema) (map[string]any, bool) {
+	raw, err := entity.ExtractJSONObject(resp)
+	if err != nil || schema.Validate([]byte(raw)) != nil {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+// outputs: 空でない回答
+func (c *candidates) outputs() []string {
+	var outputs []string
+	for _, cand := range c.Candidates {
+		if cand.Error == "" && cand.Response != "" {
+			outputs = append(outputs, cand.Response)
+		}
+	}
+	return outputs
+}
+
+// valid: 形式に合った候補の位置
+func (c *candidates) valid() []int {
+	var valid []int
+	for i, cand := range c.Candidates {
+		if cand.Valid {
+			valid = append(valid, i)
+		}
+	}
+	return valid
+}
+
+// firstValid: 並び順で最初に形式に合った回答
+// どれも合わなければ最初の空でない回答を返し、呼び出し側での問い直しに任せる
+func (c *candidates) firstValid() string {
+	if valid := c.valid(); len(valid) > 0 {
+		c.Chosen = &valid[0]
+		return c.Candidates[valid[0]].Response
+	}
+	for i, cand := range c.Candidates {
+		if cand.Error == "" && cand.Response != "" {
+			c.Chosen = &i
+			if c.Note == "" {
+				c.Note = "no candidate matched the response schema"
+			}
+			return cand.Response
+		}
+	}
+	return ""
+}
+
+// vote: 選択肢のある項目の値の組み合わせで多数決を取り、最も多い組み合わせの最初の回答を返す
+// 同数の場合は並び順で先に現れた組み合わせを選ぶ
+func (c *candidates) vote(schema *entity.ResponseSchema) string {
+	var fields []string
+	if schema != nil {
+		for _, f := range schema.Fields {
+			if len(f.Enum) > 0 {
+				fields = append(fields, f.Name)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		c.Note = "no field to vote on"
+		return c.firstValid()
+	}
+
+	counts := make(map[string]int)
+	first := make(map[string]int)
+	best := ""
+	for _, i := range c.valid() {
+		values := make([]string, len(fields))
+		for n, name := range fields {
+			values[n], _ = c.objects[i][name].(string)
+		}
+		key := strings.Join(values, "/")
+		if _, ok := first[key]; !ok {
+			first[key] = i
+		}
+		counts[key]++
+		if best == "" || counts[key] > counts[best] {
+			best = key
+		}
+	}
+	if best == "" {
+		return c.firstValid()
+	}
+	i := first[best]
+	c.Chosen = &i
+	c.Note = fmt.Sprintf("%s: %d/%d votes", best, counts[best], len(c.valid()))
+	return c.Candidates[i].Response
+}
+
+// combineIntegers: 最初に形式に合った回答を元に、整数の項目を形式に合った回答全体の平均・中央値に置き換える
+func (c *candidates) combineIntegers(schema *entity.ResponseSchema) (string, error) {
+	var fields []string
+	if schema != nil {
+		for _, f := range schema.Fields {
+			if f.Type == entity.SchemaInteger {
+				fields = append(fields, f.Name)
+			}
+		}
+	}
+	valid := c.valid()
+	if len(fields) == 0 || len(valid) == 0 {
+		if len(fields) == 0 {
+			c.Note = "no integer field to combine"
+		}
+		return c.firstValid(), nil
+	}
+
+	combined := make(map[string]any, len(c.objects[valid[0]]))
+	for k, v := range c.objects[valid[0]] {
+		combined[k] = v
+	}
+	for _, name := range fields {
+		var values []float64
+		for _, i := range valid {
+			if n, ok := c.objects[i][name].(json.Number); ok {
+				if v, err := n.Float64(); err == nil {
+					values = append(values, v)
+				}
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if c.Strategy == entity.LLMAggregateMedian {
+			combined[name] = int(math.Round(median(values)))
+		} else {
+			combined[name] = int(math.Round(mean(values)))
+		}
+	}
+	raw, err := json.Marshal(combined)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode combined response: %w", err)
+	}
+	return string(raw), nil
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
 	}
-	logger.Debug("Final aggregated response", zap.String("response", finalResponse))
-	return finalResponse, nil
+	return (sorted[mid-1] + sorted[mid]) / 2
 }
 
 var _ repository.LLMGateway = (*MultiLLMGateway)(nil)
@@ -0,0 +1,366 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// stubbornGateway: 取り消されても戻らず、テストが終わるまで応答しないゲートウェイ
+type stubbornGateway struct{ release chan struct{} }
+
+func newStubbornGateway(t *testing.T) stubbornGateway {
+	g := stubbornGateway{release: make(chan struct{})}
+	t.Cleanup(func() { close(g.release) })
+	return g
+}
+
+func (g stubbornGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	<-g.release
+	return `{"newCulture": "遅れた回答", "populationChange": 0}`, nil
+}
+
+func (g stubbornGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func named(name string, gw repository.LLMGateway) gateway.NamedLLMGateway {
+	return gateway.NamedLLMGateway{Name: name, Gateway: gw}
+}
+
+// generateMulti: 文化進化の形式で問い合わせ、回答と候補のまとめ方を返す
+func generateMulti(
+	ctx context.Context,
+	g *gateway.MultiLLMGateway,
+) (string, *entity.LLMAggregation, error) {
+	var report entity.LLMCallReport
+	req := entity.NewLLMRequest("文化を進化させてください", "")
+	req.Schema = entity.CultureUpdateSchema
+	req.SimulationType = entity.SimulationTypeCultureEvolution
+	resp, err := g.Generate(entity.ContextWithLLMCallReport(ctx, &report), req)
+	return resp, report.Aggregation, err
+}
+
+// generateMultiPromptly: generateMulti が戻るのを待つ（戻らないサブゲートウェイを待っていれば失敗にする）
+func generateMultiPromptly(
+	t *testing.T,
+	ctx context.Context,
+	g *gateway.MultiLLMGateway,
+) (string, *entity.LLMAggregation, error) {
+	t.Helper()
+	type result struct {
+		resp string
+		agg  *entity.LLMAggregation
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, agg, err := generateMulti(ctx, g)
+		done <- result{resp, agg, err}
+	}()
+	select {
+	case r := <-done:
+		return r.resp, r.agg, r.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("fan-out waited for a sub gateway that does not return")
+		return "", nil, nil
+	}
+}
+
+const (
+	cultureA = `{"newCulture": "祭りの文化", "populationChange": 10}`
+	cultureB = `{"newCulture": "交易の文化", "populationChange": 20}`
+)
+
+// 定足数がそろったら、戻らないサブゲートウェイを待たずに進める
+func TestMultiGatewayQuorumDoesNotWaitForStragglers(t *testing.T) {
+	g := gateway.NewMultiLLMGateway(nil,
+		map[string]string{entity.SimulationTypeCultureEvolution: entity.LLMAggregateFirstValid},
+		0, 2,
+		named("a", fixedGateway{response: "形式に合わない"}),
+		named("slow", newStubbornGateway(t)),
+		named("b", fixedGateway{response: cultureA}),
+		named("c", fixedGateway{response: cultureB}),
+	)
+
+	resp, agg, err := generateMultiPromptly(t, context.Background(), g)
+	if err != nil || resp != cultureA {
+		t.Fatalf("got (%q, %v), want %q", resp, err, cultureA)
+	}
+	slow := agg.Candidates[1]
+	if !slow.Canceled || slow.Response != "" || slow.Valid {
+		t.Errorf("straggler = %+v, want canceled without a response", slow)
+	}
+	if agg.Candidates[0].Valid || !agg.Candidates[2].Valid || !agg.Candidates[3].Valid {
+		t.Errorf("candidates = %+v, want only b and c valid", agg.Candidates)
+	}
+}
+
+// 期限を過ぎたら、取り消しを無視するサブゲートウェイを待たずに届いた回答で進める
+func TestMultiGatewayDeadlineDoesNotWaitForStragglers(t *testing.T) {
+	g := gateway.NewMultiLLMGateway(nil,
+		map[string]string{entity.SimulationTypeCultureEvolution: entity.LLMAggregateFirstValid},
+		50*time.Millisecond, 0,
+		named("slow", newStubbornGateway(t)),
+		named("a", fixedGateway{response: cultureA}),
+	)
+
+	resp, agg, err := generateMultiPromptly(t, context.Background(), g)
+	if err != nil || resp != cultureA {
+		t.Fatalf("got (%q, %v), want %q", resp, err, cultureA)
+	}
+	if slow := agg.Candidates[0]; !slow.TimedOut || slow.Error == "" {
+		t.Errorf("straggler = %+v, want timed out", slow)
+	}
+}
+
+// すべてが期限を過ぎたら利用できない失敗として返す
+func TestMultiGatewayAllTimedOut(t *testing.T) {
+	g := gateway.NewMultiLLMGateway(nil, nil, 30*time.Millisecond, 0,
+		named("a", newStubbornGateway(t)),
+		named("b", newStubbornGateway(t)),
+	)
+	_, agg, err := generateMultiPromptly(t, context.Background(), g)
+	if !errors.Is(err, repository.ErrLLMUnavailable) {
+		t.Fatalf("error = %v, want %v", err, repository.ErrLLMUnavailable)
+	}
+	for _, c := range agg.Candidates {
+		if !c.TimedOut {
+			t.Errorf("candidate %s = %+v, want timed out", c.Gateway, c)
+		}
+	}
+}
+
+// 呼び出し側が取り消したら、戻らないサブゲートウェイを待たずに戻る
+func TestMultiGatewayCanceledByCaller(t *testing.T) {
+	g := gateway.NewMultiLLMGateway(nil, nil, 0, 0, named("a", newStubbornGateway(t)))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, agg, err := generateMultiPromptly(t, ctx, g)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if c := agg.Candidates[0]; !c.Canceled {
+		t.Errorf("candidate = %+v, want canceled", c)
+	}
+}
+
+// captureGateway: 受け取った問い合わせを記録し、決まった応答（または失敗）を返すゲートウェイ
+type captureGateway struct {
+	response string
+	err      error
+
+	mu   sync.Mutex
+	reqs []*entity.LLMRequest
+}
+
+func (g *captureGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reqs = append(g.reqs, req)
+	return g.response, g.err
+}
+
+func (g *captureGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func diplomacy(outcome string) string {
+	return fmt.Sprintf(`{"outcome": %q, "description": "%s の結果", "popChangeA": 1, "popChangeB": 2}`,
+		outcome, outcome)
+}
+
+func TestMultiGatewayStrategies(t *testing.T) {
+	cultureC := `{"newCulture": "農耕の文化", "populationChange": 40}`
+	tests := []struct {
+		name       string
+		strategy   string
+		schema     *entity.ResponseSchema
+		responses  []string
+		aggregator *captureGateway
+		want       string
+		wantChosen int // -1 なら nil
+		wantNote   string
+		wantCalls  int // 集約用のゲートウェイへの問い合わせ数
+	}{
+		{
+			name:     "synthesize asks the aggregator with the merged answers",
+			strategy: entity.LLMAggregateSynthesize, schema: entity.CultureUpdateSchema,
+			responses:  []string{cultureA, cultureB},
+			aggregator: &captureGateway{response: cultureC},
+			want:       cultureC, wantChosen: -1, wantCalls: 1,
+		},
+		{
+			name:     "first_valid uses the first answer matching the schema",
+			strategy: entity.LLMAggregateFirstValid, schema: entity.CultureUpdateSchema,
+			responses: []string{"形式に合わない", cultureA, cultureB},
+			want:      cultureA, wantChosen: 1,
+		},
+		{
+			name:     "first_valid falls back to the first non-empty answer",
+			strategy: entity.LLMAggregateFirstValid, schema: entity.CultureUpdateSchema,
+			responses: []string{"", "形式に合わない"},
+			want:      "形式に合わない", wantChosen: 1,
+			wantNote: "no candidate matched the response schema",
+		},
+		{
+			name:     "vote picks the majority of the enum fields",
+			strategy: entity.LLMAggregateVote, schema: entity.DiplomacyOutcomeSchema,
+			responses: []string{diplomacy("peace"), diplomacy("war"), diplomacy("war")},
+			want:      diplomacy("war"), wantChosen: 1, wantNote: "war: 2/3 votes",
+		},
+		{
+			name:     "vote breaks ties by order",
+			strategy: entity.LLMAggregateVote, schema: entity.DiplomacyOutcomeSchema,
+			responses: []string{diplomacy("trade"), diplomacy("war")},
+			want:      diplomacy("trade"), wantChosen: 0, wantNote: "trade: 1/2 votes",
+		},
+		{
+			name:     "vote without enum fields uses the first valid answer",
+			strategy: entity.LLMAggregateVote, schema: entity.CultureUpdateSchema,
+			responses: []string{cultureA, cultureB},
+			want:      cultureA, wantChosen: 0, wantNote: "no field to vote on",
+		},
+		{
+			name:     "mean averages the integer fields",
+			strategy: entity.LLMAggregateMean, schema: entity.CultureUpdateSchema,
+			responses: []string{cultureA, "形式に合わない", cultureB, cultureC},
+			want:      `{"newCulture":"祭りの文化","populationChange":23}`, wantChosen: -1,
+		},
+		{
+			name:     "median takes the middle of the integer fields",
+			strategy: entity.LLMAggregateMedian, schema: entity.CultureUpdateSchema,
+			responses: []string{cultureA, cultureB, cultureC},
+			want:      `{"newCulture":"祭りの文化","populationChange":20}`, wantChosen: -1,
+		},
+		{
+			name:     "judge uses the chosen candidate",
+			strategy: entity.LLMAggregateJudge, schema: entity.CultureUpdateSchema,
+			responses:  []string{"形式に合わない", cultureA, cultureB},
+			aggregator: &captureGateway{response: `{"choice": 2, "reason": "具体的"}`},
+			want:       cultureB, wantChosen: 2, wantNote: "具体的", wantCalls: 1,
+		},
+		{
+			name:     "judge falls back on an invalid choice",
+			strategy: entity.LLMAggregateJudge, schema: entity.CultureUpdateSchema,
+			responses:  []string{cultureA, cultureB},
+			aggregator: &captureGateway{response: `{"choice": 3}`},
+			want:       cultureA, wantChosen: 0,
+			wantNote: `judge returned an invalid choice: {"choice": 3}`, wantCalls: 1,
+		},
+		{
+			name:     "judge falls back when the judge fails",
+			strategy: entity.LLMAggregateJudge, schema: entity.CultureUpdateSchema,
+			responses:  []string{cultureA, cultureB},
+			aggregator: &captureGateway{err: errors.New("boom")},
+			want:       cultureA, wantChosen: 0, wantNote: "judge failed: boom", wantCalls: 1,
+		},
+		{
+			name:     "judge is skipped with a single valid candidate",
+			strategy: entity.LLMAggregateJudge, schema: entity.CultureUpdateSchema,
+			responses:  []string{cultureA, "形式に合わない"},
+			aggregator: &captureGateway{response: `{"choice": 2}`},
+			want:       cultureA, wantChosen: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs := make([]gateway.NamedLLMGateway, len(tt.responses))
+			for i, resp := range tt.responses {
+				subs[i] = named(fmt.Sprintf("sub%d", i), fixedGateway{response: resp})
+			}
+			aggregator := tt.aggregator
+			if aggregator == nil {
+				aggregator = &captureGateway{}
+			}
+			g := gateway.NewMultiLLMGateway(aggregator,
+				map[string]string{"test": tt.strategy}, 0, 0, subs...)
+
+			var report entity.LLMCallReport
+			req := entity.NewLLMRequest("問い合わせ", "")
+			req.Schema = tt.schema
+			req.SimulationType = "test"
+			resp, err := g.Generate(entity.ContextWithLLMCallReport(
+				context.Background(), &report), req)
+			if err != nil {
+				t.Fatalf("failed to generate: %v", err)
+			}
+			if resp != tt.want {
+				t.Errorf("response = %s, want %s", resp, tt.want)
+			}
+
+			agg := report.Aggregation
+			if agg.Strategy != tt.strategy || len(agg.Candidates) != len(tt.responses) {
+				t.Errorf("aggregation = %+v, want strategy %s with %d candidates",
+					agg, tt.strategy, len(tt.responses))
+			}
+			switch {
+			case tt.wantChosen < 0 && agg.Chosen != nil:
+				t.Errorf("chosen = %d, want nil", *agg.Chosen)
+			case tt.wantChosen >= 0 && (agg.Chosen == nil || *agg.Chosen != tt.wantChosen):
+				t.Errorf("chosen = %v, want %d", agg.Chosen, tt.wantChosen)
+			}
+			if agg.Note != tt.wantNote {
+				t.Errorf("note = %q, want %q", agg.Note, tt.wantNote)
+			}
+			if len(aggregator.reqs) != tt.wantCalls {
+				t.Errorf("aggregator calls = %d, want %d", len(aggregator.reqs), tt.wantCalls)
+			}
+		})
+	}
+}
+
+// 集約プロンプトには各回答を含め、元の問い合わせの形式と生成の設定を引き継ぐ
+// 候補を選ばせる問い合わせは温度 0 で選択の形式を指定する
+func TestMultiGatewayAggregatorRequests(t *testing.T) {
+	subs := []gateway.NamedLLMGateway{
+		named("a", fixedGateway{response: cultureA}),
+		named("b", fixedGateway{response: cultureB}),
+	}
+	req := entity.NewLLMRequest("問い合わせ", "")
+	req.Schema = entity.CultureUpdateSchema
+	req.Sampling = entity.NewLLMSampling(0.9)
+
+	synth := &captureGateway{response: cultureA}
+	req.SimulationType = "synth"
+	gateway.NewMultiLLMGateway(synth, nil, 0, 0, subs...).Generate(context.Background(), req)
+	if len(synth.reqs) != 1 {
+		t.Fatalf("synthesize calls = %d, want 1", len(synth.reqs))
+	}
+	got := synth.reqs[0]
+	if !strings.Contains(got.Prompt(), cultureA) || !strings.Contains(got.Prompt(), cultureB) ||
+		got.Schema != entity.CultureUpdateSchema || *got.Sampling.Temperature != 0.9 {
+		t.Errorf("synthesize request = %+v (prompt %q), want both answers, schema and sampling",
+			got, got.Prompt())
+	}
+
+	judge := &captureGateway{response: `{"choice": 1}`}
+	req.SimulationType = "judge"
+	gateway.NewMultiLLMGateway(judge, map[string]string{"judge": entity.LLMAggregateJudge},
+		0, 0, subs...).Generate(context.Background(), req)
+	if len(judge.reqs) != 1 {
+		t.Fatalf("judge calls = %d, want 1", len(judge.reqs))
+	}
+	got = judge.reqs[0]
+	if !strings.Contains(got.Prompt(), "[1] "+cultureA) ||
+		!strings.Contains(got.Prompt(), "[2] "+cultureB) ||
+		got.Schema != entity.JudgeChoiceSchema || *got.Sampling.Temperature != 0 {
+		t.Errorf("judge request = %+v (prompt %q), want numbered candidates at temperature 0",
+			got, got.Prompt())
+	}
+}
@@ -0,0 +1,389 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// ローカルの Ollama HTTP API (/api/chat) を使うゲートウェイ
+// ネットワークに繋がらない環境でもシミュレーションを実行できる
+type OllamaLLMGateway struct {
+	client  *http.Client
+	baseURL string // 例: http://localhost:11434
+	model   string
+	timeout time.Duration // 1回の生成にかける最大時間
+	pull    bool          // モデルが無いときに取得するか
+
+	mu    sync.Mutex
+	ready bool // モデルの存在を確認済みか
+	// モデルの確認・取得を1つにまとめる（失敗した場合は次の呼び出しで再度確認する）
+	check singleflight.Group
+}
+
+func NewOllamaLLMGateway(
+	baseURL, model string,
+	timeout time.Duration,
+	pull bool,
+) (*OllamaLLMGateway, error) {
+	zap.L().Debug("Initializing OllamaLLMGateway",
+		zap.String("baseURL", baseURL), zap.String("model", model))
+
+	if baseURL == "" {
+		return nil, fmt.Errorf("ollama base URL is not set")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("ollama model is not set")
+	}
+	return &OllamaLLMGateway{
+		client:  &http.Client{},
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		timeout: timeout,
+		pull:    pull,
+	}, nil
+}
+
+// /api/chat のリクエスト
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+	Format   string              `json:"format,omitempty"`
+	Stream   bool                `json:"stream"`
+	Options  *ollamaOptions      `json:"options,omitempty"`
+}
+
+// 生成の設定（指定した項目のみ送る）
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// /api/chat のレスポンス（stream: true のときは1行ずつ届き、最後の行で done が true になる）
+type ollamaChatResponse struct {
+	Message openAIChatMessage `json:"message"`
+	Done    bool              `json:"done"`
+	Error   string            `json:"error"`
+
+	PromptEvalCount int `json:"prompt_eval_count"` // 入力のトークン数
+	EvalCount       int `json:"eval_count"`        // 出力のトークン数
+}
+
+// /api/tags のレスポンス
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	} `json:"models"`
+}
+
+func (g *OllamaLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// LLMGatewayインタフェース
+// context に断片の受け取り先があれば、stream: true で生成しながら断片を渡す
+func (g *OllamaLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+
+	// モデルの確認・取得を待つ時間も含めて timeout に収める
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	if err := g.ensureModel(ctx); err != nil {
+		return "", err
+	}
+
+	chatReq := ollamaChatRequest{
+		Model:    g.model,
+		Messages: chatMessages(req),
+		Format:   "json",
+	}
+	if s := req.Sampling; !s.IsZero() {
+		chatReq.Options = &ollamaOptions{
+			Temperature: s.Temperature,
+			TopP:        s.TopP,
+			NumPredict:  s.MaxTokens,
+			Seed:        s.Seed,
+		}
+	}
+
+	stream := entity.LLMStreamFromContext(ctx)
+	logger.Debug("Generating with Ollama",
+		zap.String("model", g.model), zap.String("prompt", req.Prompt()),
+		zap.Bool("stream", stream != nil))
+	var (
+		chatResp ollamaChatResponse
+		err      error
+	)
+	if stream != nil {
+		chatReq.Stream = true
+		chatResp, err = g.chatStream(ctx, chatReq, stream)
+	} else {
+		err = g.post(ctx, "/api/chat", chatReq, &chatResp)
+	}
+	if err != nil {
+		logger.Error("Failed to call ollama chat", zap.Error(err))
+		return "", fmt.Errorf("failed to call ollama chat: %w", err)
+	}
+	if chatResp.Error != "" {
+		return "", ollamaChatError(chatResp.Error)
+	}
+
+	entity.ReportLLMTokens(ctx, chatResp.PromptEvalCount, chatResp.EvalCount)
+
+	resp := strings.TrimSpace(chatResp.Message.Content)
+	logger.Debug("Generated response", zap.String("response", resp))
+	return resp, nil
+}
+
+// chatStream: 1行ずつ届くレスポンスを読み、断片を stream に渡しながら内容をつなげる
+// 戻り値の利用量とエラーは最後に届いた行のもの
+func (g *OllamaLLMGateway) chatStream(
+	ctx context.Context,
+	chatReq ollamaChatRequest,
+	stream entity.LLMStreamFunc,
+) (ollamaChatResponse, error) {
+	var merged ollamaChatResponse
+	resp, err := g.send(ctx, http.MethodPost, "/api/chat", chatReq)
+	if err != nil {
+		return merged, err
+	}
+	defer resp.Body.Close()
+
+	stream(entity.LLMStreamEvent{Reset: true})
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), consts.LLMStreamMaxLineBytes)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return merged, badOutputError(consts.LLMProviderOllama,
+				fmt.Errorf("failed to decode chat chunk: %w", err))
+		}
+		if text := chunk.Message.Content; text != "" {
+			content.WriteString(text)
+			stream(entity.LLMStreamEvent{Text: text})
+		}
+		merged = chunk
+		if chunk.Done || chunk.Error != "" {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return merged, transportError(consts.LLMProviderOllama,
+			fmt.Errorf("failed to read chat stream: %w", err))
+	}
+	merged.Message.Content = content.String()
+	return merged, nil
+}
+
+// ensureModel: モデルがローカルにあるか確認し、無ければ設定に応じて取得する
+// 同時に呼ばれても確認・取得は1回だけ行い、呼び出し側は ctx が終わるまで待つ
+// 確認・取得は呼び出し側の ctx が終わっても続けるので、待つのをやめた後の呼び出しで結果を使える
+func (g *OllamaLLMGateway) ensureModel(ctx context.Context) error {
+	g.mu.Lock()
+	ready := g.ready
+	g.mu.Unlock()
+	if ready {
+		return nil
+	}
+
+	ch := g.check.DoChan(g.model, func() (any, error) {
+		if err := g.checkModel(context.WithoutCancel(ctx)); err != nil {
+			return nil, err
+		}
+		g.mu.Lock()
+		g.ready = true
+		g.mu.Unlock()
+		return nil, nil
+	})
+	select {
+	case res := <-ch:
+		return res.Err
+	case <-ctx.Done():
+		return transportError(consts.LLMProviderOllama,
+			fmt.Errorf("gave up waiting for ollama model %q: %w", g.model, ctx.Err()))
+	}
+}
+
+// checkModel: モデルの一覧を確認し、無ければ取得する
+// 一覧の確認には timeout、取得には consts.OllamaPullTimeout をかける
+func (g *OllamaLLMGateway) checkModel(ctx context.Context) error {
+	logger := zap.L()
+
+	listCtx := ctx
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		listCtx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	var tags ollamaTagsResponse
+	if err := g.get(listCtx, "/api/tags", &tags); err != nil {
+		return fmt.Errorf("failed to list ollama models: %w", err)
+	}
+	for _, m := range tags.Models {
+		if ollamaModelMatches(m.Name, g.model) || ollamaModelMatches(m.Model, g.model) {
+			return nil
+		}
+	}
+	if !g.pull {
+		return &repository.LLMError{
+			Kind:     repository.ErrLLMInvalidRequest,
+			Provider: consts.LLMProviderOllama,
+			Err: fmt.Errorf("ollama model %q is not available (run `ollama pull %s`)",
+				g.model, g.model),
+		}
+	}
+
+	logger.Info("Pulling ollama model", zap.String("model", g.model))
+	pullCtx, cancel := context.WithTimeout(ctx, consts.OllamaPullTimeout)
+	defer cancel()
+	var pullResp struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := g.post(pullCtx, "/api/pull", map[string]any{
+		"model":  g.model,
+		"stream": false,
+	}, &pullResp); err != nil {
+		return fmt.Errorf("failed to pull ollama model %q: %w", g.model, err)
+	}
+	if pullResp.Error != "" {
+		return fmt.Errorf("failed to pull ollama model %q: %s", g.model, pullResp.Error)
+	}
+	logger.Info("Ollama model pulled",
+		zap.String("model", g.model), zap.String("status", pullResp.Status))
+	return nil
+}
+
+// ollamaChatError: 200 の応答の本文で報告された失敗を分類する
+// 接続や混雑の問題は HTTP のステータスで返るので、本文のエラーは再試行しても変わらない失敗として扱う
+func ollamaChatError(msg string) error {
+	kind := repository.ErrLLMOutput
+	if strings.Contains(msg, "not found") {
+		kind = repository.ErrLLMInvalidRequest // モデルが無い・削除された
+	}
+	return &repository.LLMError{
+		Kind:     kind,
+		Provider: consts.LLMProviderOllama,
+		Err:      fmt.Errorf("ollama chat failed: %s", msg),
+	}
+}
+
+// タグ省略時は latest として比較する
+func ollamaModelMatches(name, model string) bool {
+	withTag := func(s string) string {
+		if strings.Contains(s, ":") {
+			return s
+		}
+		return s + ":latest"
+	}
+	return name != "" && withTag(name) == withTag(model)
+}
+
+func (g *OllamaLLMGateway) get(ctx context.Context, path string, out any) error {
+	return g.do(ctx, http.MethodGet, path, nil, out)
+}
+
+func (g *OllamaLLMGateway) post(ctx context.Context, path string, in, out any) error {
+	return g.do(ctx, http.MethodPost, path, in, out)
+}
+
+// do: リクエストを送り、JSON のレスポンスを out に読み込む
+func (g *OllamaLLMGateway) do(ctx context.Context, method, path string, in, out any) error {
+	resp, err := g.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return transportError(consts.LLMProviderOllama,
+			fmt.Errorf("failed to read response: %w", err))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return badOutputError(consts.LLMProviderOllama,
+			fmt.Errorf("failed to decode response: %w", err))
+	}
+	return nil
+}
+
+// send: リクエストを送り、200 のレスポンスを返す（本文は呼び出し側で閉じる）
+// in が nil なら本文なしで送る
+func (g *OllamaLLMGateway) send(
+	ctx context.Context,
+	method, path string,
+	in any,
+) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, transportError(consts.LLMProviderOllama, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError(consts.LLMProviderOllama,
+			fmt.Errorf("failed to read response: %w", err))
+	}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(b))
+	if json.Unmarshal(b, &errResp) == nil && errResp.Error != "" {
+		msg = errResp.Error
+	}
+	return nil, classifyHTTPStatus(consts.LLMProviderOllama, resp.StatusCode, resp.Header,
+		fmt.Errorf("%s returned status %d: %s", path, resp.StatusCode, msg))
+}
+
+var _ repository.LLMGateway = (*OllamaLLMGateway)(nil)
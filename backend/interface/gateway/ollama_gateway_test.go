@@ -0,0 +1,343 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// fakeOllama: /api/tags, /api/pull, /api/chat だけを持つ Ollama の代わりのサーバ
+type fakeOllama struct {
+	models []string // /api/tags が返すモデル
+	// pull と chat の応答（nil なら成功を返す）
+	pull func(w http.ResponseWriter, r *http.Request)
+	chat func(w http.ResponseWriter, r *http.Request)
+
+	tags, pulls, chats atomic.Int32
+
+	mu       sync.Mutex
+	lastChat map[string]any // 最後の /api/chat のリクエスト本文
+}
+
+func (f *fakeOllama) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			f.tags.Add(1)
+			var resp struct {
+				Models []map[string]string `json:"models"`
+			}
+			for _, m := range f.models {
+				resp.Models = append(resp.Models, map[string]string{"name": m, "model": m})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/api/pull":
+			f.pulls.Add(1)
+			if f.pull != nil {
+				f.pull(w, r)
+				return
+			}
+			fmt.Fprint(w, `{"status": "success"}`)
+		case "/api/chat":
+			f.chats.Add(1)
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			f.mu.Lock()
+			f.lastChat = body
+			f.mu.Unlock()
+			if f.chat != nil {
+				f.chat(w, r)
+				return
+			}
+			fmt.Fprint(w, `{"message": {"role": "assistant", "content": " {\"ok\": true} "},
+				"done": true, "prompt_eval_count": 3, "eval_count": 5}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newOllama(t *testing.T, url string, timeout time.Duration, pull bool) *gateway.OllamaLLMGateway {
+	t.Helper()
+	g, err := gateway.NewOllamaLLMGateway(url, "llama3.2", timeout, pull)
+	if err != nil {
+		t.Fatalf("failed to create ollama gateway: %v", err)
+	}
+	return g
+}
+
+// waitForRequest: ハンドラをリクエストが取り消されるまで止める
+func waitForRequest(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+}
+
+// モデルがあれば取得せずに生成し、JSON での応答と生成の設定を送る
+func TestOllamaGenerateSendsJSONFormat(t *testing.T) {
+	f := &fakeOllama{models: []string{"llama3.2:latest"}}
+	srv := f.start(t)
+	g := newOllama(t, srv.URL, time.Minute, true)
+
+	req := entity.NewLLMRequest("prompt", "input")
+	req.Sampling = entity.NewLLMSampling(0.7)
+	resp, err := g.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if resp != `{"ok": true}` {
+		t.Errorf("response = %q, want trimmed content", resp)
+	}
+	if f.tags.Load() != 1 || f.pulls.Load() != 0 {
+		t.Errorf("tags = %d, pulls = %d; want 1 and 0", f.tags.Load(), f.pulls.Load())
+	}
+
+	f.mu.Lock()
+	body := f.lastChat
+	f.mu.Unlock()
+	if body["format"] != "json" || body["model"] != "llama3.2" || body["stream"] != false {
+		t.Errorf("chat request = %v, want format json, model llama3.2, stream false", body)
+	}
+	options, _ := body["options"].(map[string]any)
+	if options["temperature"] != 0.7 {
+		t.Errorf("options = %v, want temperature 0.7", options)
+	}
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 3 {
+		t.Errorf("messages = %v, want system, prompt and user input", messages)
+	}
+
+	// 確認済みのモデルは再び確認しない
+	if _, err := g.Generate(context.Background(), req); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if f.tags.Load() != 1 {
+		t.Errorf("tags = %d after second call, want 1", f.tags.Load())
+	}
+}
+
+// モデルが無ければ設定に応じて取得する、または取得せずに失敗する
+func TestOllamaEnsureModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		pull      bool
+		pullResp  func(w http.ResponseWriter, r *http.Request)
+		wantPulls int32
+		wantChats int32
+		wantKind  error // nil なら成功
+	}{
+		{name: "pulls missing model", pull: true, wantPulls: 1, wantChats: 1},
+		{name: "does not pull when disabled", pull: false,
+			wantKind: repository.ErrLLMInvalidRequest},
+		{name: "pull fails", pull: true, wantPulls: 1,
+			pullResp: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"error": "pull model manifest: file does not exist"}`)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeOllama{models: []string{"qwen2.5:7b"}, pull: tt.pullResp}
+			srv := f.start(t)
+			g := newOllama(t, srv.URL, time.Minute, tt.pull)
+
+			_, err := g.GenerateCultureUpdate(context.Background(), "prompt", "")
+			switch {
+			case tt.wantKind != nil:
+				if !errors.Is(err, tt.wantKind) {
+					t.Errorf("error = %v, want %v", err, tt.wantKind)
+				}
+			case tt.pullResp != nil:
+				if err == nil {
+					t.Errorf("got no error, want pull failure")
+				}
+			case err != nil:
+				t.Errorf("failed to generate: %v", err)
+			}
+			if f.pulls.Load() != tt.wantPulls || f.chats.Load() != tt.wantChats {
+				t.Errorf("pulls = %d, chats = %d; want %d and %d",
+					f.pulls.Load(), f.chats.Load(), tt.wantPulls, tt.wantChats)
+			}
+		})
+	}
+}
+
+// 同時に呼ばれてもモデルの確認・取得は1回だけ行い、待っている呼び出しは取得後に生成する
+func TestOllamaModelCheckIsShared(t *testing.T) {
+	release := make(chan struct{})
+	f := &fakeOllama{pull: func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"status": "success"}`)
+	}}
+	srv := f.start(t)
+	g := newOllama(t, srv.URL, time.Minute, true)
+
+	const callers = 5
+	errs := make(chan error, callers)
+	for range callers {
+		go func() {
+			_, err := g.GenerateCultureUpdate(context.Background(), "prompt", "")
+			errs <- err
+		}()
+	}
+	// 全員が取得を待つまで少し待ってから取得を終わらせる
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for range callers {
+		if err := <-errs; err != nil {
+			t.Errorf("failed to generate: %v", err)
+		}
+	}
+	if f.tags.Load() != 1 || f.pulls.Load() != 1 || f.chats.Load() != callers {
+		t.Errorf("tags = %d, pulls = %d, chats = %d; want 1, 1, %d",
+			f.tags.Load(), f.pulls.Load(), f.chats.Load(), callers)
+	}
+}
+
+// 取得を待つのをやめても取得は続き、後の呼び出しで使える
+func TestOllamaPullOutlivesCaller(t *testing.T) {
+	release := make(chan struct{})
+	f := &fakeOllama{pull: func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"status": "success"}`)
+	}}
+	srv := f.start(t)
+	g := newOllama(t, srv.URL, time.Minute, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, repository.ErrLLMUnavailable) {
+		t.Fatalf("error = %v, want deadline exceeded classified as unavailable", err)
+	}
+
+	close(release)
+	if _, err := g.GenerateCultureUpdate(context.Background(), "prompt", ""); err != nil {
+		t.Fatalf("failed to generate after pull: %v", err)
+	}
+	if f.pulls.Load() != 1 {
+		t.Errorf("pulls = %d, want 1", f.pulls.Load())
+	}
+}
+
+// 生成は timeout と呼び出し側の取り消しで止まる
+func TestOllamaGenerateStopsOnTimeoutAndCancel(t *testing.T) {
+	f := &fakeOllama{models: []string{"llama3.2"}, chat: waitForRequest}
+	srv := f.start(t)
+
+	t.Run("timeout", func(t *testing.T) {
+		g := newOllama(t, srv.URL, 30*time.Millisecond, false)
+		_, err := g.GenerateCultureUpdate(context.Background(), "prompt", "")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		g := newOllama(t, srv.URL, time.Minute, false)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(30*time.Millisecond, cancel)
+		_, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+// 提供元の失敗は分類したエラーになり、再試行してよいものだけが Retryable になる
+func TestOllamaErrorMapping(t *testing.T) {
+	tests := []struct {
+		name          string
+		chat          func(w http.ResponseWriter, r *http.Request)
+		wantKind      error
+		wantRetryable bool
+		wantAfter     time.Duration
+	}{
+		{"rate limited", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error": "too many requests"}`)
+		}, repository.ErrLLMRateLimited, true, 2 * time.Second},
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error": "server busy"}`)
+		}, repository.ErrLLMUnavailable, true, 0},
+		{"model not found", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "model \"llama3.2\" not found, try pulling it first"}`)
+		}, repository.ErrLLMInvalidRequest, false, 0},
+		{"error in body", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"error": "model \"llama3.2\" not found"}`)
+		}, repository.ErrLLMInvalidRequest, false, 0},
+		{"generation failed in body", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"error": "failed to parse grammar"}`)
+		}, repository.ErrLLMOutput, false, 0},
+		{"malformed body", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `not json`)
+		}, repository.ErrLLMOutput, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeOllama{models: []string{"llama3.2"}, chat: tt.chat}
+			srv := f.start(t)
+			g := newOllama(t, srv.URL, time.Minute, false)
+
+			_, err := g.GenerateCultureUpdate(context.Background(), "prompt", "")
+			var llmErr *repository.LLMError
+			if !errors.As(err, &llmErr) {
+				t.Fatalf("error = %v, want *repository.LLMError", err)
+			}
+			if !errors.Is(err, tt.wantKind) || llmErr.Retryable() != tt.wantRetryable ||
+				llmErr.RetryAfter != tt.wantAfter {
+				t.Errorf("error = %v (retryable %v, retry after %v); want %v (%v, %v)",
+					err, llmErr.Retryable(), llmErr.RetryAfter,
+					tt.wantKind, tt.wantRetryable, tt.wantAfter)
+			}
+		})
+	}
+}
+
+// 断片の受け取り先があれば stream: true で受け取り、断片を渡しながら応答全体を返す
+func TestOllamaGenerateStreams(t *testing.T) {
+	f := &fakeOllama{models: []string{"llama3.2"}, chat: func(w http.ResponseWriter, r *http.Request) {
+		for _, line := range []string{
+			`{"message": {"role": "assistant", "content": "{\"ok\""}, "done": false}`,
+			`{"message": {"role": "assistant", "content": ": true}"}, "done": false}`,
+			`{"message": {"role": "assistant", "content": ""}, "done": true, "eval_count": 2}`,
+		} {
+			fmt.Fprintln(w, line)
+		}
+	}}
+	srv := f.start(t)
+	g := newOllama(t, srv.URL, time.Minute, false)
+
+	var events []entity.LLMStreamEvent
+	ctx := entity.ContextWithLLMStream(context.Background(), func(ev entity.LLMStreamEvent) {
+		events = append(events, ev)
+	})
+	resp, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+	if err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if resp != `{"ok": true}` {
+		t.Errorf("response = %q", resp)
+	}
+	if len(events) != 3 || !events[0].Reset || events[1].Text != `{"ok"` {
+		t.Errorf("events = %+v, want reset and two chunks", events)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lastChat["stream"] != true {
+		t.Errorf("stream = %v, want true", f.lastChat["stream"])
+	}
+}
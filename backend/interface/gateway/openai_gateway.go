@@ -0,0 +1,328 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+	"go.uber.org/zap"
+)
+
+// OpenAI の /v1/chat/completions 互換 API を話すゲートウェイ
+// OpenAI のほか llama.cpp server, vLLM, LM Studio などのローカルサーバでも使える
+type OpenAILLMGateway struct {
+	client   *http.Client
+	baseURL  string // 例: https://api.openai.com/v1, http://localhost:8000/v1
+	apiKey   string // ローカルサーバなど不要な場合は空
+	model    string
+	jsonMode bool          // response_format で JSON での応答を要求するか
+	timeout  time.Duration // 1回の生成にかける最大時間（ストリーミングで受け取る時間を含む）
+}
+
+func NewOpenAILLMGateway(
+	baseURL, apiKey, model string,
+	jsonMode bool,
+	timeout time.Duration,
+) (*OpenAILLMGateway, error) {
+	zap.L().Debug("Initializing OpenAILLMGateway",
+		zap.String("baseURL", baseURL), zap.String("model", model))
+
+	if baseURL == "" {
+		return nil, fmt.Errorf("openai base URL is not set")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("openai model is not set")
+	}
+	return &OpenAILLMGateway{
+		client:   &http.Client{},
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		apiKey:   apiKey,
+		model:    model,
+		jsonMode: jsonMode,
+		timeout:  timeout,
+	}, nil
+}
+
+// chat/completions のリクエスト
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIChatMessage   `json:"messages"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	TopP           *float64              `json:"top_p,omitempty"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Seed           *int64                `json:"seed,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *openAIStreamOptions  `json:"stream_options,omitempty"`
+}
+
+// ストリーミングの設定（最後のチャンクで利用量を受け取る）
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// chat/completions のレスポンス（使う項目のみ）
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIChatMessage `json:"message"`
+		FinishReason string            `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// stream: true のときに data: 行で届くチャンク（使う項目のみ）
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// エラー時のレスポンス
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func (g *OpenAILLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// LLMGatewayインタフェース
+// context に断片の受け取り先があれば、stream: true で生成しながら断片を渡す
+func (g *OpenAILLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	stream := entity.LLMStreamFromContext(ctx)
+	reqBody := openAIChatRequest{
+		Model:       g.model,
+		Messages:    chatMessages(req),
+		Temperature: req.Sampling.Temperature,
+		TopP:        req.Sampling.TopP,
+		MaxTokens:   req.Sampling.MaxTokens,
+		Seed:        req.Sampling.Seed,
+	}
+	if g.jsonMode {
+		reqBody.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+	}
+	if stream != nil {
+		reqBody.Stream = true
+		reqBody.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+
+	logger.Debug("Generating with OpenAI compatible API",
+		zap.String("model", g.model), zap.String("prompt", req.Prompt()),
+		zap.Bool("stream", stream != nil))
+	resp, err := g.post(ctx, reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var content, finishReason string
+	if stream != nil {
+		content, finishReason, err = readOpenAIStream(ctx, resp.Body, stream)
+	} else {
+		content, finishReason, err = readOpenAIResponse(ctx, resp.Body)
+	}
+	if err != nil {
+		logger.Error("Failed to read chat response", zap.Error(err))
+		return "", err
+	}
+	if finishReason == "content_filter" {
+		return "", &repository.LLMError{
+			Kind:     repository.ErrLLMSafetyBlocked,
+			Provider: consts.LLMProviderOpenAI,
+			Err:      fmt.Errorf("chat completions filtered the content"),
+		}
+	}
+
+	// JSON モードに対応しないサーバのコードブロックなどは呼び出し側で取り除く
+	content = strings.TrimSpace(content)
+
+	logger.Debug("Generated response", zap.String("response", content))
+	return content, nil
+}
+
+// post: chat/completions にリクエストを送り、200 のレスポンスを返す（本文は呼び出し側で閉じる）
+func (g *OpenAILLMGateway) post(
+	ctx context.Context,
+	reqBody openAIChatRequest,
+) (*http.Response, error) {
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		g.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		zap.L().Error("Failed to call chat completions", zap.Error(err))
+		return nil, transportError(consts.LLMProviderOpenAI,
+			fmt.Errorf("failed to call chat completions: %w", err))
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError(consts.LLMProviderOpenAI,
+			fmt.Errorf("failed to read chat response: %w", err))
+	}
+	var errResp openAIErrorResponse
+	msg := strings.TrimSpace(string(respBody))
+	if json.Unmarshal(respBody, &errResp) == nil && errResp.Error.Message != "" {
+		msg = errResp.Error.Message
+	}
+	zap.L().Error("Chat completions returned non-OK status",
+		zap.Int("status", resp.StatusCode), zap.String("error", msg))
+	return nil, classifyHTTPStatus(consts.LLMProviderOpenAI, resp.StatusCode,
+		resp.Header, fmt.Errorf("chat completions returned status %d: %s",
+			resp.StatusCode, msg))
+}
+
+// readOpenAIResponse: stream: false のレスポンスから最初の選択肢の内容と終了理由を読む
+func readOpenAIResponse(ctx context.Context, body io.Reader) (string, string, error) {
+	respBody, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", transportError(consts.LLMProviderOpenAI,
+			fmt.Errorf("failed to read chat response: %w", err))
+	}
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return "", "", badOutputError(consts.LLMProviderOpenAI,
+			fmt.Errorf("failed to decode chat response: %w", err))
+	}
+	if u := chatResp.Usage; u != nil {
+		entity.ReportLLMTokens(ctx, u.PromptTokens, u.CompletionTokens)
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", "", badOutputError(consts.LLMProviderOpenAI,
+			fmt.Errorf("chat completions returned no choices"))
+	}
+	return chatResp.Choices[0].Message.Content, chatResp.Choices[0].FinishReason, nil
+}
+
+// readOpenAIStream: Server-Sent Events で届くチャンクを読み、断片を stream に渡しながら
+// 最初の選択肢の内容をつなげる（data: [DONE] か本文の終わりまで読む）
+func readOpenAIStream(
+	ctx context.Context,
+	body io.Reader,
+	stream entity.LLMStreamFunc,
+) (string, string, error) {
+	stream(entity.LLMStreamEvent{Reset: true})
+
+	var (
+		content      strings.Builder
+		finishReason string
+		chunks       int
+	)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), consts.LLMStreamMaxLineBytes)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // 空行やコメント、event: 行は使わない
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIChatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", "", badOutputError(consts.LLMProviderOpenAI,
+				fmt.Errorf("failed to decode chat chunk: %w", err))
+		}
+		if u := chunk.Usage; u != nil {
+			entity.ReportLLMTokens(ctx, u.PromptTokens, u.CompletionTokens)
+		}
+		if len(chunk.Choices) == 0 {
+			continue // 利用量だけのチャンク
+		}
+		chunks++
+		if r := chunk.Choices[0].FinishReason; r != "" {
+			finishReason = r
+		}
+		if text := chunk.Choices[0].Delta.Content; text != "" {
+			content.WriteString(text)
+			stream(entity.LLMStreamEvent{Text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", transportError(consts.LLMProviderOpenAI,
+			fmt.Errorf("failed to read chat stream: %w", err))
+	}
+	if chunks == 0 {
+		return "", "", badOutputError(consts.LLMProviderOpenAI,
+			fmt.Errorf("chat completions returned no choices"))
+	}
+	return content.String(), finishReason, nil
+}
+
+// chatMessages: system メッセージ（無ければ文化の更新の形式の指示）と会話を chat 形式のメッセージにする
+func chatMessages(req *entity.LLMRequest) []openAIChatMessage {
+	system := req.SystemPrompt()
+	if system == "" {
+		system = consts.SpecifyingResponseFormat
+	}
+	msgs := []openAIChatMessage{{Role: entity.LLMRoleSystem, Content: system}}
+	for _, m := range req.Conversation() {
+		msgs = append(msgs, openAIChatMessage{Role: m.Role, Content: m.Content})
+	}
+	return msgs
+}
+
+var _ repository.LLMGateway = (*OpenAILLMGateway)(nil)
@@ -0,0 +1,252 @@
+package gateway
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// 他のゲートウェイを包み、1分あたりの問い合わせ数・トークン数と同時に問い合わせる数を制限する
+// 待たせる問い合わせは到着順に通し、待っている間に ctx が終われば取りやめる
+type RateLimitedLLMGateway struct {
+	inner    repository.LLMGateway
+	name     string
+	requests *rate.Limiter  // nil は制限なし
+	tokens   *rate.Limiter  // nil は制限なし
+	inFlight *fifoSemaphore // nil は制限なし
+	clock    clock
+
+	mu    sync.Mutex
+	stats entity.LLMLimiterStats
+}
+
+// 各制限は 0 なら制限しない
+func NewRateLimitedLLMGateway(
+	inner repository.LLMGateway,
+	name string,
+	requestsPerMinute, tokensPerMinute, maxInFlight int,
+) *RateLimitedLLMGateway {
+	zap.L().Debug("Initializing RateLimitedLLMGateway",
+		zap.String("gateway", name),
+		zap.Int("requestsPerMinute", requestsPerMinute),
+		zap.Int("tokensPerMinute", tokensPerMinute),
+		zap.Int("maxInFlight", maxInFlight))
+
+	g := &RateLimitedLLMGateway{
+		inner: inner,
+		name:  name,
+		clock: systemClock{},
+		stats: entity.LLMLimiterStats{
+			Gateway:           name,
+			RequestsPerMinute: requestsPerMinute,
+			TokensPerMinute:   tokensPerMinute,
+			MaxInFlight:       maxInFlight,
+		},
+	}
+	if requestsPerMinute > 0 {
+		// 同時に問い合わせてよい数までは続けて通す
+		g.requests = rate.NewLimiter(perMinute(requestsPerMinute), max(maxInFlight, 1))
+	}
+	if tokensPerMinute > 0 {
+		g.tokens = rate.NewLimiter(perMinute(tokensPerMinute), tokensPerMinute)
+	}
+	if maxInFlight > 0 {
+		g.inFlight = newFIFOSemaphore(maxInFlight)
+	}
+	return g
+}
+
+func perMinute(n int) rate.Limit {
+	return rate.Limit(float64(n) / 60)
+}
+
+func (g *RateLimitedLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *RateLimitedLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+
+	start := g.clock.Now()
+	g.update(func(s *entity.LLMLimiterStats) { s.Waiting++ })
+	err := g.wait(ctx, estimateTokens(req.SystemPrompt())+estimateTokens(req.Prompt())+
+		estimateTokens(req.UserInput))
+	wait := g.clock.Now().Sub(start)
+	if err != nil {
+		g.update(func(s *entity.LLMLimiterStats) {
+			s.Waiting--
+			s.Canceled++
+		})
+		logger.Warn("LLM call canceled while queued",
+			zap.String("gateway", g.name), zap.Duration("wait", wait), zap.Error(err))
+		return "", err
+	}
+	g.update(func(s *entity.LLMLimiterStats) {
+		s.Waiting--
+		s.InFlight++
+		s.Requests++
+		s.TotalWaitMs += wait.Milliseconds()
+		s.MaxWaitMs = max(s.MaxWaitMs, wait.Milliseconds())
+		s.AvgWaitMs = float64(s.TotalWaitMs) / float64(s.Requests)
+	})
+	if wait >= time.Millisecond {
+		logger.Info("LLM call waited for rate limit",
+			zap.String("gateway", g.name), zap.Duration("wait", wait))
+	}
+
+	resp, err := g.inner.Generate(ctx, req)
+
+	if g.inFlight != nil {
+		g.inFlight.release()
+	}
+	g.update(func(s *entity.LLMLimiterStats) { s.InFlight-- })
+	// 応答のトークンも後から差し引き、以降の問い合わせを遅らせる
+	if g.tokens != nil {
+		if n := estimateTokens(resp); n > 0 && n <= g.tokens.Burst() {
+			g.tokens.ReserveN(g.clock.Now(), n)
+		}
+	}
+	return resp, err
+}
+
+// wait: 問い合わせ数・トークン数の制限と同時実行数の枠を順に待つ
+func (g *RateLimitedLLMGateway) wait(ctx context.Context, tokens int) error {
+	if g.requests != nil {
+		if err := g.waitN(ctx, g.requests, 1); err != nil {
+			return err
+		}
+	}
+	if g.tokens != nil && tokens > 0 {
+		// 1回で1分の上限を超える問い合わせは上限分だけ待たせる
+		if err := g.waitN(ctx, g.tokens, min(tokens, g.tokens.Burst())); err != nil {
+			return err
+		}
+	}
+	if g.inFlight != nil {
+		if err := g.inFlight.acquire(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitN: lim から n 個を予約し、使えるようになるまで待つ
+// 期限までに使えない・待っている間に ctx が終わった場合は予約を取り消す
+func (g *RateLimitedLLMGateway) waitN(ctx context.Context, lim *rate.Limiter, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := g.clock.Now()
+	r := lim.ReserveN(now, n)
+	if !r.OK() {
+		return fmt.Errorf("rate limit wait for %d exceeds burst %d", n, lim.Burst())
+	}
+	delay := r.DelayFrom(now)
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		r.CancelAt(now)
+		return fmt.Errorf("rate limit wait %s would exceed the deadline: %w",
+			delay, context.DeadlineExceeded)
+	}
+	select {
+	case <-g.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		r.CancelAt(g.clock.Now())
+		return ctx.Err()
+	}
+}
+
+func (g *RateLimitedLLMGateway) update(fn func(s *entity.LLMLimiterStats)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fn(&g.stats)
+}
+
+// LimiterStats: 流量制限の状況
+func (g *RateLimitedLLMGateway) LimiterStats() entity.LLMLimiterStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+// estimateTokens: おおよそのトークン数（4バイトで1トークンとみなす）
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// fifoSemaphore: 到着順に枠を割り当てるセマフォ
+type fifoSemaphore struct {
+	mu      sync.Mutex
+	free    int
+	waiters *list.List // 枠を待つ chan struct{}
+}
+
+func newFIFOSemaphore(n int) *fifoSemaphore {
+	return &fifoSemaphore{free: n, waiters: list.New()}
+}
+
+func (s *fifoSemaphore) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.free > 0 && s.waiters.Len() == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-ready:
+			// 取り消しと同時に枠を受け取った場合は次の待ち手に回す
+			s.handOff()
+		default:
+			s.waiters.Remove(elem)
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *fifoSemaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOff()
+}
+
+// handOff: 待ち手がいれば先頭に枠を渡し、いなければ空きに戻す（mu を持って呼ぶ）
+func (s *fifoSemaphore) handOff() {
+	if front := s.waiters.Front(); front != nil {
+		s.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	s.free++
+}
+
+var (
+	_ repository.LLMGateway       = (*RateLimitedLLMGateway)(nil)
+	_ repository.LLMStatsReporter = (*RateLimitedLLMGateway)(nil)
+)
@@ -0,0 +1,208 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// fixedGateway: 常に同じ応答を返すゲートウェイ
+type fixedGateway struct{ response string }
+
+func (g fixedGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	return g.response, nil
+}
+
+func (g fixedGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 4バイトで1トークンとみなすので、n トークン分のテキスト
+func tokensOf(n int) string {
+	return strings.Repeat("abcd", n)
+}
+
+// 問い合わせ数・トークン数の制限を超えた分だけ待たせる
+func TestRateLimitedGatewayTokenBucket(t *testing.T) {
+	tests := []struct {
+		name              string
+		requestsPerMinute int
+		tokensPerMinute   int
+		maxInFlight       int
+		prompt            string
+		response          string
+		calls             int
+		wantWaits         []time.Duration
+	}{
+		{name: "no limits", prompt: tokensOf(30), calls: 3},
+		{name: "requests per minute", requestsPerMinute: 60,
+			prompt: tokensOf(1), calls: 3, wantWaits: []time.Duration{time.Second, time.Second}},
+		{name: "max in flight sets the request burst", requestsPerMinute: 60, maxInFlight: 2,
+			prompt: tokensOf(1), calls: 3, wantWaits: []time.Duration{time.Second}},
+		{name: "tokens per minute", tokensPerMinute: 60,
+			prompt: tokensOf(30), calls: 3, wantWaits: []time.Duration{30 * time.Second}},
+		{name: "response tokens are charged afterwards", tokensPerMinute: 60,
+			prompt: tokensOf(30), response: tokensOf(30), calls: 2,
+			wantWaits: []time.Duration{30 * time.Second}},
+		{name: "oversized request waits for a full minute", tokensPerMinute: 60,
+			prompt: tokensOf(100), calls: 2, wantWaits: []time.Duration{time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			g := gateway.NewRateLimitedLLMGateway(fixedGateway{response: tt.response}, "fake",
+				tt.requestsPerMinute, tt.tokensPerMinute, tt.maxInFlight)
+			g.SetClock(clock)
+
+			for range tt.calls {
+				if _, err := g.GenerateCultureUpdate(
+					context.Background(), tt.prompt, ""); err != nil {
+					t.Fatalf("failed to generate: %v", err)
+				}
+			}
+			waits := clock.Waits()
+			if len(waits) != len(tt.wantWaits) {
+				t.Fatalf("waits = %v, want %v", waits, tt.wantWaits)
+			}
+			var maxWait time.Duration
+			for i, want := range tt.wantWaits {
+				// 予約した時点の時計で求めるので、丸めの誤差だけ許す
+				if d := waits[i] - want; d < -time.Millisecond || d > time.Millisecond {
+					t.Errorf("wait %d = %v, want %v", i, waits[i], want)
+				}
+				maxWait = max(maxWait, waits[i])
+			}
+
+			stats := g.LimiterStats()
+			if stats.Requests != int64(tt.calls) || stats.InFlight != 0 || stats.Waiting != 0 ||
+				stats.MaxWaitMs != maxWait.Milliseconds() {
+				t.Errorf("stats = %+v, want %d requests and max wait %v",
+					stats, tt.calls, maxWait)
+			}
+		})
+	}
+}
+
+// 期限までに順番が来ない問い合わせは待たずに失敗し、予約した枠を次の問い合わせに回す
+func TestRateLimitedGatewayDeadline(t *testing.T) {
+	clock := newFakeClock()
+	g := gateway.NewRateLimitedLLMGateway(fixedGateway{}, "fake", 60, 0, 0)
+	g.SetClock(clock)
+	ctx := context.Background()
+
+	if _, err := g.GenerateCultureUpdate(ctx, "first", ""); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := g.GenerateCultureUpdate(short, "second", ""); !errors.Is(
+		err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := g.GenerateCultureUpdate(ctx, "third", ""); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+
+	if waits := clock.Waits(); len(waits) != 1 || waits[0] != time.Second {
+		t.Errorf("waits = %v, want [1s]", waits)
+	}
+	if stats := g.LimiterStats(); stats.Canceled != 1 || stats.Requests != 2 {
+		t.Errorf("stats = %+v, want 1 canceled and 2 requests", stats)
+	}
+}
+
+// 待っている間に取り消された問い合わせは送らない
+func TestRateLimitedGatewayCanceledWhileQueued(t *testing.T) {
+	clock := newFakeClock()
+	clock.blocking = true
+	inner := &scriptedGateway{response: "ok"}
+	g := gateway.NewRateLimitedLLMGateway(inner, "fake", 60, 0, 0)
+	g.SetClock(clock)
+
+	if _, err := g.GenerateCultureUpdate(context.Background(), "first", ""); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := g.GenerateCultureUpdate(ctx, "second", ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	if inner.Calls() != 1 {
+		t.Errorf("calls = %d, want 1", inner.Calls())
+	}
+	if stats := g.LimiterStats(); stats.Canceled != 1 || stats.Waiting != 0 {
+		t.Errorf("stats = %+v, want 1 canceled and none waiting", stats)
+	}
+}
+
+// orderGateway: 問い合わせの順番を記録し、release を閉じるまで応答しない
+type orderGateway struct {
+	release chan struct{}
+
+	mu    sync.Mutex
+	order []string
+}
+
+func (g *orderGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	g.mu.Lock()
+	g.order = append(g.order, req.Prompt())
+	g.mu.Unlock()
+	<-g.release
+	return "ok", nil
+}
+
+func (g *orderGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 同時に問い合わせる数の枠は到着順に渡し、取り消した待ち手の分は次に回す
+func TestRateLimitedGatewayInFlightIsFIFO(t *testing.T) {
+	inner := &orderGateway{release: make(chan struct{})}
+	g := gateway.NewRateLimitedLLMGateway(inner, "fake", 0, 0, 1)
+
+	var wg sync.WaitGroup
+	start := func(ctx context.Context, prompt string, waiting int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.GenerateCultureUpdate(ctx, prompt, "")
+		}()
+		// 枠を待つ列に並んだのを確かめてから次を並ばせる
+		for g.LimiterStats().Waiting+g.LimiterStats().InFlight < waiting {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	start(context.Background(), "a", 1)
+	start(canceled, "b", 2)
+	start(context.Background(), "c", 3)
+	start(context.Background(), "d", 4)
+	cancel()
+	for g.LimiterStats().Canceled == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	if got := strings.Join(inner.order, ","); got != "a,c,d" {
+		t.Errorf("order = %s, want a,c,d", got)
+	}
+	if stats := g.LimiterStats(); stats.Canceled != 1 || stats.Requests != 3 ||
+		stats.InFlight != 0 || stats.Waiting != 0 {
+		t.Errorf("stats = %+v, want 3 requests and 1 canceled", stats)
+	}
+}
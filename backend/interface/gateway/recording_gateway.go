@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/config"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+	"go.uber.org/zap"
+)
+
+// 他のゲートウェイを包み、context に記録先があれば問い合わせと応答を記録する
+// 包んだゲートウェイが報告したトークン数（料金表から求めた費用も）や、実際に応答したゲートウェイも記録する
+type RecordingLLMGateway struct {
+	inner repository.LLMGateway
+	name  string // 記録に残すゲートウェイ名
+	model string
+}
+
+func NewRecordingLLMGateway(
+	inner repository.LLMGateway,
+	name, model string,
+) *RecordingLLMGateway {
+	zap.L().Debug("Initializing RecordingLLMGateway", zap.String("gateway", name))
+	return &RecordingLLMGateway{inner: inner, name: name, model: model}
+}
+
+func (g *RecordingLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *RecordingLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	rec := entity.TranscriptRecorderFromContext(ctx)
+	if rec == nil {
+		return g.inner.Generate(ctx, req)
+	}
+
+	userInput := redactionTarget(ctx, req)
+	exchange := rec.Begin(newLLMExchange(ctx, g.name, g.model, req))
+	// 内部で行われる問い合わせはこの問い合わせの子として記録する
+	var report entity.LLMCallReport
+	innerCtx := entity.ContextWithLLMCallReport(
+		entity.ContextWithLLMParent(ctx, exchange.Seq), &report)
+	if userInput != "" {
+		innerCtx = context.WithValue(innerCtx, redactionTargetKey{}, userInput)
+	}
+	resp, err := g.inner.Generate(innerCtx, req)
+	report.Aggregation = redactAggregation(report.Aggregation, userInput)
+	rec.SetReport(exchange, report, config.LLMPricing[g.model].Cost(
+		report.PromptTokens, report.CompletionTokens))
+	rec.Finish(exchange, redactUserInput(resp, userInput), err)
+	return resp, err
+}
+
+// newLLMExchange: 問い合わせの記録（設定に応じて利用者の入力を伏せる）
+func newLLMExchange(
+	ctx context.Context,
+	name, model string,
+	req *entity.LLMRequest,
+) *entity.LLMExchange {
+	userInput := redactionTarget(ctx, req)
+	e := &entity.LLMExchange{
+		ParentSeq: entity.LLMParentFromContext(ctx),
+		Stage:     entity.LLMStageFromContext(ctx),
+		Gateway:   name,
+		Model:     model,
+		System:    req.SystemPrompt(),
+		Prompt:    redactUserInput(req.Prompt(), userInput),
+		UserInput: redactUserInput(req.UserInput, userInput),
+	}
+	if !req.Sampling.IsZero() {
+		sampling := req.Sampling
+		e.Sampling = &sampling
+	}
+	return e
+}
+
+type redactionTargetKey struct{}
+
+// redactionTarget: 記録で伏せる利用者の入力
+// 候補を選ばせる問い合わせなど、利用者の入力を持たない内部の問い合わせも、
+// 候補の回答に含まれた入力を伏せられるよう、外側の問い合わせの入力を使う
+func redactionTarget(ctx context.Context, req *entity.LLMRequest) string {
+	if req.UserInput != "" {
+		return req.UserInput
+	}
+	userInput, _ := ctx.Value(redactionTargetKey{}).(string)
+	return userInput
+}
+
+// redactAggregation: 設定に応じて、候補の回答・失敗と選んだ理由から利用者の入力を伏せた複製を返す
+// 集約したゲートウェイの持つ候補は書き換えない
+func redactAggregation(agg *entity.LLMAggregation, userInput string) *entity.LLMAggregation {
+	if agg == nil || !config.TranscriptRedactUserInput || userInput == "" {
+		return agg
+	}
+	cp := *agg
+	cp.Candidates = slices.Clone(agg.Candidates)
+	for i := range cp.Candidates {
+		c := &cp.Candidates[i]
+		c.Response = redactUserInput(c.Response, userInput)
+		c.Error = redactUserInput(c.Error, userInput)
+	}
+	cp.Note = redactUserInput(cp.Note, userInput)
+	return &cp
+}
+
+// 設定に応じて、text 中の利用者の入力を伏せ字にする
+func redactUserInput(text, userInput string) string {
+	if !config.TranscriptRedactUserInput || userInput == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, userInput, consts.RedactedText)
+}
+
+var _ repository.LLMGateway = (*RecordingLLMGateway)(nil)
@@ -0,0 +1,118 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+	"github.com/rayfiyo/zousui/backend/utils/config"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+)
+
+// echoGateway: 利用者の入力や候補をそのまま応答に含めるゲートウェイ
+type echoGateway struct{}
+
+func (echoGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	var out any
+	switch req.Schema {
+	case entity.JudgeChoiceSchema:
+		// 候補を並べたプロンプトを選んだ理由として返す
+		out = map[string]any{"choice": 1, "reason": req.Prompt()}
+	default:
+		out = map[string]any{"newCulture": req.Prompt() + req.UserInput, "populationChange": 1}
+	}
+	raw, err := json.Marshal(out)
+	return string(raw), err
+}
+
+func (g echoGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 伏せる設定では、集約の候補・選んだ理由・集約した回答のどこにも利用者の入力が残らない
+func TestRecordingRedactsAggregation(t *testing.T) {
+	const userInput = "秘密の合言葉"
+	config.TranscriptRedactUserInput = true
+	t.Cleanup(func() { config.TranscriptRedactUserInput = false })
+
+	for _, strategy := range []string{
+		entity.LLMAggregateSynthesize,
+		entity.LLMAggregateFirstValid,
+		entity.LLMAggregateJudge,
+	} {
+		t.Run(strategy, func(t *testing.T) {
+			sub := func(name string) gateway.NamedLLMGateway {
+				return gateway.NamedLLMGateway{
+					Name: name, Gateway: gateway.NewRecordingLLMGateway(echoGateway{}, name, ""),
+				}
+			}
+			failing := gateway.NamedLLMGateway{Name: "failing", Gateway: failingGateway{
+				err: &repository.LLMError{Kind: repository.ErrLLMInvalidRequest,
+					Err: errors.New("rejected input: " + userInput)},
+			}}
+			multi := gateway.NewRecordingLLMGateway(gateway.NewMultiLLMGateway(
+				gateway.NewRecordingLLMGateway(echoGateway{}, "aggregator", ""),
+				map[string]string{"culture": strategy}, 0, 0,
+				sub("a"), sub("b"), failing), "multi", "")
+
+			rec := entity.NewTranscriptRecorder()
+			req := entity.NewLLMRequest("文化を進化させてください", userInput)
+			req.Schema = entity.CultureUpdateSchema
+			req.SimulationType = "culture"
+			resp, err := multi.Generate(entity.ContextWithTranscriptRecorder(
+				context.Background(), rec), req)
+			if err != nil {
+				t.Fatalf("failed to generate: %v", err)
+			}
+			if !strings.Contains(resp, userInput) {
+				t.Fatalf("response = %q, want the user input returned to the caller", resp)
+			}
+
+			transcript := rec.Transcript("sim")
+			raw, err := json.Marshal(transcript)
+			if err != nil {
+				t.Fatalf("failed to encode transcript: %v", err)
+			}
+			if strings.Contains(string(raw), userInput) {
+				t.Errorf("transcript contains the user input: %s", raw)
+			}
+			top := transcript.Exchanges[0]
+			if top.Aggregation == nil || len(top.Aggregation.Candidates) != 3 ||
+				!strings.Contains(top.Aggregation.Candidates[0].Response, consts.RedactedText) ||
+				!strings.Contains(top.Response, consts.RedactedText) {
+				t.Errorf("top exchange = %+v, want redacted candidates and response", top)
+			}
+		})
+	}
+}
+
+// 伏せる設定が無ければ候補をそのまま記録する
+func TestRecordingKeepsAggregationWithoutRedaction(t *testing.T) {
+	const userInput = "秘密の合言葉"
+	multi := gateway.NewRecordingLLMGateway(gateway.NewMultiLLMGateway(nil,
+		map[string]string{"culture": entity.LLMAggregateFirstValid}, 0, 0,
+		gateway.NamedLLMGateway{Name: "a", Gateway: echoGateway{}}), "multi", "")
+
+	rec := entity.NewTranscriptRecorder()
+	req := entity.NewLLMRequest("文化を進化させてください", userInput)
+	req.SimulationType = "culture"
+	if _, err := multi.Generate(entity.ContextWithTranscriptRecorder(
+		context.Background(), rec), req); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	top := rec.Transcript("sim").Exchanges[0]
+	if got := top.Aggregation.Candidates[0].Response; !strings.Contains(got, userInput) {
+		t.Errorf("candidate response = %q, want %q kept", got, userInput)
+	}
+	if top.UserInput != userInput {
+		t.Errorf("user input = %q, want %q", top.UserInput, userInput)
+	}
+}
@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// 他のゲートウェイを包み、一時的な失敗（レート制限・利用不可）を間隔を空けて再試行する
+type RetryLLMGateway struct {
+	inner      repository.LLMGateway
+	name       string
+	maxRetries int           // 最初の問い合わせ以外に再試行する回数
+	baseDelay  time.Duration // 1回目の再試行までの待ち時間（以降は倍にしていく）
+	maxDelay   time.Duration // 待ち時間の上限
+	clock      clock
+}
+
+func NewRetryLLMGateway(
+	inner repository.LLMGateway,
+	name string,
+	maxRetries int,
+	baseDelay, maxDelay time.Duration,
+) *RetryLLMGateway {
+	zap.L().Debug("Initializing RetryLLMGateway",
+		zap.String("gateway", name), zap.Int("maxRetries", maxRetries))
+	return &RetryLLMGateway{
+		inner:      inner,
+		name:       name,
+		maxRetries: maxRetries,
+		baseDelay:  baseDelay,
+		maxDelay:   maxDelay,
+		clock:      systemClock{},
+	}
+}
+
+func (g *RetryLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *RetryLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := g.inner.Generate(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		var llmErr *repository.LLMError
+		if !errors.As(err, &llmErr) || !llmErr.Retryable() || attempt >= g.maxRetries ||
+			ctx.Err() != nil {
+			return "", err
+		}
+
+		delay := g.backoff(attempt)
+		if llmErr.RetryAfter > delay {
+			delay = llmErr.RetryAfter
+		}
+		// 待っている間に期限が来るなら、再試行せず今の失敗を返す
+		if deadline, ok := ctx.Deadline(); ok && g.clock.Now().Add(delay).After(deadline) {
+			logger.Warn("Not retrying LLM call past the deadline",
+				zap.String("gateway", g.name), zap.Error(err))
+			return "", err
+		}
+
+		logger.Warn("Retrying LLM call",
+			zap.String("gateway", g.name), zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay), zap.Error(err))
+		select {
+		case <-g.clock.After(delay):
+		case <-ctx.Done():
+			return "", err
+		}
+	}
+}
+
+// backoff: attempt 回目の再試行までの待ち時間
+// 指数的に伸ばし、同時に失敗した問い合わせが揃って再試行しないよう後半をランダムにする
+func (g *RetryLLMGateway) backoff(attempt int) time.Duration {
+	d := g.baseDelay << attempt
+	if d <= 0 || d > g.maxDelay {
+		d = g.maxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+var _ repository.LLMGateway = (*RetryLLMGateway)(nil)
@@ -0,0 +1,241 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+)
+
+// fakeClock: 待つと待った分だけ時刻を進めてすぐに戻る時計
+// blocking なら時間を進めず、待ちは終わらない
+type fakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	waits    []time.Duration
+	blocking bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	if !c.blocking {
+		c.now = c.now.Add(d)
+		ch <- c.now
+	}
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
+
+var _ gateway.Clock = (*fakeClock)(nil)
+
+// scriptedGateway: 決めた順に失敗し、使い切ったら response を返すゲートウェイ
+type scriptedGateway struct {
+	errs     []error
+	response string
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (g *scriptedGateway) Generate(ctx context.Context, req *entity.LLMRequest) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls++
+	if g.calls <= len(g.errs) {
+		return "", g.errs[g.calls-1]
+	}
+	return g.response, nil
+}
+
+func (g *scriptedGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+func (g *scriptedGateway) Calls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+func llmError(kind error, retryAfter time.Duration) error {
+	return &repository.LLMError{Kind: kind, Provider: "fake", RetryAfter: retryAfter,
+		Err: errors.New("fake failure")}
+}
+
+// waitRange: 再試行までの待ち時間の範囲（後半はランダム）
+type waitRange struct{ min, max time.Duration }
+
+func TestRetryGateway(t *testing.T) {
+	unavailable := llmError(repository.ErrLLMUnavailable, 0)
+	tests := []struct {
+		name       string
+		errs       []error
+		maxRetries int
+		baseDelay  time.Duration
+		maxDelay   time.Duration
+		wantCalls  int
+		wantErr    error // nil なら成功
+		wantWaits  []waitRange
+	}{
+		{
+			name:       "retries transient failures with exponential backoff",
+			errs:       []error{unavailable, llmError(repository.ErrLLMRateLimited, 0)},
+			maxRetries: 3, baseDelay: 100 * time.Millisecond, maxDelay: time.Second,
+			wantCalls: 3,
+			wantWaits: []waitRange{
+				{50 * time.Millisecond, 100 * time.Millisecond},
+				{100 * time.Millisecond, 200 * time.Millisecond},
+			},
+		},
+		{
+			name:       "waits for Retry-After when it is longer than the backoff",
+			errs:       []error{llmError(repository.ErrLLMRateLimited, 3*time.Second)},
+			maxRetries: 1, baseDelay: 100 * time.Millisecond, maxDelay: time.Second,
+			wantCalls: 2,
+			wantWaits: []waitRange{{3 * time.Second, 3 * time.Second}},
+		},
+		{
+			name:       "keeps the backoff when Retry-After is shorter",
+			errs:       []error{llmError(repository.ErrLLMRateLimited, time.Millisecond)},
+			maxRetries: 1, baseDelay: time.Second, maxDelay: 10 * time.Second,
+			wantCalls: 2,
+			wantWaits: []waitRange{{500 * time.Millisecond, time.Second}},
+		},
+		{
+			name:       "caps the backoff at the maximum delay",
+			errs:       []error{unavailable, unavailable, unavailable},
+			maxRetries: 3, baseDelay: time.Second, maxDelay: 2 * time.Second,
+			wantCalls: 4,
+			wantWaits: []waitRange{
+				{500 * time.Millisecond, time.Second},
+				{time.Second, 2 * time.Second},
+				{time.Second, 2 * time.Second},
+			},
+		},
+		{
+			name:       "gives up after the maximum retries",
+			errs:       []error{unavailable, unavailable, unavailable},
+			maxRetries: 2, baseDelay: time.Millisecond, maxDelay: time.Second,
+			wantCalls: 3, wantErr: repository.ErrLLMUnavailable,
+			wantWaits: []waitRange{
+				{500 * time.Microsecond, time.Millisecond},
+				{time.Millisecond, 2 * time.Millisecond},
+			},
+		},
+		{
+			name:       "does not retry an invalid request",
+			errs:       []error{llmError(repository.ErrLLMInvalidRequest, 0)},
+			maxRetries: 3, baseDelay: time.Millisecond, maxDelay: time.Second,
+			wantCalls: 1, wantErr: repository.ErrLLMInvalidRequest,
+		},
+		{
+			name:       "does not retry an unclassified error",
+			errs:       []error{errors.New("boom")},
+			maxRetries: 3, baseDelay: time.Millisecond, maxDelay: time.Second,
+			wantCalls: 1, wantErr: errors.New("boom"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &scriptedGateway{errs: tt.errs, response: "ok"}
+			clock := newFakeClock()
+			g := gateway.NewRetryLLMGateway(inner, "fake", tt.maxRetries,
+				tt.baseDelay, tt.maxDelay)
+			g.SetClock(clock)
+
+			resp, err := g.GenerateCultureUpdate(context.Background(), "prompt", "")
+			switch {
+			case tt.wantErr == nil && (err != nil || resp != "ok"):
+				t.Errorf("got (%q, %v), want ok", resp, err)
+			case tt.wantErr != nil && err == nil:
+				t.Errorf("got no error, want %v", tt.wantErr)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr) &&
+				err.Error() != tt.wantErr.Error():
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if inner.Calls() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", inner.Calls(), tt.wantCalls)
+			}
+			waits := clock.Waits()
+			if len(waits) != len(tt.wantWaits) {
+				t.Fatalf("waits = %v, want %d waits", waits, len(tt.wantWaits))
+			}
+			for i, w := range tt.wantWaits {
+				if waits[i] < w.min || waits[i] > w.max {
+					t.Errorf("wait %d = %v, want between %v and %v", i, waits[i], w.min, w.max)
+				}
+			}
+		})
+	}
+}
+
+// 待つと期限を過ぎる場合は再試行せず、今の失敗を返す
+func TestRetryGatewayStopsBeforeDeadline(t *testing.T) {
+	inner := &scriptedGateway{
+		errs: []error{llmError(repository.ErrLLMRateLimited, time.Minute)}, response: "ok"}
+	clock := newFakeClock()
+	g := gateway.NewRetryLLMGateway(inner, "fake", 3, time.Millisecond, time.Second)
+	g.SetClock(clock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+	if !errors.Is(err, repository.ErrLLMRateLimited) {
+		t.Errorf("error = %v, want %v", err, repository.ErrLLMRateLimited)
+	}
+	if inner.Calls() != 1 || len(clock.Waits()) != 0 {
+		t.Errorf("calls = %d, waits = %v; want 1 call and no wait", inner.Calls(), clock.Waits())
+	}
+}
+
+// 待っている間に取り消されたら、再試行せず最後の失敗を返す
+func TestRetryGatewayStopsWhenCanceled(t *testing.T) {
+	inner := &scriptedGateway{errs: []error{llmError(repository.ErrLLMUnavailable, 0)},
+		response: "ok"}
+	clock := newFakeClock()
+	clock.blocking = true
+	g := gateway.NewRetryLLMGateway(inner, "fake", 3, time.Second, time.Minute)
+	g.SetClock(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := g.GenerateCultureUpdate(ctx, "prompt", "")
+	if !errors.Is(err, repository.ErrLLMUnavailable) {
+		t.Errorf("error = %v, want %v", err, repository.ErrLLMUnavailable)
+	}
+	if inner.Calls() != 1 {
+		t.Errorf("calls = %d, want 1", inner.Calls())
+	}
+}
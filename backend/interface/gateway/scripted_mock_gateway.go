@@ -0,0 +1,288 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// MockRules: ScriptedMockLLMGateway の応答ルール（YAML または JSON で書く）
+type MockRules struct {
+	Rules []MockRule `json:"rules" yaml:"rules"`
+}
+
+// MockRule: 条件に合う問い合わせへの応答。上から順に調べ、最初に合ったルールを使う
+type MockRule struct {
+	Name           string         `json:"name" yaml:"name"`
+	Prompt         string         `json:"prompt" yaml:"prompt"`                 // プロンプトに対する正規表現（空なら何にでも合う）
+	SimulationType string         `json:"simulationType" yaml:"simulationType"` // 空なら何にでも合う
+	Responses      []MockResponse `json:"responses" yaml:"responses"`           // 呼ばれるたびに順に返す
+	Loop           bool           `json:"loop" yaml:"loop"`                     // 最後まで返したら先頭に戻る（false なら最後を繰り返す）
+}
+
+// MockResponse: 1回分の応答
+type MockResponse struct {
+	// text/template で展開する応答
+	// .Prompt .UserInput .SimulationType .CommunityIDs .Call .Match と randInt, pick が使える
+	Body      string `json:"body" yaml:"body"`
+	Error     string `json:"error" yaml:"error"`         // 空でなければこのメッセージで失敗する
+	ErrorKind string `json:"errorKind" yaml:"errorKind"` // 失敗の分類 (rate_limited, unavailable, invalid_request, safety_blocked, bad_output)
+	Delay     string `json:"delay" yaml:"delay"`         // 応答までの待ち時間 (例: 2s)
+	Malformed bool   `json:"malformed" yaml:"malformed"` // 応答を途中で切って壊れた JSON にする
+}
+
+// LoadMockRules: 拡張子が .yaml / .yml なら YAML、それ以外は JSON として読み込む
+func LoadMockRules(path string) (*MockRules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock rules: %w", err)
+	}
+	var rules MockRules
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &rules)
+	default:
+		err = json.Unmarshal(b, &rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mock rules %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+// DefaultMockRules: ルールファイルが無いときに使う、すべての応答形式に答えるルール
+func DefaultMockRules() *MockRules {
+	return &MockRules{Rules: []MockRule{
+		{
+			Name:           "diplomacy",
+			SimulationType: entity.SimulationTypeDiplomacy,
+			Responses: []MockResponse{{Body: `{
+  "outcome": "{{pick "peace" "war" "trade" "alliance"}}",
+  "description": "{{pick "国境で祭りを共催することになった" "水源を巡って小競り合いが起きた" "香辛料と織物の交易路が開かれた"}}",
+  "popChangeA": {{randInt -10 10}},
+  "popChangeB": {{randInt -10 10}}
+}`}},
+		},
+		{
+			// 2つのコミュニティの干渉（集約ゲートウェイの再問い合わせも含む）
+			Name:   "interference-between-communities",
+			Prompt: `newCultureA`,
+			Responses: []MockResponse{{Body: `{
+  "newCultureA": "{{pick "Bの歌を取り入れた砂漠の祭典文化" "Bの技術で水路を築く文化"}}",
+  "populationChangeA": {{randInt -5 10}},
+  "newCultureB": "{{pick "Aの生存術を学んだ海底探検文化" "Aの交易を真似た市場文化"}}",
+  "populationChangeB": {{randInt -5 10}}
+}`}},
+		},
+		{
+			Name: "culture-update",
+			Responses: []MockResponse{{Body: `{
+  "newCulture": "{{pick "踊りを中心にした新たな祭典文化" "星を読む航海の文化" "職人が集う工芸の文化"}}",
+  "populationChange": {{randInt -5 20}}
+}`}},
+		},
+	}}
+}
+
+// ルールをもとに問い合わせへ応答するモックゲートウェイ
+// API キーなしでデモやすべての処理経路の確認ができる
+type ScriptedMockLLMGateway struct {
+	rules []*scriptedRule
+
+	mu sync.Mutex
+}
+
+type scriptedRule struct {
+	MockRule
+	prompt    *regexp.Regexp
+	templates []*template.Template
+	delays    []time.Duration
+	calls     int // このルールが使われた回数
+}
+
+// テンプレートに渡す値
+type mockTemplateData struct {
+	Prompt         string
+	UserInput      string
+	SimulationType string
+	CommunityIDs   []string
+	Call           int      // このルールが何回目に使われたか (1 始まり)
+	Match          []string // Prompt の正規表現のサブマッチ
+}
+
+var mockTemplateFuncs = template.FuncMap{
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.Intn(max-min+1)
+	},
+	"pick": func(choices ...string) string {
+		if len(choices) == 0 {
+			return ""
+		}
+		return choices[rand.Intn(len(choices))]
+	},
+}
+
+func NewScriptedMockLLMGateway(
+	rules *MockRules,
+) (*ScriptedMockLLMGateway, error) {
+	zap.L().Debug("Initializing ScriptedMockLLMGateway",
+		zap.Int("rules", len(rules.Rules)))
+
+	g := &ScriptedMockLLMGateway{}
+	for i, r := range rules.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(r.Responses) == 0 {
+			return nil, fmt.Errorf("mock rule %s has no responses", name)
+		}
+		sr := &scriptedRule{MockRule: r}
+		sr.Name = name
+		if r.Prompt != "" {
+			re, err := regexp.Compile(r.Prompt)
+			if err != nil {
+				return nil, fmt.Errorf("mock rule %s: invalid prompt pattern: %w", name, err)
+			}
+			sr.prompt = re
+		}
+		for j, resp := range r.Responses {
+			tmpl, err := template.New(fmt.Sprintf("%s[%d]", name, j)).
+				Funcs(mockTemplateFuncs).Parse(resp.Body)
+			if err != nil {
+				return nil, fmt.Errorf("mock rule %s: invalid body template: %w", name, err)
+			}
+			if _, ok := llmErrorKinds[resp.ErrorKind]; resp.ErrorKind != "" && !ok {
+				return nil, fmt.Errorf("mock rule %s: unknown error kind %q", name, resp.ErrorKind)
+			}
+			var delay time.Duration
+			if resp.Delay != "" {
+				if delay, err = time.ParseDuration(resp.Delay); err != nil {
+					return nil, fmt.Errorf("mock rule %s: invalid delay: %w", name, err)
+				}
+			}
+			sr.templates = append(sr.templates, tmpl)
+			sr.delays = append(sr.delays, delay)
+		}
+		g.rules = append(g.rules, sr)
+	}
+	return g, nil
+}
+
+func (g *ScriptedMockLLMGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt string,
+	userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// LLMGatewayインタフェース
+func (g *ScriptedMockLLMGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	logger := zap.L()
+
+	rule, idx, data, ok := g.next(req)
+	if !ok {
+		logger.Error("No mock rule matched", zap.String("prompt", req.Prompt()),
+			zap.String("simulationType", req.SimulationType))
+		return "", errors.New("no mock rule matched the prompt")
+	}
+	resp := rule.Responses[idx]
+	logger.Debug("Mock rule matched",
+		zap.String("rule", rule.Name), zap.Int("call", data.Call))
+
+	if d := rule.delays[idx]; d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if resp.Error != "" {
+		return "", mockError(resp)
+	}
+
+	var buf bytes.Buffer
+	if err := rule.templates[idx].Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render mock response %s: %w", rule.Name, err)
+	}
+	out := buf.String()
+	if resp.Malformed {
+		runes := []rune(out)
+		out = string(runes[:len(runes)/2])
+	}
+	logger.Debug("Mock response", zap.String("response", out))
+	entity.StreamLLMResponse(ctx, out)
+	return out, nil
+}
+
+// mockError: 分類の指定があれば、提供元のエラーと同じ分類のエラーにする
+func mockError(resp MockResponse) error {
+	err := errors.New(resp.Error)
+	kind, ok := llmErrorKinds[resp.ErrorKind]
+	if !ok {
+		return err
+	}
+	return &repository.LLMError{Kind: kind, Provider: "scripted", Err: err}
+}
+
+// next: 合うルールと、今回返す応答の位置を決める
+func (g *ScriptedMockLLMGateway) next(
+	req *entity.LLMRequest,
+) (*scriptedRule, int, mockTemplateData, bool) {
+	prompt := req.Prompt()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, r := range g.rules {
+		if r.SimulationType != "" && r.SimulationType != req.SimulationType {
+			continue
+		}
+		var match []string
+		if r.prompt != nil {
+			if match = r.prompt.FindStringSubmatch(prompt); match == nil {
+				continue
+			}
+		}
+		idx := r.calls
+		if idx >= len(r.Responses) {
+			if r.Loop {
+				idx %= len(r.Responses)
+			} else {
+				idx = len(r.Responses) - 1
+			}
+		}
+		r.calls++
+		return r, idx, mockTemplateData{
+			Prompt:         prompt,
+			UserInput:      req.UserInput,
+			SimulationType: req.SimulationType,
+			CommunityIDs:   req.CommunityIDs,
+			Call:           r.calls,
+			Match:          match,
+		}, true
+	}
+	return nil, 0, mockTemplateData{}, false
+}
+
+var _ repository.LLMGateway = (*ScriptedMockLLMGateway)(nil)
@@ -1,8 +1,11 @@
 package router
 
 import (
+	"strings"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/interface/controller"
 	"go.uber.org/zap"
 )
@@ -14,6 +17,10 @@ func NewRouter(
 	imageCtrl *controller.ImageController,
 	interferenceCtrl *controller.InterferenceController,
 	simulationCtrl *controller.SimulationController,
+	worldCtrl *controller.WorldController,
+	eventCtrl *controller.EventController,
+	llmAdminCtrl *controller.LLMAdminController,
+	usageCtrl *controller.UsageController,
 ) *gin.Engine {
 	logger := zap.L()
 
@@ -22,29 +29,76 @@ func NewRouter(
 	// Gin
 	r := gin.Default()
 	r.Use(cors.Default())
+	// ユースケースに渡す gin.Context から、リクエストの context の値も読めるようにする
+	r.ContextWithFallback = true
+	r.Use(llmCacheBypass())
 
-	// コミュニティ一覧 + CRUD
+	// コミュニティ一覧 (?include=deleted でゴミ箱も含める) + CRUD
 	r.GET("/communities", commCtrl.GetCommunities)
 	r.GET("/communities/:id", commCtrl.GetCommunity)
 	r.POST("/communities", commCtrl.CreateCommunity)
 	r.DELETE("/communities/:id", commCtrl.DeleteCommunity)
 
+	// ゴミ箱からの復元と完全削除
+	r.POST("/communities/:id/restore", commCtrl.RestoreCommunity)
+	r.POST("/communities/:id/purge", commCtrl.PurgeCommunity)
+
+	// 文化の改訂履歴
+	r.GET("/communities/:id/history", commCtrl.GetCultureHistory)
+	r.GET("/communities/:id/revisions/:rev", commCtrl.GetCultureRevision)
+
 	// 外交シミュレーション
 	r.POST("/simulate/diplomacy", diploCtrl.SimulateDiplomacy)
+	r.POST("/simulate/diplomacy/stream", diploCtrl.SimulateDiplomacyStream)
 
-	// シミュレーション実行
+	// シミュレーション実行（/stream は LLM の応答の断片と結果を Server-Sent Events で送る）
 	r.POST("/simulate/:communityID", simCtrl.Simulate)
+	r.POST("/simulate/:communityID/stream", simCtrl.SimulateStream)
 
 	// 画像生成API
-	r.POST("/communities/:communityID/generateImage", imageCtrl.GenerateImage)
+	r.POST("/communities/:id/generateImage", imageCtrl.GenerateImage)
 
 	// 干渉シミュレーション (コミュニティAとB)
 	r.POST("/simulate/interference",
 		interferenceCtrl.SimulateInterferenceBetweenCommunities)
+	r.POST("/simulate/interference/stream",
+		interferenceCtrl.SimulateInterferenceBetweenCommunitiesStream)
 
-	// シミュレーション履歴取得API
+	// シミュレーション履歴取得API（絞り込み・ページ送りはクエリパラメータで指定）
 	r.GET("/simulations/history", simulationCtrl.GetSimulationHistory)
+	r.GET("/simulations/:id", simulationCtrl.GetSimulation)
+	r.GET("/simulations/:id/transcript", simulationCtrl.GetTranscript)
+	r.GET("/simulations/:id/usage", usageCtrl.GetSimulationUsage)
+
+	// LLM の利用量（トークン数・費用）の集計と予算の状況
+	r.GET("/usage", usageCtrl.GetUsage)
+
+	// ワールド全体のスナップショット
+	r.GET("/world/export", worldCtrl.ExportWorld)
+	r.POST("/world/import", worldCtrl.ImportWorld)
+
+	// イベントログと、ログからの再構築
+	r.GET("/events", eventCtrl.ListEvents)
+	r.GET("/world/replay", eventCtrl.ReplayWorld)
+	r.POST("/world/rebuild", eventCtrl.RebuildWorld)
+
+	// LLM ゲートウェイの稼働状況（流量制限の順番待ちなど）
+	r.GET("/admin/llm/stats", llmAdminCtrl.GetStats)
+	r.GET("/admin/llm/breakers", llmAdminCtrl.GetBreakers)
 
 	logger.Info("Router initialized")
 	return r
 }
+
+// llmCacheBypass: ?nocache=true または Cache-Control: no-cache が付いたリクエストでは
+// LLM の応答キャッシュを読まずに問い合わせる
+func llmCacheBypass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("nocache") == "true" ||
+			strings.Contains(c.GetHeader("Cache-Control"), "no-cache") {
+			c.Request = c.Request.WithContext(
+				entity.ContextWithLLMCacheBypass(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
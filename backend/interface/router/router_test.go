@@ -0,0 +1,49 @@
+package router_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rayfiyo/zousui/backend/interface/controller"
+	"github.com/rayfiyo/zousui/backend/interface/router"
+)
+
+// ルートのパス同士が衝突すると gin は登録時に panic するので、起動前に検出する
+func TestNewRouterRegistersRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// ハンドラは呼ばないので、中身の無いコントローラで足りる
+	r := router.NewRouter(
+		new(controller.CommunityController),
+		new(controller.DiplomacyController),
+		new(controller.SimulateController),
+		new(controller.ImageController),
+		new(controller.InterferenceController),
+		new(controller.SimulationController),
+		new(controller.WorldController),
+		new(controller.EventController),
+		new(controller.LLMAdminController),
+		new(controller.UsageController),
+	)
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, want := range []string{
+		http.MethodGet + " /communities/:id",
+		http.MethodPost + " /communities/:id/restore",
+		http.MethodPost + " /communities/:id/purge",
+		http.MethodPost + " /communities/:id/generateImage",
+		http.MethodGet + " /communities/:id/history",
+		http.MethodPost + " /simulate/:communityID",
+		http.MethodPost + " /simulate/diplomacy",
+		http.MethodGet + " /simulations/:id/transcript",
+		http.MethodGet + " /usage",
+	} {
+		if !registered[want] {
+			t.Errorf("route %q is not registered", want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
@@ -11,14 +13,17 @@ import (
 
 type CommunityUsecase struct {
 	communityRepo repository.CommunityRepository
+	uow           repository.UnitOfWork
 }
 
 func NewCommunityUsecase(
 	repo repository.CommunityRepository,
+	uow repository.UnitOfWork,
 ) *CommunityUsecase {
 	zap.L().Debug("Initializing CommunityUsecase")
 	return &CommunityUsecase{
 		communityRepo: repo,
+		uow:           uow,
 	}
 }
 
@@ -31,15 +36,29 @@ func (cu *CommunityUsecase) CreateCommunity(
 
 	logger.Debug("Creating community", zap.String("communityID", comm.ID))
 
-	// IDが重複していないか簡単にチェック
-	existing, _ := cu.communityRepo.GetByID(ctx, comm.ID)
-	if existing != nil {
-		logger.Warn("Community already exists", zap.String("communityID", comm.ID))
-		return fmt.Errorf("community ID %s already exists", comm.ID)
-	}
+	if err := cu.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		// IDが重複していないかチェック（ゴミ箱に入ったものも含む）
+		existing, err := repos.Communities.GetByIDIncludingDeleted(ctx, comm.ID)
+		switch {
+		case err == nil:
+			logger.Warn("Community already exists",
+				zap.String("communityID", comm.ID), zap.Bool("deleted", existing.IsDeleted()))
+			if existing.IsDeleted() {
+				return fmt.Errorf("community ID %s is in the trash (restore or purge it first): %w",
+					comm.ID, repository.ErrCommunityExists)
+			}
+			return fmt.Errorf("community ID %s: %w", comm.ID, repository.ErrCommunityExists)
+		case !errors.Is(err, repository.ErrCommunityNotFound):
+			return fmt.Errorf("failed to check community ID: %w", err)
+		}
 
-	// Save
-	if err := cu.communityRepo.Save(ctx, comm); err != nil {
+		// Save
+		if err := repos.Communities.Save(ctx, comm); err != nil {
+			return err
+		}
+		return appendEvent(ctx, repos.Events, entity.EventCommunityCreated,
+			comm.ID, "", entity.CommunityCreatedPayload{Community: *comm})
+	}); err != nil {
 		logger.Error("Failed to save community",
 			zap.String("communityID", comm.ID), zap.Error(err))
 		return err
@@ -58,23 +77,142 @@ func (cu *CommunityUsecase) GetCommunityByID(
 	return cu.communityRepo.GetByID(ctx, id)
 }
 
-// コミュニティを更新
+// コミュニティをゴミ箱に入れる（関連データは残し、RestoreCommunity で戻せる）
 func (cu *CommunityUsecase) DeleteCommunity(ctx context.Context, id string) error {
 	logger := zap.L()
 	logger.Debug("Deleting community", zap.String("communityID", id))
-	err := cu.communityRepo.Delete(ctx, id)
+	err := cu.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		comm, err := repos.Communities.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		comm.MarkDeleted(time.Now())
+		if err := repos.Communities.Save(ctx, comm); err != nil {
+			return err
+		}
+		return appendEvent(ctx, repos.Events, entity.EventCommunityDeleted,
+			id, "", entity.CommunityDeletedPayload{
+				DeletedAt: *comm.DeletedAt,
+				Version:   comm.Version,
+			})
+	})
 	if err != nil {
 		logger.Error("Failed to delete community", zap.String("communityID", id), zap.Error(err))
-	} else {
-		logger.Info("Community deleted", zap.String("communityID", id))
+		return err
 	}
-	return err
+	logger.Info("Community moved to trash", zap.String("communityID", id))
+	return nil
 }
 
-// 全コミュニティを取得
+// ゴミ箱からコミュニティを戻す
+func (cu *CommunityUsecase) RestoreCommunity(
+	ctx context.Context,
+	id string,
+) (*entity.Community, error) {
+	logger := zap.L()
+	logger.Debug("Restoring community", zap.String("communityID", id))
+	var restored *entity.Community
+	err := cu.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		comm, err := repos.Communities.GetByIDIncludingDeleted(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !comm.IsDeleted() {
+			return fmt.Errorf("community %s: %w", id, repository.ErrCommunityNotInTrash)
+		}
+		comm.Restore(time.Now())
+		if err := repos.Communities.Save(ctx, comm); err != nil {
+			return err
+		}
+		restored = comm
+		return appendEvent(ctx, repos.Events, entity.EventCommunityRestored,
+			id, "", entity.CommunityRestoredPayload{Version: comm.Version})
+	})
+	if err != nil {
+		logger.Error("Failed to restore community", zap.String("communityID", id), zap.Error(err))
+		return nil, err
+	}
+	logger.Info("Community restored", zap.String("communityID", id))
+	return restored, nil
+}
+
+// ゴミ箱のコミュニティを完全に削除する
+// エージェントと文化の改訂履歴も削除し、シミュレーション履歴からは関連コミュニティとして外す
+// 関連コミュニティがなくなって削除したシミュレーションの LLM とのやり取りの記録も削除する
+func (cu *CommunityUsecase) PurgeCommunity(ctx context.Context, id string) error {
+	logger := zap.L()
+	logger.Debug("Purging community", zap.String("communityID", id))
+	err := cu.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		comm, err := repos.Communities.GetByIDIncludingDeleted(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !comm.IsDeleted() {
+			return fmt.Errorf("community %s must be deleted before purging: %w",
+				id, repository.ErrCommunityNotInTrash)
+		}
+		if err := repos.Agents.DeleteByCommunity(ctx, id); err != nil {
+			return err
+		}
+		if err := repos.Revisions.DeleteByCommunity(ctx, id); err != nil {
+			return err
+		}
+		removed, err := repos.Simulations.RemoveCommunity(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := repos.Transcripts.DeleteBySimulations(ctx, removed); err != nil {
+			return err
+		}
+		if err := repos.Communities.Delete(ctx, id); err != nil {
+			return err
+		}
+		return appendEvent(ctx, repos.Events, entity.EventCommunityPurged,
+			id, "", entity.CommunityPurgedPayload{})
+	})
+	if err != nil {
+		logger.Error("Failed to purge community", zap.String("communityID", id), zap.Error(err))
+		return err
+	}
+	logger.Info("Community purged", zap.String("communityID", id))
+	return nil
+}
+
+// コミュニティにエージェントを追加
+func (cu *CommunityUsecase) AddAgent(
+	ctx context.Context,
+	agent *entity.Agent,
+) error {
+	logger := zap.L()
+
+	logger.Debug("Adding agent", zap.String("agentID", agent.ID),
+		zap.String("communityID", agent.CommunityID))
+	if err := cu.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if _, err := repos.Communities.GetByID(ctx, agent.CommunityID); err != nil {
+			return err
+		}
+		if err := repos.Agents.Save(ctx, agent); err != nil {
+			return err
+		}
+		return appendEvent(ctx, repos.Events, entity.EventAgentAdded,
+			agent.CommunityID, "", entity.AgentAddedPayload{Agent: *agent})
+	}); err != nil {
+		logger.Error("Failed to save agent",
+			zap.String("agentID", agent.ID), zap.Error(err))
+		return err
+	}
+	logger.Info("Agent added", zap.String("agentID", agent.ID))
+	return nil
+}
+
+// 全コミュニティを取得（includeDeleted ならゴミ箱に入ったものも含める）
 func (cu *CommunityUsecase) GetAllCommunities(
 	ctx context.Context,
+	includeDeleted bool,
 ) ([]*entity.Community, error) {
-	zap.L().Debug("Getting all communities")
+	zap.L().Debug("Getting all communities", zap.Bool("includeDeleted", includeDeleted))
+	if includeDeleted {
+		return cu.communityRepo.GetAllIncludingDeleted(ctx)
+	}
 	return cu.communityRepo.GetAll(ctx)
 }
@@ -0,0 +1,137 @@
+package usecase_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/usecase"
+)
+
+// 完全削除すると、そのコミュニティだけのシミュレーション履歴とやり取りの記録を削除し、
+// 他のコミュニティも関わる履歴からはそのコミュニティの変化を外す
+func TestPurgeCommunityCleansSimulationHistory(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			river := &entity.Community{
+				ID: "river", Name: "川の民", Population: 100, Culture: "漁業",
+			}
+			mountain := &entity.Community{
+				ID: "mountain", Name: "山の民", Population: 80, Culture: "狩猟",
+			}
+			for _, c := range []*entity.Community{river, mountain} {
+				if err := s.communities.Save(ctx, c); err != nil {
+					t.Fatalf("failed to save community: %v", err)
+				}
+			}
+
+			solo, err := entity.NewSimulationResult("solo", entity.SimulationTypeCultureEvolution,
+				map[string]string{}, "", entity.NewCommunityChange(*river, river))
+			if err != nil {
+				t.Fatalf("failed to create simulation: %v", err)
+			}
+			shared, err := entity.NewSimulationResult("shared", entity.SimulationTypeDiplomacy,
+				map[string]string{}, "", entity.NewCommunityChange(*river, river),
+				entity.NewCommunityChange(*mountain, mountain))
+			if err != nil {
+				t.Fatalf("failed to create simulation: %v", err)
+			}
+			if err := s.uow.Do(ctx, func(ctx context.Context, repos domainrepo.TxRepositories) error {
+				for _, sim := range []*entity.SimulationResult{solo, shared} {
+					if err := repos.Simulations.Save(ctx, sim); err != nil {
+						return err
+					}
+					if err := repos.Transcripts.Save(ctx,
+						&entity.Transcript{SimulationID: sim.ID}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to save simulations: %v", err)
+			}
+
+			uc := usecase.NewCommunityUsecase(s.communities, s.uow)
+			if err := uc.DeleteCommunity(ctx, "river"); err != nil {
+				t.Fatalf("failed to delete community: %v", err)
+			}
+			if err := uc.PurgeCommunity(ctx, "river"); err != nil {
+				t.Fatalf("failed to purge community: %v", err)
+			}
+
+			_, err = s.simulations.GetByID(ctx, "solo")
+			if !errors.Is(err, domainrepo.ErrSimulationNotFound) {
+				t.Errorf("solo simulation: error = %v, want %v",
+					err, domainrepo.ErrSimulationNotFound)
+			}
+			_, err = s.transcripts.GetBySimulation(ctx, "solo")
+			if !errors.Is(err, domainrepo.ErrTranscriptNotFound) {
+				t.Errorf("solo transcript: error = %v, want %v",
+					err, domainrepo.ErrTranscriptNotFound)
+			}
+
+			got, err := s.simulations.GetByID(ctx, "shared")
+			if err != nil {
+				t.Fatalf("failed to get shared simulation: %v", err)
+			}
+			if !slices.Equal(got.Communities, []string{"mountain"}) {
+				t.Errorf("communities = %v, want [mountain]", got.Communities)
+			}
+			var record entity.SimulationRecord
+			if err := json.Unmarshal([]byte(got.ResultJSON), &record); err != nil {
+				t.Fatalf("failed to decode simulation result: %v", err)
+			}
+			if len(record.Changes) != 1 || record.Changes[0].CommunityID != "mountain" {
+				t.Errorf("changes = %+v, want only mountain", record.Changes)
+			}
+			if _, err := s.transcripts.GetBySimulation(ctx, "shared"); err != nil {
+				t.Errorf("shared transcript: %v", err)
+			}
+		})
+	}
+}
+
+// 同じ ID のコミュニティは、ゴミ箱に入っていても完全に削除するまで作れない
+func TestCreateCommunityRejectsDuplicateID(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			uc := usecase.NewCommunityUsecase(s.communities, s.uow)
+			newRiver := func() *entity.Community {
+				return &entity.Community{
+					ID: "river", Name: "川の民", Population: 100, Culture: "漁業",
+				}
+			}
+
+			if err := uc.CreateCommunity(ctx, newRiver()); err != nil {
+				t.Fatalf("failed to create community: %v", err)
+			}
+			if err := uc.CreateCommunity(ctx, newRiver()); !errors.Is(err,
+				domainrepo.ErrCommunityExists) {
+				t.Errorf("duplicate: error = %v, want %v", err, domainrepo.ErrCommunityExists)
+			}
+
+			if err := uc.DeleteCommunity(ctx, "river"); err != nil {
+				t.Fatalf("failed to delete community: %v", err)
+			}
+			if err := uc.CreateCommunity(ctx, newRiver()); !errors.Is(err,
+				domainrepo.ErrCommunityExists) {
+				t.Errorf("in trash: error = %v, want %v", err, domainrepo.ErrCommunityExists)
+			}
+
+			if err := uc.PurgeCommunity(ctx, "river"); err != nil {
+				t.Fatalf("failed to purge community: %v", err)
+			}
+			if err := uc.CreateCommunity(ctx, newRiver()); err != nil {
+				t.Errorf("after purge: %v", err)
+			}
+		})
+	}
+}
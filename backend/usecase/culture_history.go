@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type CultureHistoryUsecase struct {
+	communityRepo repository.CommunityRepository
+	revisionRepo  repository.CultureRevisionRepository
+}
+
+func NewCultureHistoryUsecase(
+	cr repository.CommunityRepository,
+	rr repository.CultureRevisionRepository,
+) *CultureHistoryUsecase {
+	zap.L().Debug("Initializing CultureHistoryUsecase")
+	return &CultureHistoryUsecase{
+		communityRepo: cr,
+		revisionRepo:  rr,
+	}
+}
+
+// コミュニティの文化の改訂履歴を古い順に取得
+func (uc *CultureHistoryUsecase) GetHistory(
+	ctx context.Context,
+	communityID string,
+) ([]*entity.CultureRevision, error) {
+	zap.L().Debug("Fetching culture history", zap.String("communityID", communityID))
+	if _, err := uc.communityRepo.GetByID(ctx, communityID); err != nil {
+		return nil, err
+	}
+	return uc.revisionRepo.GetByCommunity(ctx, communityID)
+}
+
+// 改訂番号を指定して文化の改訂を取得
+func (uc *CultureHistoryUsecase) GetRevision(
+	ctx context.Context,
+	communityID string,
+	revision int,
+) (*entity.CultureRevision, error) {
+	zap.L().Debug("Fetching culture revision",
+		zap.String("communityID", communityID), zap.Int("revision", revision))
+	if _, err := uc.communityRepo.GetByID(ctx, communityID); err != nil {
+		return nil, err
+	}
+	return uc.revisionRepo.GetByRevision(ctx, communityID, revision)
+}
+
+// 変更前後の差分があれば文化の改訂として記録する
+func appendCultureRevision(
+	ctx context.Context,
+	repo repository.CultureRevisionRepository,
+	before entity.Community,
+	after *entity.Community,
+	simulationID, simulationType string,
+) error {
+	rev := entity.NewCultureRevision(before, after, simulationID, simulationType)
+	if rev == nil {
+		return nil
+	}
+	if err := repo.Append(ctx, rev); err != nil {
+		zap.L().Error("Failed to append culture revision",
+			zap.String("communityID", after.ID), zap.Error(err))
+		return fmt.Errorf("failed to append culture revision: %w", err)
+	}
+	return nil
+}
+
+// 変更後のコミュニティを保存し、差分を文化の改訂とドメインイベントとして記録する
+func saveCommunityChange(
+	ctx context.Context,
+	repos repository.TxRepositories,
+	before entity.Community,
+	after *entity.Community,
+	simulationID, simulationType string,
+) error {
+	// 文化も人口も変わっていなければ保存しない（版も進めない）
+	if before.Culture == after.Culture && before.Population == after.Population {
+		zap.L().Debug("Community unchanged, skipping save",
+			zap.String("communityID", after.ID))
+		return nil
+	}
+	if err := repos.Communities.Save(ctx, after); err != nil {
+		zap.L().Error("Failed to save community",
+			zap.String("communityID", after.ID), zap.Error(err))
+		return fmt.Errorf("failed to save community %s: %w", after.ID, err)
+	}
+	if err := appendCultureRevision(ctx, repos.Revisions, before, after,
+		simulationID, simulationType); err != nil {
+		return err
+	}
+	events, err := entity.CommunityChangeEvents(before, after, simulationID, simulationType)
+	if err != nil {
+		return err
+	}
+	return appendEvents(ctx, repos.Events, events...)
+}
+
+// シミュレーション結果と LLM とのやり取りの記録を保存し、SimulationRecorded イベントを記録する
+func recordSimulation(
+	ctx context.Context,
+	repos repository.TxRepositories,
+	simResult *entity.SimulationResult,
+	rec *entity.TranscriptRecorder,
+) error {
+	if err := repos.Simulations.Save(ctx, simResult); err != nil {
+		zap.L().Error("Failed to save simulation result",
+			zap.String("simulationID", simResult.ID), zap.Error(err))
+		return fmt.Errorf("failed to save simulation result: %w", err)
+	}
+	if err := repos.Transcripts.Save(ctx, rec.Transcript(simResult.ID)); err != nil {
+		zap.L().Error("Failed to save transcript",
+			zap.String("simulationID", simResult.ID), zap.Error(err))
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+	return appendEvent(ctx, repos.Events, entity.EventSimulationRecorded,
+		"", simResult.ID, entity.SimulationRecordedPayload{Simulation: *simResult})
+}
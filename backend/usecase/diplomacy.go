@@ -2,31 +2,42 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
+	"github.com/google/uuid"
+	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
 	"go.uber.org/zap"
 )
 
 type DiplomacyUsecase struct {
 	communityRepo repository.CommunityRepository
+	uow           repository.UnitOfWork
 	llmGateway    repository.LLMGateway
+	usageUC       *LLMUsageUsecase
 }
 
 func NewDiplomacyUsecase(
 	cr repository.CommunityRepository,
+	uow repository.UnitOfWork,
 	lg repository.LLMGateway,
+	uu *LLMUsageUsecase,
 ) *DiplomacyUsecase {
 	zap.L().Debug("Initializing DiplomacyUsecase")
-	return &DiplomacyUsecase{communityRepo: cr, llmGateway: lg}
+	return &DiplomacyUsecase{
+		communityRepo: cr,
+		uow:           uow,
+		llmGateway:    lg,
+		usageUC:       uu,
+	}
 }
 
-// 2つのコミュニティ間の外交交渉を実行する
+// 2つのコミュニティ間の外交交渉を実行し、保存したシミュレーション結果を返す
 func (du *DiplomacyUsecase) ExecuteDiplomacy(
 	ctx context.Context,
 	commAID, commBID string,
-) error {
+) (*entity.SimulationResult, error) {
 	logger := zap.L()
 
 	// コミュニティを取得
@@ -34,11 +45,11 @@ func (du *DiplomacyUsecase) ExecuteDiplomacy(
 		zap.String("commA", commAID), zap.String("commB", commBID))
 	commA, err := du.communityRepo.GetByID(ctx, commAID)
 	if err != nil {
-		return fmt.Errorf("failed to get community A: %w", err)
+		return nil, fmt.Errorf("failed to get community A: %w", err)
 	}
 	commB, err := du.communityRepo.GetByID(ctx, commBID)
 	if err != nil {
-		return fmt.Errorf("failed to get community B: %w", err)
+		return nil, fmt.Errorf("failed to get community B: %w", err)
 	}
 
 	// LLMに外交交渉をリクエスト
@@ -55,28 +66,34 @@ func (du *DiplomacyUsecase) ExecuteDiplomacy(
 		commA.Name, commA.Population, commA.Culture,
 		commB.Name, commB.Population, commB.Culture)
 
-	// LLMにリクエスト
-	logger.Debug("Diplomacy prompt", zap.String("prompt", prompt))
-	llmResp, err := du.llmGateway.GenerateCultureUpdate(ctx, prompt, "")
-	if err != nil {
-		logger.Error("LLM generation failed", zap.Error(err))
-		return err
+	// LLMにリクエスト（予算を使い切っていれば問い合わせない）
+	if err := du.usageUC.CheckBudget(ctx); err != nil {
+		return nil, err
 	}
-
-	// JSONパース
-	logger.Debug("LLM response received", zap.String("response", llmResp))
+	logger.Debug("Diplomacy prompt", zap.String("prompt", prompt))
+	simID := uuid.New().String()
+	rec := entity.NewTranscriptRecorder()
+	defer du.usageUC.Record(ctx, rec, simID, entity.SimulationTypeDiplomacy, commAID, commBID)
+	llmCtx := entity.ContextWithTranscriptRecorder(ctx, rec)
 	var result struct {
 		Outcome     string `json:"outcome"`
 		Description string `json:"description"`
 		PopChangeA  int    `json:"popChangeA"`
 		PopChangeB  int    `json:"popChangeB"`
 	}
-	if err := json.Unmarshal([]byte(llmResp), &result); err != nil {
-		logger.Error("JSON unmarshal failed", zap.Error(err))
-		return fmt.Errorf("invalid JSON from LLM: %w", err)
+	// 外交の結果が問い合わせごとにぶれないよう、温度を低くする
+	llmResp, err := generateJSON(llmCtx, du.llmGateway,
+		simulationRequest(entity.SimulationTypeDiplomacy, prompt, "",
+			consts.DiplomacyTemperature, commAID, commBID),
+		entity.DiplomacyOutcomeSchema, &result)
+	if err != nil {
+		logger.Error("LLM generation failed", zap.Error(err))
+		return nil, err
 	}
+	logger.Debug("LLM response received", zap.String("response", llmResp))
 
 	// 人口更新
+	beforeA, beforeB := *commA, *commB
 	commA.Population += result.PopChangeA
 	if commA.Population < 0 {
 		commA.Population = 0
@@ -105,18 +122,43 @@ func (du *DiplomacyUsecase) ExecuteDiplomacy(
 		commB.UpdateCulture(fmt.Sprint(result.Description))
 	}
 
-	// 保存
-	if err := du.communityRepo.Save(ctx, commA); err != nil {
-		logger.Error("Failed to save community A",
-			zap.String("commA", commAID), zap.Error(err))
-		return err
+	simResult, err := entity.NewSimulationResult(simID,
+		entity.SimulationTypeDiplomacy, result, "",
+		entity.NewCommunityChange(beforeA, commA),
+		entity.NewCommunityChange(beforeB, commB))
+	if err != nil {
+		return nil, err
 	}
-	if err := du.communityRepo.Save(ctx, commB); err != nil {
-		logger.Error("Failed to save community B",
-			zap.String("commB", commBID), zap.Error(err))
-		return err
+
+	// 両コミュニティ・文化の改訂履歴・シミュレーション履歴・イベントをまとめて保存
+	// どれか1つでも失敗した場合は何も反映しない
+	if err := du.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if err := appendEvent(ctx, repos.Events, entity.EventDiplomacyConcluded,
+			commAID, simResult.ID, entity.DiplomacyConcludedPayload{
+				CommunityA:  commAID,
+				CommunityB:  commBID,
+				Outcome:     result.Outcome,
+				Description: result.Description,
+				PopChangeA:  result.PopChangeA,
+				PopChangeB:  result.PopChangeB,
+			}); err != nil {
+			return err
+		}
+		if err := saveCommunityChange(ctx, repos, beforeA, commA,
+			simResult.ID, simResult.Type); err != nil {
+			return err
+		}
+		if err := saveCommunityChange(ctx, repos, beforeB, commB,
+			simResult.ID, simResult.Type); err != nil {
+			return err
+		}
+		return recordSimulation(ctx, repos, simResult, rec)
+	}); err != nil {
+		logger.Error("Failed to save diplomacy result",
+			zap.String("commA", commAID), zap.String("commB", commBID), zap.Error(err))
+		return nil, err
 	}
 	logger.Info("Diplomacy simulation executed successfully",
 		zap.String("commA", commAID), zap.String("commB", commBID))
-	return nil
+	return simResult, nil
 }
@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type EventLogUsecase struct {
+	eventStore repository.EventStore
+	worldRepo  repository.WorldRepository
+	uow        repository.UnitOfWork
+}
+
+func NewEventLogUsecase(
+	es repository.EventStore,
+	wr repository.WorldRepository,
+	uow repository.UnitOfWork,
+) *EventLogUsecase {
+	zap.L().Debug("Initializing EventLogUsecase")
+	return &EventLogUsecase{eventStore: es, worldRepo: wr, uow: uow}
+}
+
+// 範囲を指定してイベントを取得（監査用）
+func (uc *EventLogUsecase) ListEvents(
+	ctx context.Context,
+	afterSeq, untilSeq int64,
+) ([]*entity.DomainEvent, error) {
+	zap.L().Debug("Listing events",
+		zap.Int64("afterSeq", afterSeq), zap.Int64("untilSeq", untilSeq))
+	return uc.eventStore.List(ctx, afterSeq, untilSeq)
+}
+
+// untilSeq 時点のワールドをイベントログから組み立てる（リポジトリは変更しない）
+func (uc *EventLogUsecase) Replay(
+	ctx context.Context,
+	untilSeq int64,
+) (*entity.WorldSnapshot, error) {
+	logger := zap.L()
+
+	events, err := uc.eventStore.List(ctx, 0, untilSeq)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := ProjectEvents(events)
+	if err != nil {
+		logger.Error("Failed to project events", zap.Error(err))
+		return nil, fmt.Errorf("failed to project events: %w", err)
+	}
+	logger.Info("World replayed from events",
+		zap.Int64("untilSeq", untilSeq), zap.Int("events", len(events)))
+	return snapshot, nil
+}
+
+// イベントログからリポジトリの状態を作り直す
+// untilSeq を指定した場合はその時点まで巻き戻し、巻き戻したこと自体もログに残す
+func (uc *EventLogUsecase) Rebuild(
+	ctx context.Context,
+	untilSeq int64,
+) error {
+	logger := zap.L()
+
+	snapshot, err := uc.Replay(ctx, untilSeq)
+	if err != nil {
+		return err
+	}
+	if err := uc.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if err := repos.World.Import(ctx, snapshot, entity.WorldImportReplace); err != nil {
+			return err
+		}
+		if untilSeq == 0 {
+			return nil
+		}
+		return appendWorldImportedEvent(ctx, repos.Events, snapshot,
+			entity.WorldImportReplace)
+	}); err != nil {
+		logger.Error("Failed to rebuild world", zap.Error(err))
+		return err
+	}
+	logger.Info("World rebuilt from events", zap.Int64("untilSeq", untilSeq))
+	return nil
+}
+
+// イベントログが空で既存データがある場合、現在の状態を起点のイベントとして記録する
+// （イベントログ導入前から使っている永続ストア向け）
+func (uc *EventLogUsecase) EnsureBaseline(
+	ctx context.Context,
+) (bool, error) {
+	events, err := uc.eventStore.List(ctx, 0, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(events) > 0 {
+		return false, nil
+	}
+	snapshot, err := uc.worldRepo.Export(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(snapshot.Communities) == 0 && len(snapshot.Agents) == 0 &&
+		len(snapshot.Simulations) == 0 {
+		return false, nil
+	}
+	if err := appendWorldImportedEvent(ctx, uc.eventStore, snapshot,
+		entity.WorldImportReplace); err != nil {
+		return false, err
+	}
+	zap.L().Info("Baseline event recorded",
+		zap.Int("communities", len(snapshot.Communities)))
+	return true, nil
+}
+
+// イベントをまとめて追記する
+func appendEvents(
+	ctx context.Context,
+	store repository.EventStore,
+	events ...*entity.DomainEvent,
+) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := store.Append(ctx, events...); err != nil {
+		zap.L().Error("Failed to append events", zap.Error(err))
+		return fmt.Errorf("failed to append events: %w", err)
+	}
+	return nil
+}
+
+// 1件のイベントを作って追記する
+func appendEvent(
+	ctx context.Context,
+	store repository.EventStore,
+	eventType entity.DomainEventType,
+	aggregateID, simulationID string,
+	payload any,
+) error {
+	e, err := entity.NewDomainEvent(eventType, aggregateID, simulationID, payload)
+	if err != nil {
+		return err
+	}
+	return appendEvents(ctx, store, e)
+}
+
+// スナップショットの取り込みをイベントとして記録する
+func appendWorldImportedEvent(
+	ctx context.Context,
+	store repository.EventStore,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) error {
+	return appendEvent(ctx, store, entity.EventWorldImported, "", "",
+		entity.WorldImportedPayload{Mode: mode, Snapshot: *snapshot})
+}
@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+	"go.uber.org/zap"
+)
+
+// simulationRequest: シミュレーション共通の system メッセージと、シミュレーションごとの温度で問い合わせる
+func simulationRequest(
+	simulationType, prompt, userInput string,
+	temperature float64,
+	communityIDs ...string,
+) *entity.LLMRequest {
+	return &entity.LLMRequest{
+		Messages: []entity.LLMMessage{
+			{Role: entity.LLMRoleSystem, Content: consts.SimulationSystemPrompt},
+			{Role: entity.LLMRoleUser, Content: prompt},
+		},
+		UserInput:      userInput,
+		Sampling:       entity.NewLLMSampling(temperature),
+		SimulationType: simulationType,
+		CommunityIDs:   communityIDs,
+	}
+}
+
+// generateJSON: LLM に問い合わせ、応答から schema に合う JSON を取り出して out に読み込む
+func generateJSON(
+	ctx context.Context,
+	gw repository.LLMGateway,
+	req *entity.LLMRequest,
+	schema *entity.ResponseSchema,
+	out any,
+) (string, error) {
+	raw, _, err := generateStructured(ctx, gw, req, schema)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(raw), out); err != nil {
+		return "", &repository.LLMOutputError{Schema: schema.Name, Response: raw,
+			Attempts: 1, Err: err}
+	}
+	return raw, nil
+}
+
+// generateStructured: LLM に問い合わせ、応答から schemas のいずれかに合う JSON を取り出す
+// どれにも合わなければ、前回の応答と理由を会話に加えて consts.MaxLLMRepairAttempts 回まで問い直す
+// schemas の先頭が本来の形式で、以降は互換のために受け付ける形式
+// 戻り値は取り出した JSON と、合った形式の schemas 内の位置
+func generateStructured(
+	ctx context.Context,
+	gw repository.LLMGateway,
+	req *entity.LLMRequest,
+	schemas ...*entity.ResponseSchema,
+) (string, int, error) {
+	logger := zap.L()
+
+	// 形式を指定できるゲートウェイには本来の形式で出力させる
+	req = req.Clone()
+	req.Schema = schemas[0]
+	ask, askCtx := req, ctx
+	var (
+		resp     string
+		parseErr error
+	)
+	for attempt := 1; attempt <= consts.MaxLLMRepairAttempts+1; attempt++ {
+		var err error
+		resp, err = gw.Generate(askCtx, ask)
+		if err != nil {
+			return "", 0, err
+		}
+
+		raw, idx, err := matchSchemas(resp, schemas)
+		if err == nil {
+			return raw, idx, nil
+		}
+		parseErr = err
+		logger.Warn("LLM response does not match schema",
+			zap.String("schema", schemas[0].Name), zap.Int("attempt", attempt),
+			zap.String("response", resp), zap.Error(err))
+
+		// 前回の応答と理由を会話に加えて問い直す
+		ask = req.Clone()
+		ask.Messages = append(ask.Messages,
+			entity.LLMMessage{Role: entity.LLMRoleAssistant, Content: resp},
+			entity.LLMMessage{Role: entity.LLMRoleUser,
+				Content: consts.RepairPromptHeader + "\n理由: " + err.Error()})
+		askCtx = entity.ContextWithLLMStage(ctx, entity.LLMStageRepair)
+	}
+	return "", 0, &repository.LLMOutputError{
+		Schema:   schemas[0].Name,
+		Response: resp,
+		Attempts: consts.MaxLLMRepairAttempts + 1,
+		Err:      parseErr,
+	}
+}
+
+// matchSchemas: 応答から JSON を取り出し、最初に合った形式の位置を返す
+// どれにも合わなければ本来の形式（先頭）に合わない理由を返す
+func matchSchemas(resp string, schemas []*entity.ResponseSchema) (string, int, error) {
+	raw, err := entity.ExtractJSONObject(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	var firstErr error
+	for i, schema := range schemas {
+		err := schema.Validate([]byte(raw))
+		if err == nil {
+			return raw, i, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", 0, firstErr
+}
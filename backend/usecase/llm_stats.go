@@ -0,0 +1,39 @@
+package usecase
+
+import (
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// LLM ゲートウェイの稼働状況を集める（管理用）
+type LLMStatsUsecase struct {
+	limiters []repository.LLMStatsReporter
+	breakers []repository.LLMBreakerReporter
+}
+
+func NewLLMStatsUsecase(
+	limiters []repository.LLMStatsReporter,
+	breakers []repository.LLMBreakerReporter,
+) *LLMStatsUsecase {
+	zap.L().Debug("Initializing LLMStatsUsecase")
+	return &LLMStatsUsecase{limiters: limiters, breakers: breakers}
+}
+
+// 提供元ごとの流量制限の状況
+func (uc *LLMStatsUsecase) GetLimiterStats() []entity.LLMLimiterStats {
+	stats := make([]entity.LLMLimiterStats, 0, len(uc.limiters))
+	for _, l := range uc.limiters {
+		stats = append(stats, l.LimiterStats())
+	}
+	return stats
+}
+
+// 提供元ごとのサーキットブレーカーの状況
+func (uc *LLMStatsUsecase) GetBreakerStats() []entity.LLMBreakerStats {
+	stats := make([]entity.LLMBreakerStats, 0, len(uc.breakers))
+	for _, b := range uc.breakers {
+		stats = append(stats, b.BreakerStats())
+	}
+	return stats
+}
@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+// LLM の利用量（トークン数・費用）の記録・集計と、予算による利用の制限
+type LLMUsageUsecase struct {
+	usageRepo repository.LLMUsageRepository
+	budget    entity.LLMBudget
+}
+
+func NewLLMUsageUsecase(
+	ur repository.LLMUsageRepository,
+	budget entity.LLMBudget,
+) *LLMUsageUsecase {
+	zap.L().Debug("Initializing LLMUsageUsecase")
+	return &LLMUsageUsecase{
+		usageRepo: ur,
+		budget:    budget,
+	}
+}
+
+// CheckBudget: 今の期間の予算を使い切っていれば repository.ErrLLMBudgetExceeded を返す
+// LLM に問い合わせるシミュレーションを始める前に呼ぶ
+func (uc *LLMUsageUsecase) CheckBudget(ctx context.Context) error {
+	if !uc.budget.Enabled() {
+		return nil
+	}
+	status, err := uc.budgetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Exceeded {
+		zap.L().Warn("LLM budget exceeded",
+			zap.Float64("spentUSD", status.Spent.CostUSD),
+			zap.Int("spentTokens", status.Spent.TotalTokens),
+			zap.Float64("budgetUSD", uc.budget.CostUSD),
+			zap.Int("budgetTokens", uc.budget.Tokens),
+			zap.String("period", uc.budget.Period))
+		return fmt.Errorf("%w: spent $%.4f and %d tokens (budget $%.4f, %d tokens per %s)",
+			repository.ErrLLMBudgetExceeded, status.Spent.CostUSD, status.Spent.TotalTokens,
+			uc.budget.CostUSD, uc.budget.Tokens, uc.budget.Period)
+	}
+	return nil
+}
+
+// 今の期間に使った量
+func (uc *LLMUsageUsecase) budgetStatus(ctx context.Context) (*entity.LLMBudgetStatus, error) {
+	status := &entity.LLMBudgetStatus{LLMBudget: uc.budget}
+	since := uc.budget.PeriodStart(time.Now())
+	if !since.IsZero() {
+		status.Since = &since
+	}
+	records, err := uc.usageRepo.Find(ctx, repository.LLMUsageQuery{From: since})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get llm usage: %w", err)
+	}
+	for _, r := range records {
+		status.Spent.Add(r.Usage)
+	}
+	status.Exceeded = uc.budget.Exceeded(status.Spent)
+	return status, nil
+}
+
+// Record: シミュレーションで行った問い合わせの利用量を記録する
+// シミュレーションが失敗した場合も呼び、問い合わせた分を予算に数える
+func (uc *LLMUsageUsecase) Record(
+	ctx context.Context,
+	rec *entity.TranscriptRecorder,
+	simulationID, simulationType string,
+	communities ...string,
+) {
+	transcript := rec.Transcript(simulationID)
+	if len(transcript.Exchanges) == 0 {
+		return
+	}
+	record := entity.NewLLMUsageRecord("", transcript, simulationType, communities...)
+	// 呼び出し元のリクエストが取り消されていても記録は残す
+	if err := uc.usageRepo.Save(context.WithoutCancel(ctx), record); err != nil {
+		zap.L().Error("Failed to save llm usage",
+			zap.String("simulationID", simulationID), zap.Error(err))
+		return
+	}
+	zap.L().Info("LLM usage recorded",
+		zap.String("simulationID", simulationID),
+		zap.Int("calls", record.Usage.Calls),
+		zap.Int("totalTokens", record.Usage.TotalTokens),
+		zap.Float64("costUSD", record.Usage.CostUSD))
+}
+
+// GetUsage: 条件に合う利用量を日・コミュニティ・モデルごとに集計する
+// 予算を設定していれば、今の期間に使った量も返す
+func (uc *LLMUsageUsecase) GetUsage(
+	ctx context.Context,
+	query repository.LLMUsageQuery,
+) (*entity.LLMUsageReport, error) {
+	zap.L().Debug("Aggregating llm usage",
+		zap.String("communityID", query.CommunityID),
+		zap.Time("from", query.From), zap.Time("to", query.To))
+	records, err := uc.usageRepo.Find(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get llm usage: %w", err)
+	}
+	report := entity.NewLLMUsageReport(records)
+	if uc.budget.Enabled() {
+		if report.Budget, err = uc.budgetStatus(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// GetSimulationUsage: シミュレーション1回分の利用量
+// 履歴に残らなかった（失敗した・完全削除で消えた）シミュレーションの分も返す
+// 記録が無ければ repository.ErrLLMUsageNotFound を返す
+func (uc *LLMUsageUsecase) GetSimulationUsage(
+	ctx context.Context,
+	simulationID string,
+) (*entity.LLMUsageReport, error) {
+	zap.L().Debug("Fetching simulation llm usage", zap.String("simulationID", simulationID))
+	records, err := uc.usageRepo.Find(ctx,
+		repository.LLMUsageQuery{SimulationID: simulationID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get llm usage: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: simulation %s", repository.ErrLLMUsageNotFound, simulationID)
+	}
+	return entity.NewLLMUsageReport(records), nil
+}
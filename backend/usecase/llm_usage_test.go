@@ -0,0 +1,54 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/usecase"
+)
+
+// 履歴に残らなかった失敗したシミュレーションでも、問い合わせた分の利用量を返す
+// 利用量の記録が無いシミュレーションだけ ErrLLMUsageNotFound にする
+func TestGetSimulationUsageOfFailedSimulation(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			uc := newCassetteSimulation(t, s)
+			if _, err := uc.Execute(ctx, "mountain"); !errors.Is(
+				err, domainrepo.ErrLLMRateLimited) {
+				t.Fatalf("error = %v, want %v", err, domainrepo.ErrLLMRateLimited)
+			}
+
+			records, err := s.usage.Find(ctx, domainrepo.LLMUsageQuery{CommunityID: "mountain"})
+			if err != nil {
+				t.Fatalf("failed to find usage: %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("usage records = %d, want 1 for the failed simulation", len(records))
+			}
+			simulationID := records[0].SimulationID
+			if _, err := s.simulations.GetByID(ctx, simulationID); !errors.Is(
+				err, domainrepo.ErrSimulationNotFound) {
+				t.Fatalf("failed simulation was saved: %v", err)
+			}
+
+			usageUC := usecase.NewLLMUsageUsecase(s.usage, entity.LLMBudget{})
+			report, err := usageUC.GetSimulationUsage(ctx, simulationID)
+			if err != nil {
+				t.Fatalf("failed to get simulation usage: %v", err)
+			}
+			if report.Total.Calls != records[0].Usage.Calls || report.Total.Calls == 0 {
+				t.Errorf("usage = %+v, want the recorded calls", report.Total)
+			}
+
+			if _, err := usageUC.GetSimulationUsage(ctx, "missing"); !errors.Is(
+				err, domainrepo.ErrLLMUsageNotFound) {
+				t.Errorf("error = %v, want %v", err, domainrepo.ErrLLMUsageNotFound)
+			}
+		})
+	}
+}
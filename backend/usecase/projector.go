@@ -0,0 +1,291 @@
+package usecase
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+)
+
+// イベントを順に適用してワールドの状態を組み立てる
+// 同じイベント列からは常に同じ状態が得られる（現在時刻などには依存しない）
+type worldProjection struct {
+	communities map[string]*entity.Community
+	agents      []*entity.Agent
+	simulations []*entity.SimulationResult
+	revisions   map[string][]*entity.CultureRevision
+}
+
+func newWorldProjection() *worldProjection {
+	return &worldProjection{
+		communities: make(map[string]*entity.Community),
+		agents:      make([]*entity.Agent, 0),
+		simulations: make([]*entity.SimulationResult, 0),
+		revisions:   make(map[string][]*entity.CultureRevision),
+	}
+}
+
+// ProjectEvents: イベント列からワールドのスナップショットを組み立てる
+func ProjectEvents(events []*entity.DomainEvent) (*entity.WorldSnapshot, error) {
+	p := newWorldProjection()
+	for _, e := range events {
+		if err := p.apply(e); err != nil {
+			return nil, err
+		}
+	}
+	return p.snapshot(), nil
+}
+
+func (p *worldProjection) apply(e *entity.DomainEvent) error {
+	switch e.Type {
+	case entity.EventCommunityCreated:
+		var payload entity.CommunityCreatedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		c := payload.Community
+		p.communities[c.ID] = &c
+
+	case entity.EventCommunityDeleted:
+		var payload entity.CommunityDeletedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		c, err := p.community(e)
+		if err != nil {
+			return err
+		}
+		c.MarkDeleted(payload.DeletedAt)
+		c.Version = payload.Version
+
+	case entity.EventCommunityRestored:
+		var payload entity.CommunityRestoredPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		c, err := p.community(e)
+		if err != nil {
+			return err
+		}
+		c.Restore(e.OccurredAt)
+		c.Version = payload.Version
+
+	case entity.EventCommunityPurged:
+		p.purge(e.AggregateID)
+
+	case entity.EventCultureChanged:
+		var payload entity.CultureChangedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		c, err := p.community(e)
+		if err != nil {
+			return err
+		}
+		rev := p.revisionFor(e, c, payload.SimulationType)
+		rev.NewCulture = payload.NewCulture
+		c.Culture = payload.NewCulture
+		c.Version = payload.Version
+		c.UpdatedAt = e.OccurredAt
+
+	case entity.EventPopulationChanged:
+		var payload entity.PopulationChangedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		c, err := p.community(e)
+		if err != nil {
+			return err
+		}
+		rev := p.revisionFor(e, c, payload.SimulationType)
+		rev.PopulationDelta = payload.NewPopulation - rev.PrevPopulation
+		c.Population = payload.NewPopulation
+		c.Version = payload.Version
+		c.UpdatedAt = e.OccurredAt
+
+	case entity.EventAgentAdded:
+		var payload entity.AgentAddedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		a := payload.Agent
+		p.agents = upsertProjectedAgent(p.agents, &a)
+
+	case entity.EventSimulationRecorded:
+		var payload entity.SimulationRecordedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		s := payload.Simulation
+		p.simulations = upsertProjectedSimulation(p.simulations, &s)
+
+	case entity.EventWorldImported:
+		var payload entity.WorldImportedPayload
+		if err := e.DecodePayload(&payload); err != nil {
+			return err
+		}
+		p.importSnapshot(&payload.Snapshot, payload.Mode)
+
+	case entity.EventDiplomacyConcluded, entity.EventInterferenceApplied:
+		// 結果の記録のみで、状態の変更は CultureChanged などが表す
+
+	default:
+		return fmt.Errorf("unknown event type %q (seq %d)", e.Type, e.Seq)
+	}
+	return nil
+}
+
+// イベントの対象コミュニティを返す
+func (p *worldProjection) community(e *entity.DomainEvent) (*entity.Community, error) {
+	c, ok := p.communities[e.AggregateID]
+	if !ok {
+		return nil, fmt.Errorf("%s for unknown community %s (seq %d)",
+			e.Type, e.AggregateID, e.Seq)
+	}
+	return c, nil
+}
+
+// 同じシミュレーションによる文化・人口の変更は1つの改訂にまとめる
+func (p *worldProjection) revisionFor(
+	e *entity.DomainEvent,
+	c *entity.Community,
+	simulationType string,
+) *entity.CultureRevision {
+	revs := p.revisions[c.ID]
+	if n := len(revs); n > 0 && e.SimulationID != "" &&
+		revs[n-1].SimulationID == e.SimulationID {
+		return revs[n-1]
+	}
+	rev := &entity.CultureRevision{
+		CommunityID:    c.ID,
+		Revision:       len(revs) + 1,
+		PrevCulture:    c.Culture,
+		NewCulture:     c.Culture,
+		PrevPopulation: c.Population,
+		SimulationID:   e.SimulationID,
+		SimulationType: simulationType,
+		CreatedAt:      e.OccurredAt,
+	}
+	p.revisions[c.ID] = append(revs, rev)
+	return rev
+}
+
+// コミュニティと、そのエージェント・改訂履歴を取り除き、結果の関連コミュニティから外す
+func (p *worldProjection) purge(communityID string) {
+	delete(p.communities, communityID)
+	delete(p.revisions, communityID)
+	agents := make([]*entity.Agent, 0, len(p.agents))
+	for _, a := range p.agents {
+		if a.CommunityID != communityID {
+			agents = append(agents, a)
+		}
+	}
+	p.agents = agents
+	simulations := make([]*entity.SimulationResult, 0, len(p.simulations))
+	for _, s := range p.simulations {
+		if !slices.Contains(s.Communities, communityID) {
+			simulations = append(simulations, s)
+			continue
+		}
+		remaining := make([]string, 0, len(s.Communities))
+		for _, id := range s.Communities {
+			if id != communityID {
+				remaining = append(remaining, id)
+			}
+		}
+		if len(remaining) == 0 {
+			continue
+		}
+		s.Communities = remaining
+		simulations = append(simulations, s)
+	}
+	p.simulations = simulations
+}
+
+// スナップショットを置き換え、またはマージする
+func (p *worldProjection) importSnapshot(
+	s *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) {
+	if mode == entity.WorldImportReplace {
+		*p = *newWorldProjection()
+	}
+	for _, c := range s.Communities {
+		cp := *c
+		p.communities[c.ID] = &cp
+	}
+	for _, a := range s.Agents {
+		cp := *a
+		p.agents = upsertProjectedAgent(p.agents, &cp)
+	}
+	for _, sim := range s.Simulations {
+		cp := *sim
+		p.simulations = upsertProjectedSimulation(p.simulations, &cp)
+	}
+	for _, r := range s.Revisions {
+		cp := *r
+		revs := p.revisions[r.CommunityID]
+		replaced := false
+		for i, existing := range revs {
+			if existing.Revision == r.Revision {
+				revs[i] = &cp
+				replaced = true
+			}
+		}
+		if !replaced {
+			revs = append(revs, &cp)
+		}
+		sort.Slice(revs, func(i, j int) bool { return revs[i].Revision < revs[j].Revision })
+		p.revisions[r.CommunityID] = revs
+	}
+}
+
+// 組み立てた状態をスナップショットにする
+func (p *worldProjection) snapshot() *entity.WorldSnapshot {
+	s := &entity.WorldSnapshot{
+		FormatVersion: entity.WorldSnapshotFormatVersion,
+		Communities:   make([]*entity.Community, 0, len(p.communities)),
+		Agents:        p.agents,
+		Simulations:   p.simulations,
+		Revisions:     make([]*entity.CultureRevision, 0),
+	}
+	for _, c := range p.communities {
+		s.Communities = append(s.Communities, c)
+	}
+	sort.Slice(s.Communities, func(i, j int) bool {
+		return s.Communities[i].ID < s.Communities[j].ID
+	})
+	ids := make([]string, 0, len(p.revisions))
+	for id := range p.revisions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s.Revisions = append(s.Revisions, p.revisions[id]...)
+	}
+	return s
+}
+
+func upsertProjectedAgent(agents []*entity.Agent, a *entity.Agent) []*entity.Agent {
+	for i, existing := range agents {
+		if existing.ID == a.ID {
+			agents[i] = a
+			return agents
+		}
+	}
+	return append(agents, a)
+}
+
+func upsertProjectedSimulation(
+	simulations []*entity.SimulationResult,
+	s *entity.SimulationResult,
+) []*entity.SimulationResult {
+	for i, existing := range simulations {
+		if existing.ID == s.ID {
+			simulations[i] = s
+			return simulations
+		}
+	}
+	return append(simulations, s)
+}
@@ -2,38 +2,46 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
 	"go.uber.org/zap"
 )
 
 type SimulateCultureEvolutionUsecase struct {
 	communityRepo repository.CommunityRepository
 	agentRepo     repository.AgentRepository
+	uow           repository.UnitOfWork
 	llmGateway    repository.LLMGateway
+	usageUC       *LLMUsageUsecase
 }
 
 func NewSimulateCultureEvolutionUsecase(
 	cr repository.CommunityRepository,
 	ar repository.AgentRepository,
+	uow repository.UnitOfWork,
 	lg repository.LLMGateway,
+	uu *LLMUsageUsecase,
 ) *SimulateCultureEvolutionUsecase {
 	zap.L().Debug("Initializing SimulateCultureEvolutionUsecase")
 	return &SimulateCultureEvolutionUsecase{
 		communityRepo: cr,
 		agentRepo:     ar,
+		uow:           uow,
 		llmGateway:    lg,
+		usageUC:       uu,
 	}
 }
 
 // コミュニティを指定して、エージェントとLLMを用いた文化進化シミュレーションを実行する
+// 保存したシミュレーション結果を返す
 func (uc *SimulateCultureEvolutionUsecase) Execute(
 	ctx context.Context,
 	communityID string,
-) error {
+) (*entity.SimulationResult, error) {
 	logger := zap.L()
 
 	// コミュニティを取得
@@ -43,7 +51,7 @@ func (uc *SimulateCultureEvolutionUsecase) Execute(
 	if err != nil {
 		logger.Error("Failed to get community",
 			zap.String("communityID", communityID), zap.Error(err))
-		return fmt.Errorf("failed to get community: %w", err)
+		return nil, fmt.Errorf("failed to get community: %w", err)
 	}
 
 	// コミュニティに所属するエージェントを取得
@@ -51,7 +59,7 @@ func (uc *SimulateCultureEvolutionUsecase) Execute(
 	if err != nil {
 		logger.Error("Failed to get agents",
 			zap.String("communityID", communityID), zap.Error(err))
-		return fmt.Errorf("failed to get agents: %w", err)
+		return nil, fmt.Errorf("failed to get agents: %w", err)
 	}
 
 	// シミュレーション用のプロンプトを作成
@@ -65,32 +73,53 @@ func (uc *SimulateCultureEvolutionUsecase) Execute(
 		)
 	}
 
-	// LLMに問い合わせ
+	// LLMに問い合わせ（予算を使い切っていれば問い合わせない）
+	if err := uc.usageUC.CheckBudget(ctx); err != nil {
+		return nil, err
+	}
 	logger.Debug("Simulation prompt", zap.String("prompt", prompt))
-	llmResp, err := uc.llmGateway.GenerateCultureUpdate(ctx, prompt, "")
+	simID := uuid.New().String()
+	rec := entity.NewTranscriptRecorder()
+	defer uc.usageUC.Record(ctx, rec, simID, entity.SimulationTypeCultureEvolution, communityID)
+	llmCtx := entity.ContextWithTranscriptRecorder(ctx, rec)
+	var result entity.CultureUpdateResponse
+	// 文化が思いがけない方向に変わるよう、温度を高くする
+	llmResp, err := generateJSON(llmCtx, uc.llmGateway,
+		simulationRequest(entity.SimulationTypeCultureEvolution, prompt, "",
+			consts.CultureEvolutionTemperature, communityID),
+		entity.CultureUpdateSchema, &result)
 	if err != nil {
 		logger.Error("LLM generation failed", zap.Error(err))
-		return fmt.Errorf("failed to generate culture update: %w", err)
+		return nil, fmt.Errorf("failed to generate culture update: %w", err)
 	}
-
-	// JSONパース
 	logger.Debug("LLM response", zap.String("response", llmResp))
-	var result entity.CultureUpdateResponse
-	if err := json.Unmarshal([]byte(llmResp), &result); err != nil {
-		logger.Error("JSON unmarshal failed", zap.Error(err))
-		return fmt.Errorf("invalid JSON from LLM (failed to parse LLM JSON): %w", err)
-	}
 
 	// ドメインモデルを使って更新
+	before := *comm
 	comm.UpdateCulture(result.NewCulture)
 	comm.Population += result.PopulationChange
-	if err := uc.communityRepo.Save(ctx, comm); err != nil {
+
+	simResult, err := entity.NewSimulationResult(simID,
+		entity.SimulationTypeCultureEvolution, result, "",
+		entity.NewCommunityChange(before, comm))
+	if err != nil {
+		return nil, err
+	}
+
+	// コミュニティ・文化の改訂履歴・シミュレーション履歴・イベントをまとめて保存
+	if err := uc.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if err := saveCommunityChange(ctx, repos, before, comm,
+			simResult.ID, simResult.Type); err != nil {
+			return err
+		}
+		return recordSimulation(ctx, repos, simResult, rec)
+	}); err != nil {
 		logger.Error("Failed to save community after simulation",
 			zap.String("communityID", communityID), zap.Error(err))
-		return fmt.Errorf("failed to save community: %w", err)
+		return nil, err
 	}
 	logger.Info("Culture evolution simulation executed successfully",
 		zap.String("communityID", communityID))
 
-	return nil
+	return simResult, nil
 }
@@ -5,27 +5,35 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
 	"go.uber.org/zap"
 )
 
 type SimulateInterferenceUsecase struct {
 	communityRepo repository.CommunityRepository
 	agentRepo     repository.AgentRepository
+	uow           repository.UnitOfWork
 	llmGateway    repository.LLMGateway
+	usageUC       *LLMUsageUsecase
 }
 
 func NewSimulateInterferenceUsecase(
 	cr repository.CommunityRepository,
 	ar repository.AgentRepository,
+	uow repository.UnitOfWork,
 	lg repository.LLMGateway,
+	uu *LLMUsageUsecase,
 ) *SimulateInterferenceUsecase {
 	zap.L().Debug("Initializing SimulateInterferenceUsecase")
 	return &SimulateInterferenceUsecase{
 		communityRepo: cr,
 		agentRepo:     ar,
+		uow:           uow,
 		llmGateway:    lg,
+		usageUC:       uu,
 	}
 }
 
@@ -71,30 +79,56 @@ func (uc *SimulateInterferenceUsecase) Execute(
     }`
 
 	// LLM呼び出し (MultiLLMGateway などが内部で複数LLMを利用)
+	if err := uc.usageUC.CheckBudget(ctx); err != nil {
+		return err
+	}
 	logger.Debug("Interference simulation prompt", zap.String("prompt", prompt))
-	llmResp, err := uc.llmGateway.GenerateCultureUpdate(ctx, prompt, "")
+	simID := uuid.New().String()
+	rec := entity.NewTranscriptRecorder()
+	defer uc.usageUC.Record(ctx, rec, simID, entity.SimulationTypeInterference, communityID)
+	llmCtx := entity.ContextWithTranscriptRecorder(ctx, rec)
+	var result entity.CultureUpdateResponse
+	llmResp, err := generateJSON(llmCtx, uc.llmGateway,
+		simulationRequest(entity.SimulationTypeInterference, prompt, "",
+			consts.InterferenceTemperature, communityID),
+		entity.CultureUpdateSchema, &result)
 	if err != nil {
 		return fmt.Errorf("failed to generate culture update: %w", err)
 	}
-
-	// JSONパース
 	logger.Debug("LLM interference response", zap.String("response", llmResp))
-	var result entity.CultureUpdateResponse
-	if err := json.Unmarshal([]byte(llmResp), &result); err != nil {
-		logger.Warn("JSON unmarshal failed, using raw response", zap.Error(err))
-		comm.UpdateCulture(comm.Culture + " | " + llmResp)
-	} else {
-		comm.UpdateCulture(result.NewCulture)
-		comm.Population += result.PopulationChange
-	}
+
+	before := *comm
+	comm.UpdateCulture(result.NewCulture)
+	comm.Population += result.PopulationChange
 
 	// 人口が0未満にならないように
 	if comm.Population < 0 {
 		comm.Population = 0
 	}
 
-	// DBへ保存
-	if err := uc.communityRepo.Save(ctx, comm); err != nil {
+	outcome := json.RawMessage(llmResp)
+	simResult, err := entity.NewSimulationResult(simID,
+		entity.SimulationTypeInterference, outcome, "",
+		entity.NewCommunityChange(before, comm))
+	if err != nil {
+		return err
+	}
+
+	// コミュニティ・文化の改訂履歴・シミュレーション履歴・イベントをまとめて保存
+	if err := uc.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if err := appendEvent(ctx, repos.Events, entity.EventInterferenceApplied,
+			communityID, simResult.ID, entity.InterferenceAppliedPayload{
+				Communities: simResult.Communities,
+				Result:      outcome,
+			}); err != nil {
+			return err
+		}
+		if err := saveCommunityChange(ctx, repos, before, comm,
+			simResult.ID, simResult.Type); err != nil {
+			return err
+		}
+		return recordSimulation(ctx, repos, simResult, rec)
+	}); err != nil {
 		logger.Error("Failed to save updated community",
 			zap.String("communityID", communityID), zap.Error(err))
 		return fmt.Errorf("failed to save updated community: %w", err)
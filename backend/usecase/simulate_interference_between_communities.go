@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/rayfiyo/zousui/backend/domain/entity"
 	"github.com/rayfiyo/zousui/backend/domain/repository"
 	"github.com/rayfiyo/zousui/backend/utils/consts"
@@ -12,29 +13,32 @@ import (
 )
 
 type SimulateInterferenceBetweenCommunitiesUsecase struct {
-	communityRepo  repository.CommunityRepository
-	llmGateway     repository.LLMGateway
-	simulationRepo repository.SimulationRepository
+	communityRepo repository.CommunityRepository
+	llmGateway    repository.LLMGateway
+	uow           repository.UnitOfWork
+	usageUC       *LLMUsageUsecase
 }
 
 func NewSimulateInterferenceBetweenCommunitiesUsecase(
 	cr repository.CommunityRepository,
 	lg repository.LLMGateway,
-	sr repository.SimulationRepository,
+	uow repository.UnitOfWork,
+	uu *LLMUsageUsecase,
 ) *SimulateInterferenceBetweenCommunitiesUsecase {
 	zap.L().Debug("Initializing SimulateInterferenceBetweenCommunitiesUsecase")
 	return &SimulateInterferenceBetweenCommunitiesUsecase{
-		communityRepo:  cr,
-		llmGateway:     lg,
-		simulationRepo: sr,
+		communityRepo: cr,
+		llmGateway:    lg,
+		uow:           uow,
+		usageUC:       uu,
 	}
 }
 
-// 干渉シミュレーション本体
+// 干渉シミュレーション本体（保存したシミュレーション結果を返す）
 func (uc *SimulateInterferenceBetweenCommunitiesUsecase) Execute(
 	ctx context.Context,
 	commAID, commBID, userInput string,
-) error {
+) (*entity.SimulationResult, error) {
 	logger := zap.L()
 
 	// コミュニティA,Bを取得
@@ -44,13 +48,13 @@ func (uc *SimulateInterferenceBetweenCommunitiesUsecase) Execute(
 	if err != nil {
 		logger.Error("Failed to get community A",
 			zap.String("commA", commAID), zap.Error(err))
-		return fmt.Errorf("failed to get community A: %w", err)
+		return nil, fmt.Errorf("failed to get community A: %w", err)
 	}
 	commB, err := uc.communityRepo.GetByID(ctx, commBID)
 	if err != nil {
 		logger.Error("Failed to get community B",
 			zap.String("commB", commBID), zap.Error(err))
-		return fmt.Errorf("failed to get community B: %w", err)
+		return nil, fmt.Errorf("failed to get community B: %w", err)
 	}
 
 	// プロンプト作成: 2つのコミュニティの文化が互いに干渉したらどうなるか
@@ -89,13 +93,25 @@ func (uc *SimulateInterferenceBetweenCommunitiesUsecase) Execute(
 		consts.SpecifyingResponseFormat, // 追加で「必ずJSONで返してね」の指示
 	)
 
-	// LLM呼び出し (MultiLLMGatewayを想定)
+	// LLM呼び出し (MultiLLMGatewayを想定、予算を使い切っていれば問い合わせない)
+	if err := uc.usageUC.CheckBudget(ctx); err != nil {
+		return nil, err
+	}
 	logger.Debug("Interference between communities prompt",
 		zap.String("prompt", prompt))
-	llmResp, err := uc.llmGateway.GenerateCultureUpdate(ctx, prompt, userInput)
+	simID := uuid.New().String()
+	rec := entity.NewTranscriptRecorder()
+	defer uc.usageUC.Record(ctx, rec, simID, entity.SimulationTypeInterference,
+		commAID, commBID)
+	llmCtx := entity.ContextWithTranscriptRecorder(ctx, rec)
+	// プロンプト末尾の指示に従い "newCulture" と "populationChange" で返された場合も受け付ける
+	llmResp, schemaIdx, err := generateStructured(llmCtx, uc.llmGateway,
+		simulationRequest(entity.SimulationTypeInterference, prompt, userInput,
+			consts.InterferenceTemperature, commAID, commBID),
+		entity.TwoPartyInterferenceSchema, entity.CultureUpdateSchema)
 	if err != nil {
 		logger.Error("LLM generation failed", zap.Error(err))
-		return fmt.Errorf("failed to generate culture update: %w", err)
+		return nil, fmt.Errorf("failed to generate culture update: %w", err)
 	}
 
 	// JSONパース
@@ -105,72 +121,78 @@ func (uc *SimulateInterferenceBetweenCommunitiesUsecase) Execute(
 		NewCultureB       string `json:"newCultureB"`
 		PopulationChangeB int    `json:"populationChangeB"`
 	}
-	if err := json.Unmarshal([]byte(llmResp), &result); err != nil {
-		logger.Error("JSON unmarshal failed", zap.Error(err),
-			zap.String("response", llmResp))
-		return fmt.Errorf("invalid JSON from LLM: %w\nLLM response was: %s",
-			err, llmResp)
-	}
-
-	// expected フィールドが空なら、"newCulture" と "populationChange" キーで再取得
-	if result.NewCultureA == "" && result.NewCultureB == "" {
+	if schemaIdx == 0 {
+		if err := json.Unmarshal([]byte(llmResp), &result); err != nil {
+			return nil, fmt.Errorf("failed to decode interference result: %w", err)
+		}
+	} else {
+		// A のみ変更を適用
 		logger.Warn("LLM response missing expected keys, applying fallback parsing")
-		var tmp map[string]interface{}
-		if err2 := json.Unmarshal([]byte(llmResp), &tmp); err2 == nil {
-			if nc, ok := tmp["newCulture"].(string); ok {
-				// A のみ変更を適用
-				result.NewCultureA = nc
-				// result.NewCultureB = nc
-			}
-			if pc, ok := tmp["populationChange"].(float64); ok {
-				result.PopulationChangeA = int(pc)
-				// result.PopulationChangeB = int(pc)
-			}
+		var single entity.CultureUpdateResponse
+		if err := json.Unmarshal([]byte(llmResp), &single); err != nil {
+			return nil, fmt.Errorf("failed to decode interference result: %w", err)
 		}
+		result.NewCultureA = single.NewCulture
+		result.PopulationChangeA = single.PopulationChange
 	}
 	logger.Debug("Interference result", zap.Any("result", result))
 
 	// 結果をコミュニティA, Bに反映
+	beforeA, beforeB := *commA, *commB
 	if result.NewCultureA != "" {
-		commA.Culture = result.NewCultureA
+		commA.UpdateCulture(result.NewCultureA)
 	}
 	commA.Population += result.PopulationChangeA
 	if commA.Population < 0 {
 		commA.Population = 0
 	}
 	if result.NewCultureB != "" {
-		commB.Culture = result.NewCultureB
+		commB.UpdateCulture(result.NewCultureB)
 	}
 	commB.Population += result.PopulationChangeB
 	if commB.Population < 0 {
 		commB.Population = 0
 	}
 
-	//
-	if err := uc.communityRepo.Save(ctx, commA); err != nil {
-		logger.Error("Failed to save community A",
-			zap.String("commA", commAID), zap.Error(err))
-		return fmt.Errorf("failed to save community A: %w", err)
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal interference result: %w", err)
 	}
-	if err := uc.communityRepo.Save(ctx, commB); err != nil {
-		logger.Error("Failed to save community B",
-			zap.String("commB", commBID), zap.Error(err))
-		return fmt.Errorf("failed to save community B: %w", err)
+	simResult, err := entity.NewSimulationResult(simID,
+		entity.SimulationTypeInterference, json.RawMessage(resultJSON), userInput,
+		entity.NewCommunityChange(beforeA, commA),
+		entity.NewCommunityChange(beforeB, commB))
+	if err != nil {
+		return nil, err
 	}
 
-	resultJSON, _ := json.Marshal(result)
-	simResult := &entity.SimulationResult{
-		Type:        "interference",
-		Communities: []string{commAID, commBID},
-		ResultJSON:  string(resultJSON),
-	}
-	if err := uc.simulationRepo.Save(ctx, simResult); err != nil {
-		logger.Error("Failed to save community B",
-			zap.String("commB", commBID), zap.Error(err))
-		return fmt.Errorf("failed to save community B: %w", err)
+	// 両コミュニティ・履歴・文化の改訂・イベントをまとめて保存
+	// どれか1つでも失敗した場合は何も反映しない
+	if err := uc.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if err := appendEvent(ctx, repos.Events, entity.EventInterferenceApplied,
+			commAID, simResult.ID, entity.InterferenceAppliedPayload{
+				Communities: simResult.Communities,
+				UserInput:   userInput,
+				Result:      resultJSON,
+			}); err != nil {
+			return err
+		}
+		if err := saveCommunityChange(ctx, repos, beforeA, commA,
+			simResult.ID, simResult.Type); err != nil {
+			return err
+		}
+		if err := saveCommunityChange(ctx, repos, beforeB, commB,
+			simResult.ID, simResult.Type); err != nil {
+			return err
+		}
+		return recordSimulation(ctx, repos, simResult, rec)
+	}); err != nil {
+		logger.Error("Failed to save interference result",
+			zap.String("commA", commAID), zap.String("commB", commBID), zap.Error(err))
+		return nil, err
 	}
 
 	logger.Info("Interference between communities executed successfully",
 		zap.String("commA", commAID), zap.String("commB", commBID))
-	return nil
+	return simResult, nil
 }
@@ -0,0 +1,113 @@
+package usecase_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"github.com/rayfiyo/zousui/backend/utils/config"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+)
+
+// echoInputGateway: 利用者の入力をそのまま使って答えるゲートウェイ
+// 最初の問い合わせには形式に合わない応答を返し、問い直させる
+type echoInputGateway struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (g *echoInputGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	g.mu.Lock()
+	g.calls++
+	first := g.calls == 1
+	g.mu.Unlock()
+
+	if first {
+		return "「" + req.UserInput + "」を取り入れます", nil
+	}
+	raw, err := json.Marshal(map[string]any{
+		"newCultureA": req.UserInput + "の文化", "populationChangeA": 3,
+		"newCultureB": "交易の文化", "populationChangeB": -1,
+	})
+	return string(raw), err
+}
+
+func (g *echoInputGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 伏せる設定では、保存したやり取りの記録のどこにも利用者の入力が残らない
+// シミュレーション履歴には実行した指示として元の入力を残す
+func TestInterferenceTranscriptRedactsUserInput(t *testing.T) {
+	const userInput = "秘密の合言葉を広める"
+	config.TranscriptRedactUserInput = true
+	t.Cleanup(func() { config.TranscriptRedactUserInput = false })
+
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			for _, c := range []*entity.Community{
+				{ID: "river", Name: "川の民", Population: 100, Culture: "漁業"},
+				{ID: "mountain", Name: "山の民", Population: 80, Culture: "狩猟"},
+			} {
+				if err := s.communities.Save(ctx, c); err != nil {
+					t.Fatalf("failed to save community: %v", err)
+				}
+			}
+
+			sub := func(name string) gateway.NamedLLMGateway {
+				return gateway.NamedLLMGateway{Name: name, Gateway: gateway.NewRecordingLLMGateway(
+					&echoInputGateway{}, name, "")}
+			}
+			gw := gateway.NewRecordingLLMGateway(gateway.NewMultiLLMGateway(nil,
+				map[string]string{entity.SimulationTypeInterference: entity.LLMAggregateFirstValid},
+				0, 0, sub("a"), sub("b")), "multi", "")
+			uc := usecase.NewSimulateInterferenceBetweenCommunitiesUsecase(s.communities, gw, s.uow,
+				usecase.NewLLMUsageUsecase(s.usage, entity.LLMBudget{}))
+
+			result, err := uc.Execute(ctx, "river", "mountain", userInput)
+			if err != nil {
+				t.Fatalf("failed to simulate: %v", err)
+			}
+
+			transcript, err := s.transcripts.GetBySimulation(ctx, result.ID)
+			if err != nil {
+				t.Fatalf("failed to get transcript: %v", err)
+			}
+			raw, err := json.Marshal(transcript)
+			if err != nil {
+				t.Fatalf("failed to encode transcript: %v", err)
+			}
+			if strings.Contains(string(raw), userInput) {
+				t.Errorf("transcript contains the user input: %s", raw)
+			}
+			var repaired bool
+			for _, e := range transcript.Exchanges {
+				repaired = repaired || e.Stage == entity.LLMStageRepair
+			}
+			if !repaired || !strings.Contains(string(raw), consts.RedactedText) {
+				t.Errorf("transcript = %s, want a redacted repair exchange", raw)
+			}
+
+			var record entity.SimulationRecord
+			if err := json.Unmarshal([]byte(result.ResultJSON), &record); err != nil {
+				t.Fatalf("failed to decode simulation result: %v", err)
+			}
+			if record.UserInput != userInput {
+				t.Errorf("simulation user input = %q, want %q", record.UserInput, userInput)
+			}
+		})
+	}
+}
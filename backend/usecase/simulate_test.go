@@ -0,0 +1,314 @@
+package usecase_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/infrastructure/repository"
+	"github.com/rayfiyo/zousui/backend/interface/gateway"
+	"github.com/rayfiyo/zousui/backend/usecase"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+)
+
+// テストで使うリポジトリ一式
+type testStorage struct {
+	communities domainrepo.CommunityRepository
+	agents      domainrepo.AgentRepository
+	simulations domainrepo.SimulationRepository
+	transcripts domainrepo.TranscriptRepository
+	usage       domainrepo.LLMUsageRepository
+	events      domainrepo.EventStore
+	world       domainrepo.WorldRepository
+	uow         domainrepo.UnitOfWork
+}
+
+func newMemoryStorage(t *testing.T) *testStorage {
+	t.Helper()
+	cr := repository.NewMemoryCommunityRepo()
+	ar := repository.NewMemoryAgentRepo()
+	sr := repository.NewMemorySimulationRepo()
+	rr := repository.NewMemoryCultureRevisionRepo()
+	es := repository.NewMemoryEventStore()
+	tr := repository.NewMemoryTranscriptRepo()
+	return &testStorage{
+		communities: cr,
+		agents:      ar,
+		simulations: sr,
+		transcripts: tr,
+		usage:       repository.NewMemoryLLMUsageRepo(),
+		events:      es,
+		world:       repository.NewMemoryWorldRepo(cr, ar, sr, rr),
+		uow:         repository.NewMemoryUnitOfWork(cr, ar, sr, rr, es, tr),
+	}
+}
+
+func newSQLiteStorage(t *testing.T) *testStorage {
+	t.Helper()
+	db, err := repository.OpenSQLite(context.Background(),
+		filepath.Join(t.TempDir(), "zousui.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &testStorage{
+		communities: repository.NewSQLiteCommunityRepo(db),
+		agents:      repository.NewSQLiteAgentRepo(db),
+		simulations: repository.NewSQLiteSimulationRepo(db),
+		transcripts: repository.NewSQLiteTranscriptRepo(db),
+		usage:       repository.NewSQLiteLLMUsageRepo(db),
+		events:      repository.NewSQLiteEventStore(db),
+		world:       repository.NewSQLiteWorldRepo(db),
+		uow:         repository.NewSQLiteUnitOfWork(db),
+	}
+}
+
+var storages = map[string]func(t *testing.T) *testStorage{
+	"memory": newMemoryStorage,
+	"sqlite": newSQLiteStorage,
+}
+
+// barrierGateway: n 件の問い合わせがそろうまで応答を返さないゲートウェイ
+// すべてのシミュレーションがコミュニティを読み込んだ後に保存させ、競合を確実に起こす
+type barrierGateway struct {
+	response string
+
+	mu      sync.Mutex
+	waiting int
+	release chan struct{}
+}
+
+func newBarrierGateway(n int, response string) *barrierGateway {
+	return &barrierGateway{response: response, waiting: n, release: make(chan struct{})}
+}
+
+func (g *barrierGateway) Generate(
+	ctx context.Context,
+	req *entity.LLMRequest,
+) (string, error) {
+	g.mu.Lock()
+	g.waiting--
+	if g.waiting == 0 {
+		close(g.release)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.release:
+		return g.response, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (g *barrierGateway) GenerateCultureUpdate(
+	ctx context.Context,
+	prompt, userInput string,
+) (string, error) {
+	return g.Generate(ctx, entity.NewLLMRequest(prompt, userInput))
+}
+
+// 同じコミュニティへの2つのシミュレーションを同時に実行すると、
+// 片方だけが保存され、もう片方は版の競合で何も保存しない
+func TestSimulateCultureEvolutionConcurrentConflict(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			if err := s.communities.Save(ctx, &entity.Community{
+				ID: "c1", Name: "川の民", Population: 100, Culture: "漁業",
+			}); err != nil {
+				t.Fatalf("failed to save community: %v", err)
+			}
+
+			gw := newBarrierGateway(2, `{"newCulture": "祭りの文化", "populationChange": 5}`)
+			uc := usecase.NewSimulateCultureEvolutionUsecase(s.communities, s.agents, s.uow, gw,
+				usecase.NewLLMUsageUsecase(s.usage, entity.LLMBudget{}))
+
+			errs := make([]error, 2)
+			var wg sync.WaitGroup
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, errs[i] = uc.Execute(ctx, "c1")
+				}(i)
+			}
+			wg.Wait()
+
+			var succeeded, conflicted int
+			for _, err := range errs {
+				switch {
+				case err == nil:
+					succeeded++
+				case errors.Is(err, domainrepo.ErrVersionConflict):
+					conflicted++
+				default:
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if succeeded != 1 || conflicted != 1 {
+				t.Fatalf("succeeded = %d, conflicted = %d, want 1 and 1", succeeded, conflicted)
+			}
+
+			comm, err := s.communities.GetByID(ctx, "c1")
+			if err != nil {
+				t.Fatalf("failed to get community: %v", err)
+			}
+			if comm.Version != 2 || comm.Population != 105 || comm.Culture != "祭りの文化" {
+				t.Errorf("community = version %d, population %d, culture %q; "+
+					"want version 2, population 105, culture %q",
+					comm.Version, comm.Population, comm.Culture, "祭りの文化")
+			}
+			sims, err := s.simulations.GetAll(ctx)
+			if err != nil {
+				t.Fatalf("failed to get simulations: %v", err)
+			}
+			if len(sims) != 1 {
+				t.Errorf("got %d simulations, want 1", len(sims))
+			}
+		})
+	}
+}
+
+// 記録済みのカセット: 川の民は文化が変わり、山の民は流量制限で失敗する
+const cultureEvolutionCassette = "testdata/culture_evolution_cassette.json"
+
+// newCassetteSimulation: カセットを記録したときと同じコミュニティ・エージェントを用意し、
+// カセットを再生するシミュレーションを作る
+func newCassetteSimulation(
+	t *testing.T,
+	s *testStorage,
+) *usecase.SimulateCultureEvolutionUsecase {
+	t.Helper()
+	ctx := context.Background()
+	for _, c := range []*entity.Community{
+		{ID: "river", Name: "川の民", Population: 100, Culture: "漁業"},
+		{ID: "mountain", Name: "山の民", Population: 80, Culture: "狩猟"},
+		{ID: "forest", Name: "森の民", Population: 50, Culture: "採集"}, // カセットに無い
+	} {
+		if err := s.communities.Save(ctx, c); err != nil {
+			t.Fatalf("failed to save community: %v", err)
+		}
+	}
+	if err := s.agents.Save(ctx, &entity.Agent{
+		ID: "a1", Name: "ミナト", CommunityID: "river", Personality: "好奇心旺盛",
+	}); err != nil {
+		t.Fatalf("failed to save agent: %v", err)
+	}
+
+	cassette, err := gateway.LoadCassette(cultureEvolutionCassette)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	gw, err := gateway.NewCassetteLLMGateway(nil, cassette, "primary",
+		consts.CassetteModeReplay)
+	if err != nil {
+		t.Fatalf("failed to create cassette gateway: %v", err)
+	}
+	// 起動時と同じく、やり取りと利用量を記録するゲートウェイで包む
+	return usecase.NewSimulateCultureEvolutionUsecase(s.communities, s.agents, s.uow,
+		gateway.NewRecordingLLMGateway(gw, "cassette", ""),
+		usecase.NewLLMUsageUsecase(s.usage, entity.LLMBudget{}))
+}
+
+// カセットの応答でコミュニティを更新し、シミュレーション結果を保存する
+func TestSimulateCultureEvolutionReplaysCassette(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			uc := newCassetteSimulation(t, s)
+
+			result, err := uc.Execute(ctx, "river")
+			if err != nil {
+				t.Fatalf("failed to simulate: %v", err)
+			}
+
+			const newCulture = "川辺で灯籠を流す祭りを中心とした漁業文化"
+			comm, err := s.communities.GetByID(ctx, "river")
+			if err != nil {
+				t.Fatalf("failed to get community: %v", err)
+			}
+			if comm.Culture != newCulture || comm.Population != 112 || comm.Version != 2 {
+				t.Errorf("community = culture %q, population %d, version %d; "+
+					"want culture %q, population 112, version 2",
+					comm.Culture, comm.Population, comm.Version, newCulture)
+			}
+
+			saved, err := s.simulations.GetByID(ctx, result.ID)
+			if err != nil {
+				t.Fatalf("failed to get simulation: %v", err)
+			}
+			if saved.Type != entity.SimulationTypeCultureEvolution ||
+				len(saved.Communities) != 1 || saved.Communities[0] != "river" {
+				t.Errorf("simulation = type %q, communities %v; want %q, [river]",
+					saved.Type, saved.Communities, entity.SimulationTypeCultureEvolution)
+			}
+			var record entity.SimulationRecord
+			if err := json.Unmarshal([]byte(saved.ResultJSON), &record); err != nil {
+				t.Fatalf("failed to decode simulation result: %v", err)
+			}
+			want := entity.CommunityChange{
+				CommunityID: "river", PrevCulture: "漁業", NewCulture: newCulture,
+				PrevPopulation: 100, NewPopulation: 112, PopulationDelta: 12,
+			}
+			if len(record.Changes) != 1 || record.Changes[0] != want {
+				t.Errorf("changes = %+v, want [%+v]", record.Changes, want)
+			}
+		})
+	}
+}
+
+// カセットに記録された失敗は分類ごと再現し、何も保存しない
+func TestSimulateCultureEvolutionReplaysCassetteError(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStorage(t)
+	uc := newCassetteSimulation(t, s)
+
+	_, err := uc.Execute(ctx, "mountain")
+	if !errors.Is(err, domainrepo.ErrLLMRateLimited) {
+		t.Fatalf("error = %v, want %v", err, domainrepo.ErrLLMRateLimited)
+	}
+	assertUnchanged(t, s, "mountain", "狩猟", 80)
+}
+
+// カセットに無いプロンプトは ErrCassetteMiss で失敗し、何も保存しない
+func TestSimulateCultureEvolutionCassetteMiss(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStorage(t)
+	uc := newCassetteSimulation(t, s)
+
+	_, err := uc.Execute(ctx, "forest")
+	if !errors.Is(err, gateway.ErrCassetteMiss) {
+		t.Fatalf("error = %v, want %v", err, gateway.ErrCassetteMiss)
+	}
+	assertUnchanged(t, s, "forest", "採集", 50)
+}
+
+// assertUnchanged: コミュニティが更新されず、シミュレーション結果も保存されていない
+func assertUnchanged(t *testing.T, s *testStorage, id, culture string, population int) {
+	t.Helper()
+	ctx := context.Background()
+	comm, err := s.communities.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get community: %v", err)
+	}
+	if comm.Culture != culture || comm.Population != population || comm.Version != 1 {
+		t.Errorf("community = culture %q, population %d, version %d; "+
+			"want culture %q, population %d, version 1",
+			comm.Culture, comm.Population, comm.Version, culture, population)
+	}
+	sims, err := s.simulations.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("failed to get simulations: %v", err)
+	}
+	if len(sims) != 0 {
+		t.Errorf("got %d simulations, want 0", len(sims))
+	}
+}
@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
+	"go.uber.org/zap"
+)
+
+type SimulationHistoryUsecase struct {
+	simulationRepo repository.SimulationRepository
+	transcriptRepo repository.TranscriptRepository
+}
+
+func NewSimulationHistoryUsecase(
+	sr repository.SimulationRepository,
+	tr repository.TranscriptRepository,
+) *SimulationHistoryUsecase {
+	zap.L().Debug("Initializing SimulationHistoryUsecase")
+	return &SimulationHistoryUsecase{
+		simulationRepo: sr,
+		transcriptRepo: tr,
+	}
+}
+
+// 条件に合うシミュレーション履歴を新しい順に1ページ分取得
+// 件数の指定がなければ既定値、上限を超えていれば上限に揃える
+func (uc *SimulationHistoryUsecase) Find(
+	ctx context.Context,
+	query repository.SimulationQuery,
+) (*repository.SimulationPage, error) {
+	if query.Limit <= 0 {
+		query.Limit = consts.DefaultSimulationPageSize
+	}
+	if query.Limit > consts.MaxSimulationPageSize {
+		query.Limit = consts.MaxSimulationPageSize
+	}
+	zap.L().Debug("Finding simulations",
+		zap.String("communityID", query.CommunityID),
+		zap.String("type", query.Type),
+		zap.Int("limit", query.Limit))
+	return uc.simulationRepo.Find(ctx, query)
+}
+
+// ID でシミュレーション結果を取得
+func (uc *SimulationHistoryUsecase) GetByID(
+	ctx context.Context,
+	id string,
+) (*entity.SimulationResult, error) {
+	zap.L().Debug("Fetching simulation", zap.String("simulationID", id))
+	return uc.simulationRepo.GetByID(ctx, id)
+}
+
+// シミュレーションで行った LLM とのやり取りの記録を取得
+func (uc *SimulationHistoryUsecase) GetTranscript(
+	ctx context.Context,
+	simulationID string,
+) (*entity.Transcript, error) {
+	zap.L().Debug("Fetching transcript", zap.String("simulationID", simulationID))
+	// 完全削除などで履歴から消えたシミュレーションの記録は返さない
+	if _, err := uc.simulationRepo.GetByID(ctx, simulationID); err != nil {
+		return nil, err
+	}
+	return uc.transcriptRepo.GetBySimulation(ctx, simulationID)
+}
@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	"github.com/rayfiyo/zousui/backend/domain/repository"
+	"go.uber.org/zap"
+)
+
+type WorldUsecase struct {
+	worldRepo repository.WorldRepository
+	uow       repository.UnitOfWork
+}
+
+func NewWorldUsecase(
+	wr repository.WorldRepository,
+	uow repository.UnitOfWork,
+) *WorldUsecase {
+	zap.L().Debug("Initializing WorldUsecase")
+	return &WorldUsecase{worldRepo: wr, uow: uow}
+}
+
+// ワールド全体をスナップショットとして書き出す
+func (uc *WorldUsecase) Export(
+	ctx context.Context,
+) (*entity.WorldSnapshot, error) {
+	zap.L().Debug("Exporting world")
+	return uc.worldRepo.Export(ctx)
+}
+
+// スナップショットを検証してから、取り込んだことを示すイベントと一緒に取り込む
+func (uc *WorldUsecase) Import(
+	ctx context.Context,
+	snapshot *entity.WorldSnapshot,
+	mode entity.WorldImportMode,
+) error {
+	logger := zap.L()
+
+	logger.Debug("Importing world", zap.String("mode", string(mode)))
+	if mode != entity.WorldImportReplace && mode != entity.WorldImportMerge {
+		return fmt.Errorf("%w: unknown import mode %q",
+			entity.ErrInvalidWorldSnapshot, mode)
+	}
+	if err := snapshot.Validate(); err != nil {
+		logger.Warn("Invalid world snapshot", zap.Error(err))
+		return err
+	}
+	if err := uc.uow.Do(ctx, func(ctx context.Context, repos repository.TxRepositories) error {
+		if err := repos.World.Import(ctx, snapshot, mode); err != nil {
+			return err
+		}
+		return appendWorldImportedEvent(ctx, repos.Events, snapshot, mode)
+	}); err != nil {
+		logger.Error("Failed to import world", zap.Error(err))
+		return err
+	}
+	logger.Info("World imported", zap.String("mode", string(mode)))
+	return nil
+}
+
+// JSON 形式のスナップショットを読み込んで取り込む
+// スナップショットに無い項目（やり取りの記録や LLM の利用量など）を含む文書は、
+// その部分を黙って捨てることになるため受け付けない
+func (uc *WorldUsecase) ImportFrom(
+	ctx context.Context,
+	r io.Reader,
+	mode entity.WorldImportMode,
+) error {
+	var snapshot entity.WorldSnapshot
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&snapshot); err != nil {
+		return fmt.Errorf("%w: %v", entity.ErrInvalidWorldSnapshot, err)
+	}
+	return uc.Import(ctx, &snapshot, mode)
+}
@@ -0,0 +1,55 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rayfiyo/zousui/backend/domain/entity"
+	domainrepo "github.com/rayfiyo/zousui/backend/domain/repository"
+	"github.com/rayfiyo/zousui/backend/usecase"
+)
+
+// 取り込みと WorldImported イベントは一緒に残り、スナップショットに無い項目を含む文書は何も変えずに拒否する
+func TestWorldImportFrom(t *testing.T) {
+	const community = `{"formatVersion": 1, "communities": [{"ID": "c1", "Name": "川の民"}]`
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStorage(t)
+			uc := usecase.NewWorldUsecase(s.world, s.uow)
+
+			if err := uc.ImportFrom(ctx, strings.NewReader(community+`}`),
+				entity.WorldImportReplace); err != nil {
+				t.Fatalf("failed to import: %v", err)
+			}
+			if _, err := s.communities.GetByID(ctx, "c1"); err != nil {
+				t.Errorf("imported community: %v", err)
+			}
+			events, _ := s.events.List(ctx, 0, 0)
+			if len(events) != 1 || events[0].Type != entity.EventWorldImported {
+				t.Errorf("events = %+v, want one %s", events, entity.EventWorldImported)
+			}
+
+			for _, extra := range []string{
+				`"transcripts": [{"simulationId": "s1"}]`,
+				`"usage": [{"id": "u1"}]`,
+			} {
+				err := uc.ImportFrom(ctx, strings.NewReader(
+					`{"formatVersion": 1, "communities": [{"ID": "c2"}], `+extra+`}`),
+					entity.WorldImportMerge)
+				if !errors.Is(err, entity.ErrInvalidWorldSnapshot) {
+					t.Errorf("%s: error = %v, want %v", extra, err, entity.ErrInvalidWorldSnapshot)
+				}
+			}
+			if _, err := s.communities.GetByID(ctx, "c2"); !errors.Is(
+				err, domainrepo.ErrCommunityNotFound) {
+				t.Errorf("community error = %v, want %v", err, domainrepo.ErrCommunityNotFound)
+			}
+			if events, _ := s.events.List(ctx, 0, 0); len(events) != 1 {
+				t.Errorf("events = %+v, want only the first import", events)
+			}
+		})
+	}
+}
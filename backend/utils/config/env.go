@@ -1,15 +1,82 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/rayfiyo/zousui/backend/utils/consts"
 )
 
 var (
-	GeminiAPIKEY string
-	OpenAIAPIKEY string
+	GeminiAPIKEY  string
+	OpenAIAPIKEY  string
+	StorageDriver string // "memory" または "sqlite"
+	SQLitePath    string
+
+	// シミュレーションで使う LLM と、集約ゲートウェイで並列に使う LLM の一覧
+	LLMProvider       string
+	MultiLLMProviders []string
+	// シミュレーションの種類ごとの、集約ゲートウェイでの回答のまとめ方
+	// 載っている種類のシミュレーションは集約ゲートウェイを使う
+	MultiLLMAggregation map[string]string
+	// 集約ゲートウェイのサブゲートウェイごとの期限と、待つのをやめる形式に合った回答の数
+	MultiLLMTimeout time.Duration
+	MultiLLMQuorum  int
+
+	// OpenAI 互換 API (OpenAI, llama.cpp server, vLLM, LM Studio など)
+	OpenAIBaseURL  string
+	OpenAIModel    string
+	OpenAIJSONMode bool
+	OpenAITimeout  time.Duration
+
+	// ローカルの Ollama
+	OllamaBaseURL string
+	OllamaModel   string
+	OllamaTimeout time.Duration
+	OllamaPull    bool // モデルが無いときに取得するか
+
+	// 一時的な失敗（レート制限・利用不可）の再試行
+	LLMMaxRetries     int
+	LLMRetryBaseDelay time.Duration
+	LLMRetryMaxDelay  time.Duration
+
+	// 失敗が続いた提供元をしばらく使わないサーキットブレーカー（回数が 0 なら使わない）
+	LLMBreakerFailures int
+	LLMBreakerCooldown time.Duration
+
+	// LLM_PROVIDER が失敗したときに優先順に使う LLM の一覧
+	LLMFallbackProviders []string
+
+	// 提供元ごとの流量制限
+	LLMRateLimits map[string]LLMRateLimit
+
+	// scripted モックの応答ルール (YAML/JSON)。空なら組み込みのルールを使う
+	MockRulesPath string
+
+	// LLM の応答を記録・再生するカセット（モードが空なら使わない）
+	LLMCassetteMode string
+	LLMCassettePath string
+
+	// 同じ問い合わせへの応答を使い回すキャッシュ（パスが空ならメモリ上だけに持つ）
+	LLMCacheEnabled    bool
+	LLMCacheTTL        time.Duration
+	LLMCacheMaxEntries int
+	LLMCachePath       string
+
+	// モデルごとの料金と、新しい LLM の利用を断る予算（0 は上限なし）
+	LLMPricing      map[string]LLMPrice
+	LLMBudgetUSD    float64
+	LLMBudgetTokens int
+	LLMBudgetPeriod string // "day" または "total"
+
+	// LLM とのやり取りの記録で、利用者の入力を伏せ字にするか
+	// 伏せるのはやり取りの記録だけで、シミュレーション履歴やイベントの userInput はそのまま残す
+	TranscriptRedactUserInput bool
 )
 
 func LoadEnv() error {
@@ -18,8 +85,242 @@ func LoadEnv() error {
 		return err
 	}
 
+	var err error
 	GeminiAPIKEY = os.Getenv("GEMINI_API_KEY")
 	OpenAIAPIKEY = os.Getenv("OPENAI_API_KEY")
+	StorageDriver = getEnv("STORAGE_DRIVER", consts.StorageDriverMemory)
+	SQLitePath = getEnv("SQLITE_PATH", consts.DefaultSQLitePath)
+	LLMProvider = getEnv("LLM_PROVIDER", consts.LLMProviderGemini)
+	MultiLLMProviders = splitList(getEnv("MULTI_LLM_PROVIDERS",
+		LLMProvider+","+consts.LLMProviderMock))
+	if MultiLLMAggregation, err = parseMultiLLMAggregation(getEnv("MULTI_LLM_AGGREGATION",
+		consts.DefaultMultiLLMAggregation)); err != nil {
+		return err
+	}
+	if MultiLLMTimeout, err = getEnvDuration("MULTI_LLM_TIMEOUT",
+		consts.DefaultMultiLLMTimeout); err != nil {
+		return err
+	}
+	if MultiLLMQuorum, err = getEnvInt("MULTI_LLM_QUORUM",
+		consts.DefaultMultiLLMQuorum); err != nil {
+		return err
+	}
+	OpenAIBaseURL = getEnv("OPENAI_BASE_URL", consts.DefaultOpenAIBaseURL)
+	OpenAIModel = getEnv("OPENAI_MODEL", consts.DefaultOpenAIChatModel)
+	OpenAIJSONMode = getEnv("OPENAI_JSON_MODE", "true") == "true"
+	if OpenAITimeout, err = getEnvDuration("OPENAI_TIMEOUT",
+		consts.DefaultOpenAITimeout); err != nil {
+		return err
+	}
+	OllamaBaseURL = getEnv("OLLAMA_BASE_URL", consts.DefaultOllamaBaseURL)
+	OllamaModel = getEnv("OLLAMA_MODEL", consts.DefaultOllamaModel)
+	OllamaPull = getEnv("OLLAMA_PULL", "true") == "true"
+	if OllamaTimeout, err = getEnvDuration("OLLAMA_TIMEOUT",
+		consts.DefaultOllamaTimeout); err != nil {
+		return err
+	}
+	if LLMMaxRetries, err = getEnvInt("LLM_MAX_RETRIES",
+		consts.DefaultLLMMaxRetries); err != nil {
+		return err
+	}
+	if LLMRetryBaseDelay, err = getEnvDuration("LLM_RETRY_BASE_DELAY",
+		consts.DefaultLLMRetryBaseDelay); err != nil {
+		return err
+	}
+	if LLMRetryMaxDelay, err = getEnvDuration("LLM_RETRY_MAX_DELAY",
+		consts.DefaultLLMRetryMaxDelay); err != nil {
+		return err
+	}
+	if LLMBreakerFailures, err = getEnvInt("LLM_BREAKER_FAILURES",
+		consts.DefaultLLMBreakerFailures); err != nil {
+		return err
+	}
+	if LLMBreakerCooldown, err = getEnvDuration("LLM_BREAKER_COOLDOWN",
+		consts.DefaultLLMBreakerCooldown); err != nil {
+		return err
+	}
+	LLMFallbackProviders = splitList(os.Getenv("LLM_FALLBACK_PROVIDERS"))
+	MockRulesPath = os.Getenv("MOCK_RULES_PATH")
+	LLMCassetteMode = os.Getenv("LLM_CASSETTE_MODE")
+	LLMCassettePath = getEnv("LLM_CASSETTE_PATH", consts.DefaultCassettePath)
+	LLMCacheEnabled = getEnv("LLM_CACHE_ENABLED", "false") == "true"
+	if LLMCacheTTL, err = getEnvDuration("LLM_CACHE_TTL",
+		consts.DefaultLLMCacheTTL); err != nil {
+		return err
+	}
+	if LLMCacheMaxEntries, err = getEnvInt("LLM_CACHE_MAX_ENTRIES",
+		consts.DefaultLLMCacheMaxEntries); err != nil {
+		return err
+	}
+	LLMCachePath = os.Getenv("LLM_CACHE_PATH")
+	if LLMPricing, err = parseLLMPricing(getEnv("LLM_PRICING",
+		consts.DefaultLLMPricing)); err != nil {
+		return err
+	}
+	if LLMBudgetUSD, err = getEnvFloat("LLM_BUDGET_USD", 0); err != nil {
+		return err
+	}
+	if LLMBudgetTokens, err = getEnvInt("LLM_BUDGET_TOKENS", 0); err != nil {
+		return err
+	}
+	LLMBudgetPeriod = getEnv("LLM_BUDGET_PERIOD", "day")
+	TranscriptRedactUserInput = getEnv("TRANSCRIPT_REDACT_USER_INPUT", "false") == "true"
+
+	if LLMRateLimits, err = loadLLMRateLimits(); err != nil {
+		return err
+	}
 
 	return nil
 }
+
+// LLMRateLimit: 提供元ごとの流量制限（0 は制限なし）
+type LLMRateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+	MaxInFlight       int
+}
+
+// LLMPrice: 100万トークンあたりの料金 (USD)
+type LLMPrice struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// Cost: トークン数から費用 (USD) を求める
+func (p LLMPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.PromptPerMillion +
+		float64(completionTokens)*p.CompletionPerMillion) / 1_000_000
+}
+
+// "モデル=入力/出力" をカンマ区切りで並べた料金表を読む
+func parseLLMPricing(s string) (map[string]LLMPrice, error) {
+	pricing := make(map[string]LLMPrice)
+	for _, item := range splitList(s) {
+		model, prices, ok := strings.Cut(item, "=")
+		prompt, completion, ok2 := strings.Cut(prices, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid LLM_PRICING entry: %q", item)
+		}
+		var (
+			price LLMPrice
+			err   error
+		)
+		if price.PromptPerMillion, err = strconv.ParseFloat(
+			strings.TrimSpace(prompt), 64); err != nil {
+			return nil, fmt.Errorf("invalid LLM_PRICING entry %q: %w", item, err)
+		}
+		if price.CompletionPerMillion, err = strconv.ParseFloat(
+			strings.TrimSpace(completion), 64); err != nil {
+			return nil, fmt.Errorf("invalid LLM_PRICING entry %q: %w", item, err)
+		}
+		pricing[strings.TrimSpace(model)] = price
+	}
+	return pricing, nil
+}
+
+// "シミュレーションの種類=まとめ方" をカンマ区切りで並べた指定を読む
+func parseMultiLLMAggregation(s string) (map[string]string, error) {
+	aggregation := make(map[string]string)
+	for _, item := range splitList(s) {
+		simulationType, strategy, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid MULTI_LLM_AGGREGATION entry: %q", item)
+		}
+		aggregation[strings.TrimSpace(simulationType)] = strings.TrimSpace(strategy)
+	}
+	return aggregation, nil
+}
+
+// 提供元ごとに <PROVIDER>_RPM, <PROVIDER>_TPM, <PROVIDER>_MAX_IN_FLIGHT を読む
+func loadLLMRateLimits() (map[string]LLMRateLimit, error) {
+	defaults := map[string]LLMRateLimit{
+		consts.LLMProviderGemini: {
+			RequestsPerMinute: consts.DefaultGeminiRequestsPerMinute,
+			MaxInFlight:       consts.DefaultGeminiMaxInFlight,
+		},
+	}
+	limits := make(map[string]LLMRateLimit)
+	for _, provider := range []string{
+		consts.LLMProviderGemini,
+		consts.LLMProviderOpenAI,
+		consts.LLMProviderOllama,
+		consts.LLMProviderMock,
+		consts.LLMProviderScripted,
+	} {
+		prefix := strings.ToUpper(provider) + "_"
+		limit := defaults[provider]
+		var err error
+		if limit.RequestsPerMinute, err = getEnvInt(prefix+"RPM",
+			limit.RequestsPerMinute); err != nil {
+			return nil, err
+		}
+		if limit.TokensPerMinute, err = getEnvInt(prefix+"TPM",
+			limit.TokensPerMinute); err != nil {
+			return nil, err
+		}
+		if limit.MaxInFlight, err = getEnvInt(prefix+"MAX_IN_FLIGHT",
+			limit.MaxInFlight); err != nil {
+			return nil, err
+		}
+		limits[provider] = limit
+	}
+	return limits, nil
+}
+
+// 環境変数が未設定なら既定値を返す
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// 環境変数を時間 (例: 500ms, 2m) として読む。未設定なら既定値を返す
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// 環境変数を整数として読む。未設定なら既定値を返す
+func getEnvInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// 環境変数を小数として読む。未設定なら既定値を返す
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// カンマ区切りの値を空要素を除いて分割する
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
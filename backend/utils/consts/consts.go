@@ -1,14 +1,115 @@
 package consts
 
+import "time"
+
 const (
 	SpecifyingResponseFormat string = `このコミュニティの文化を新しい方向に進化させるアイデアを提案してください。**出力は必ず日本語で返してください。** あなたの出力は **必ず次のJSON形式** で返してください。
 {
     "newCulture": "string",
     "populationChange": 0
 }"`
-	AggregatedPromptHeader string = "次の「複数のアイデア」に「キーワード」と「追加情報」を取り入れた新たな文化の更新案をユニークな視点で示してください。"
+	AggregatedPromptHeader string = "次の「複数のアイデア」に「キーワード」と、続けて送る追加の指示（あれば）を取り入れた新たな文化の更新案をユニークな視点で示してください。"
 	GeminiModel            string = "gemini-2.0-flash-exp"
+	GeminiJSONInstruction  string = "指定された JSON スキーマに従って応答してください。**文章は必ず日本語で書いてください。**"
 	DALLEModel             string = "dall-e-3"
 	ImageSize              string = "1024x1024"
 	DALLEEndpoint          string = "https://api.openai.com/v1/images/generations"
+	StorageDriverMemory    string = "memory"
+	StorageDriverSQLite    string = "sqlite"
+	DefaultSQLitePath      string = "zousui.db"
+	RedactedText           string = "[REDACTED]"
+	RepairPromptHeader     string = "前回の応答は指定した JSON 形式に合いませんでした。理由を踏まえて、指定した形式の JSON オブジェクトだけを返してください。"
+	SimulationSystemPrompt string = "あなたは架空のコミュニティの文化と人口の移り変わりを予測するシミュレータです。指示された JSON 形式のオブジェクトだけを返してください。**文章は必ず日本語で書いてください。**"
+	MaxLLMRepairAttempts   int    = 2 // 形式に合わない応答を問い直す最大回数
+	JudgePromptHeader      string = "次の「候補」はどれも「元の指示」への回答です。指示に最もよく従い、内容が最も優れている候補を1つ選び、その番号と理由を JSON で返してください。"
+)
+
+// シミュレーションごとの生成の温度
+// 外交は結果が安定するよう低く、文化の変化は発想が広がるよう高くする
+const (
+	CultureEvolutionTemperature float64 = 1.0
+	DiplomacyTemperature        float64 = 0.3
+	InterferenceTemperature     float64 = 0.9
+)
+
+// 集約ゲートウェイを使うシミュレーションの種類と、回答のまとめ方の既定値
+// (MULTI_LLM_AGGREGATION と同じ形式)
+const DefaultMultiLLMAggregation string = "interference=synthesize"
+
+// 集約ゲートウェイの既定値（0 は期限なし・すべての回答を待つ）
+const (
+	DefaultMultiLLMTimeout time.Duration = 0
+	DefaultMultiLLMQuorum  int           = 0
+)
+
+// LLM の提供元（LLM_PROVIDER, MULTI_LLM_PROVIDERS で指定する名前）
+const (
+	LLMProviderGemini string = "gemini"
+	LLMProviderOpenAI string = "openai"
+	LLMProviderOllama string = "ollama"
+	LLMProviderMock   string = "mock"
+	// ルールファイル (MOCK_RULES_PATH) に従って応答するモック
+	LLMProviderScripted string = "scripted"
+)
+
+// OpenAI 互換 API の既定値
+const (
+	DefaultOpenAIBaseURL   string        = "https://api.openai.com/v1"
+	DefaultOpenAIChatModel string        = "gpt-4o-mini"
+	DefaultOpenAITimeout   time.Duration = 5 * time.Minute
+)
+
+// 提供元からストリーミングで届く1行（SSE の data: 行、Ollama の JSON 行）の最大の長さ
+const LLMStreamMaxLineBytes int = 1 << 20
+
+// シミュレーション履歴の1ページの件数
+const (
+	DefaultSimulationPageSize int = 50
+	MaxSimulationPageSize     int = 200
+)
+
+// Gemini の流量制限の既定値（他の提供元は既定では制限しない）
+const (
+	DefaultGeminiRequestsPerMinute int = 10
+	DefaultGeminiMaxInFlight       int = 4
+)
+
+// 一時的な失敗を再試行する既定値
+const (
+	DefaultLLMMaxRetries     int           = 3
+	DefaultLLMRetryBaseDelay time.Duration = 500 * time.Millisecond
+	DefaultLLMRetryMaxDelay  time.Duration = 10 * time.Second
 )
+
+// 提供元ごとのサーキットブレーカーの既定値
+const (
+	DefaultLLMBreakerFailures int           = 5
+	DefaultLLMBreakerCooldown time.Duration = 30 * time.Second
+)
+
+// Ollama の既定値
+const (
+	DefaultOllamaBaseURL string        = "http://localhost:11434"
+	DefaultOllamaModel   string        = "llama3.2"
+	DefaultOllamaTimeout time.Duration = 5 * time.Minute
+	OllamaPullTimeout    time.Duration = 30 * time.Minute
+)
+
+// LLM の応答を記録・再生するカセットのモード（LLM_CASSETTE_MODE）
+const (
+	CassetteModeRecord string = "record"
+	CassetteModeReplay string = "replay"
+
+	DefaultCassettePath string = "llm_cassette.json"
+)
+
+// LLM の応答キャッシュの既定値
+const (
+	DefaultLLMCacheTTL        time.Duration = 24 * time.Hour
+	DefaultLLMCacheMaxEntries int           = 1000
+)
+
+// モデルごとの料金の既定値 (LLM_PRICING と同じ形式、100万トークンあたりの USD で 入力/出力)
+// 載っていないモデル（ローカルのモデルやモック）は無料として扱う
+const DefaultLLMPricing string = "gemini-2.0-flash=0.10/0.40,gemini-2.0-flash-exp=0.10/0.40," +
+	"gpt-4o-mini=0.15/0.60,gpt-4o=2.50/10.00"
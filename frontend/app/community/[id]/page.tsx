@@ -112,7 +112,7 @@ export default function CommunityDetailPage() {
 
     try {
       setLoading(true);
-      // 例: "POST /communities/:communityID/generateImage"
+      // 例: "POST /communities/:id/generateImage"
       const url = `http://localhost:8080/communities/${community.ID}/generateImage`;
 
       // もし style などを追加したい場合は body JSON を入れる